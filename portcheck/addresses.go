@@ -0,0 +1,145 @@
+package main
+
+import (
+	"iter"
+	"maps"
+	"math/bits"
+	"math/rand/v2"
+	"net"
+	"strconv"
+)
+
+// addressList is the host:port pairs of a scan. They are generated as the
+// scan reaches them instead of being held in memory, since a /16 swept over
+// every port is four billion of them.
+type addressList struct {
+	hosts, ports []string
+	// shuffle, for -randomize, picks the pair probed at each position
+	shuffle *permutation
+	// skip holds the pairs already done, for -resume
+	skip    map[string]bool
+	skipped int
+	// keep, for verify, lets through only the pairs the manifest has a
+	// rule for, kept of them
+	keep func(host, port string) bool
+	kept int
+}
+
+// interleave pairs every host with every port. Port-major order interleaves
+// hosts, so the worker pool spreads load across all of them instead of
+// hammering one host at a time.
+func interleave(hosts, ports []string) addressList {
+	return addressList{hosts: hosts, ports: ports}
+}
+
+// len is how many pairs are left to probe.
+func (l addressList) len() int {
+	if l.keep != nil {
+		return l.kept - l.skipped
+	}
+	return len(l.hosts)*len(l.ports) - l.skipped
+}
+
+// all yields the pairs in scan order.
+func (l addressList) all() iter.Seq[string] {
+	return func(yield func(string) bool) {
+		n := uint64(len(l.hosts) * len(l.ports))
+		for i := range n {
+			j := i
+			if l.shuffle != nil {
+				j = l.shuffle.at(i)
+			}
+			host, port := l.hosts[j%uint64(len(l.hosts))], l.ports[j/uint64(len(l.hosts))]
+			if l.keep != nil && !l.keep(host, port) {
+				continue
+			}
+			address := net.JoinHostPort(host, port)
+			if l.skip[address] {
+				continue
+			}
+			if !yield(address) {
+				return
+			}
+		}
+	}
+}
+
+// without leaves out the pairs of results too, which are skipped when the
+// list is walked. Results for pairs the list doesn't have are ignored.
+func (l addressList) without(results []result) addressList {
+	hosts, ports := map[string]bool{}, map[string]bool{}
+	for _, h := range l.hosts {
+		hosts[h] = true
+	}
+	for _, p := range l.ports {
+		ports[p] = true
+	}
+	l.skip = maps.Clone(l.skip)
+	if l.skip == nil {
+		l.skip = map[string]bool{}
+	}
+	for _, r := range results {
+		port := strconv.Itoa(r.Port)
+		address := net.JoinHostPort(r.Host, port)
+		if hosts[r.Host] && ports[port] && (l.keep == nil || l.keep(r.Host, port)) && !l.skip[address] {
+			l.skip[address] = true
+			l.skipped++
+		}
+	}
+	return l
+}
+
+// only leaves in the pairs keep lets through, kept of them: the caller
+// counts them, as the list may be too long to walk for it. It comes before
+// without, whose pairs are then only counted if kept.
+func (l addressList) only(keep func(host, port string) bool, kept int) addressList {
+	l.keep, l.kept = keep, kept
+	return l
+}
+
+// permutation shuffles the positions 0..n-1 without listing them. A Feistel
+// network is a bijection on the numbers of its bit width, so positions it
+// maps past n are mapped again until they land below it (cycle walking);
+// the width is even and at most twice that of n, so that takes a few rounds
+// at most.
+type permutation struct {
+	n    uint64
+	half int
+	keys [4]uint64
+}
+
+func newPermutation(n, seed uint64) *permutation {
+	p := &permutation{n: n, half: max((bits.Len64(n-1)+1)/2, 1)}
+	rng := rand.New(rand.NewPCG(seed, seed))
+	for i := range p.keys {
+		p.keys[i] = rng.Uint64()
+	}
+	return p
+}
+
+func (p *permutation) at(i uint64) uint64 {
+	for {
+		if i = p.feistel(i); i < p.n {
+			return i
+		}
+	}
+}
+
+func (p *permutation) feistel(x uint64) uint64 {
+	mask := uint64(1)<<p.half - 1
+	l, r := x>>p.half, x&mask
+	for _, k := range p.keys {
+		l, r = r, l^(mix(r^k)&mask)
+	}
+	return l<<p.half | r
+}
+
+// mix is the finalizer of SplitMix64, which scrambles every bit of x into
+// every bit of the result.
+func mix(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	return x ^ x>>31
+}
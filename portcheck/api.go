@@ -0,0 +1,419 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net"
+	"net/http"
+	"net/netip"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gishyanart/helper-scripts/portcheck/portscan"
+)
+
+// apiToken, when set, must be sent as a bearer token with every API request.
+var apiToken string
+
+const (
+	// maxJobProbes bounds the host:port pairs a single submitted job may
+	// expand to, so one request can't tie the scanner up for days.
+	maxJobProbes = 1 << 20
+	// maxFinishedJobs is how many finished jobs are kept for fetching;
+	// older ones are forgotten first.
+	maxFinishedJobs = 100
+	// maxJobTimeout and maxJobRetries cap what a job may ask for, which
+	// with maxJobProbes bounds how long it holds the scanner.
+	maxJobTimeout = 10 * time.Second
+	maxJobRetries = 3
+)
+
+// jobRequest is the body of POST /scans, and the scan part of a daemon job.
+// Anything left out takes the value the server was started with.
+type jobRequest struct {
+	Targets          []string `json:"targets" yaml:"targets"`
+	Ports            string   `json:"ports,omitempty" yaml:"ports"`
+	TopPorts         int      `json:"top_ports,omitempty" yaml:"top_ports"`
+	UDP              bool     `json:"udp,omitempty" yaml:"udp"`
+	Timeout          string   `json:"timeout,omitempty" yaml:"timeout"`
+	Retries          *int     `json:"retries,omitempty" yaml:"retries"`
+	Banner           bool     `json:"banner,omitempty" yaml:"banner"`
+	VersionDetection bool     `json:"version_detection,omitempty" yaml:"version_detection"`
+	TLSInfo          bool     `json:"tls_info,omitempty" yaml:"tls_info"`
+	HTTPProbe        bool     `json:"http_probe,omitempty" yaml:"http_probe"`
+}
+
+// job is one submitted scan. Exported fields are its status as served by
+// the API; results grow while it runs.
+type job struct {
+	ID       string     `json:"id"`
+	Status   string     `json:"status"`
+	Request  jobRequest `json:"request"`
+	Created  time.Time  `json:"created"`
+	Started  *time.Time `json:"started,omitempty"`
+	Finished *time.Time `json:"finished,omitempty"`
+	Probes   int        `json:"probes"`
+	Summary  summary    `json:"summary"`
+	Error    string     `json:"error,omitempty"`
+
+	addresses addressList
+	results   []result
+	cancel    context.CancelFunc
+	// update is closed and replaced whenever results grow or the job ends
+	update chan struct{}
+}
+
+// jobServer runs submitted scans one at a time, in the order they came in,
+// so the load the service puts on the network stays that of a single scan.
+type jobServer struct {
+	ctx   context.Context
+	mu    sync.Mutex
+	jobs  map[string]*job
+	order []string
+	slot  chan struct{}
+}
+
+func newJobServer(ctx context.Context) *jobServer {
+	return &jobServer{ctx: ctx, jobs: map[string]*job{}, slot: make(chan struct{}, 1)}
+}
+
+// apiAllowed reports whether the scan API may listen on addr: anywhere with
+// -api-token set, and on loopback only without it, so that nobody who can
+// reach the port gets a scanner for the asking.
+func apiAllowed(addr string) bool {
+	if apiToken != "" {
+		return true
+	}
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip, err := netip.ParseAddr(host)
+	return err == nil && ip.IsLoopback()
+}
+
+func (s *jobServer) register(mux *http.ServeMux) {
+	mux.HandleFunc("POST /scans", s.authorized(s.submit))
+	mux.HandleFunc("GET /scans", s.authorized(s.list))
+	mux.HandleFunc("GET /scans/{id}", s.authorized(s.status))
+	mux.HandleFunc("GET /scans/{id}/results", s.authorized(s.results))
+	mux.HandleFunc("DELETE /scans/{id}", s.authorized(s.cancelJob))
+}
+
+func (s *jobServer) authorized(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if apiToken != "" {
+			token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(apiToken)) != 1 {
+				apiError(w, http.StatusUnauthorized, "missing or wrong bearer token")
+				return
+			}
+		}
+		h(w, r)
+	}
+}
+
+func apiError(w http.ResponseWriter, code int, msg string) {
+	writeJSON(w, code, map[string]string{"error": msg})
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// errNoJob is returned for job IDs the server doesn't have, or no longer.
+var errNoJob = errors.New("no such scan")
+
+func (s *jobServer) submit(w http.ResponseWriter, r *http.Request) {
+	var req jobRequest
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		apiError(w, http.StatusBadRequest, "bad request body: "+err.Error())
+		return
+	}
+	j, err := s.create(req)
+	if err != nil {
+		apiError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	w.Header().Set("Location", "/scans/"+j.ID)
+	writeJSON(w, http.StatusAccepted, j)
+}
+
+// create queues a job for req and returns a snapshot of it.
+func (s *jobServer) create(req jobRequest) (job, error) {
+	opts, addresses, err := req.plan()
+	if err != nil {
+		return job{}, err
+	}
+	id := make([]byte, 8)
+	_, _ = rand.Read(id)
+	ctx, cancel := context.WithCancel(s.ctx)
+	j := &job{
+		ID:        hex.EncodeToString(id),
+		Status:    "queued",
+		Request:   req,
+		Created:   time.Now().UTC(),
+		Probes:    addresses.len(),
+		Summary:   summary{Type: "summary"},
+		addresses: addresses,
+		cancel:    cancel,
+		update:    make(chan struct{}),
+	}
+	s.mu.Lock()
+	s.jobs[j.ID] = j
+	s.order = append(s.order, j.ID)
+	s.forget()
+	snapshot := j.snapshot()
+	s.mu.Unlock()
+	go s.run(ctx, j, opts)
+	return snapshot, nil
+}
+
+// plan validates the request and works out what to scan and how.
+func (req jobRequest) plan() (portscan.Options, addressList, error) {
+	opts := scanOptions()
+	opts.OnAttempt = nil
+	if len(req.Targets) == 0 {
+		return opts, addressList{}, errors.New("targets is required")
+	}
+	hosts, err := expandTargets(strings.Join(req.Targets, ","))
+	if err == nil {
+		hosts, err = excludeTargets(hosts)
+	}
+	if err != nil {
+		return opts, addressList{}, err
+	}
+	proto := "tcp"
+	switch {
+	case req.UDP:
+		proto = "udp"
+	case opts.SCTP:
+		proto = "sctp"
+	}
+	ports, err := portsToScan(req.Ports, req.TopPorts, proto)
+	if err != nil {
+		return opts, addressList{}, err
+	}
+	if len(hosts)*len(ports) > maxJobProbes {
+		return opts, addressList{}, fmt.Errorf("%d hosts × %d ports is more than the %d probes a job may have", len(hosts), len(ports), maxJobProbes)
+	}
+	if req.Timeout != "" {
+		if opts.Timeout, err = time.ParseDuration(req.Timeout); err != nil || opts.Timeout <= 0 {
+			return opts, addressList{}, fmt.Errorf("bad timeout %q", req.Timeout)
+		}
+	}
+	if req.Retries != nil {
+		opts.Retries = *req.Retries
+	}
+	opts.Timeout = min(opts.Timeout, maxJobTimeout)
+	opts.Retries = min(max(opts.Retries, 0), maxJobRetries)
+	opts.UDP = opts.UDP || req.UDP
+	opts.SYN = opts.SYN && !opts.UDP
+	opts.SCTP = opts.SCTP && !opts.UDP
+	opts.Banners = opts.Banners || req.Banner
+	opts.DetectVersions = opts.DetectVersions || req.VersionDetection
+	opts.TLSInfo = opts.TLSInfo || req.TLSInfo
+	opts.HTTPProbe = opts.HTTPProbe || req.HTTPProbe
+	addresses := interleave(hosts, ports)
+	opts.Workers = max(min(opts.Workers, addresses.len()), 1)
+	return opts, addresses, nil
+}
+
+// forget drops the oldest finished jobs beyond maxFinishedJobs. Called with
+// s.mu held.
+func (s *jobServer) forget() {
+	finished := 0
+	for i := len(s.order) - 1; i >= 0; i-- {
+		j := s.jobs[s.order[i]]
+		if j.Finished == nil {
+			continue
+		}
+		if finished++; finished > maxFinishedJobs {
+			delete(s.jobs, j.ID)
+			s.order = slices.Delete(s.order, i, i+1)
+		}
+	}
+}
+
+func (s *jobServer) run(ctx context.Context, j *job, opts portscan.Options) {
+	defer j.cancel()
+	select {
+	case s.slot <- struct{}{}:
+		defer func() { <-s.slot }()
+	case <-ctx.Done():
+		s.finish(j, "cancelled", nil)
+		return
+	}
+	start := time.Now().UTC()
+	s.mu.Lock()
+	j.Status, j.Started = "running", &start
+	s.mu.Unlock()
+
+	sc, err := portscan.New(opts)
+	if err != nil {
+		s.finish(j, "failed", err)
+		return
+	}
+	defer sc.Close()
+	for r := range sc.ScanSeq(ctx, j.addresses.all()) {
+		s.mu.Lock()
+		j.results = append(j.results, r)
+		j.Summary.count(r)
+		close(j.update)
+		j.update = make(chan struct{})
+		s.mu.Unlock()
+	}
+	status := "done"
+	if ctx.Err() != nil {
+		status = "cancelled"
+	}
+	s.finish(j, status, nil)
+}
+
+func (s *jobServer) finish(j *job, status string, err error) {
+	now := time.Now().UTC()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	j.Status, j.Finished = status, &now
+	if err != nil {
+		j.Error = err.Error()
+	}
+	if j.Started != nil {
+		j.Summary.finish(now.Sub(*j.Started))
+	}
+	j.Summary.Interrupted = status == "cancelled"
+	close(j.update)
+	j.update = make(chan struct{})
+	s.forget()
+}
+
+// snapshot is a copy of j to serve once s.mu is released, with nothing
+// shared that run goes on writing. Call it with s.mu held.
+func (j *job) snapshot() job {
+	c := *j
+	c.Summary.Failures = maps.Clone(j.Summary.Failures)
+	c.Summary.seen = nil
+	return c
+}
+
+// get returns a snapshot of job id.
+func (s *jobServer) get(id string) (job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if j := s.jobs[id]; j != nil {
+		return j.snapshot(), nil
+	}
+	return job{}, errNoJob
+}
+
+// all returns snapshots of every job, oldest first.
+func (s *jobServer) all() []job {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	jobs := make([]job, 0, len(s.order))
+	for _, id := range s.order {
+		jobs = append(jobs, s.jobs[id].snapshot())
+	}
+	return jobs
+}
+
+// stop cancels job id. The job winds down in the background.
+func (s *jobServer) stop(id string) error {
+	s.mu.Lock()
+	j := s.jobs[id]
+	s.mu.Unlock()
+	if j == nil {
+		return errNoJob
+	}
+	j.cancel()
+	return nil
+}
+
+// follow calls fn with every result of job id: those it already has, then
+// each new one as it arrives, until the job ends, fn fails or ctx ends.
+func (s *jobServer) follow(ctx context.Context, id string, fn func(result) error) error {
+	sent := 0
+	for {
+		s.mu.Lock()
+		j := s.jobs[id]
+		if j == nil {
+			s.mu.Unlock()
+			return errNoJob
+		}
+		pending := slices.Clone(j.results[sent:])
+		finished := j.Finished != nil
+		update := j.update
+		s.mu.Unlock()
+		for _, r := range pending {
+			if err := fn(r); err != nil {
+				return err
+			}
+		}
+		sent += len(pending)
+		if finished {
+			return nil
+		}
+		select {
+		case <-update:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (s *jobServer) list(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, s.all())
+}
+
+func (s *jobServer) status(w http.ResponseWriter, r *http.Request) {
+	j, err := s.get(r.PathValue("id"))
+	if err != nil {
+		apiError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, j)
+}
+
+// results serves what the job has found so far, sorted by host and port;
+// the job's status says whether there is more to come.
+func (s *jobServer) results(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	j := s.jobs[r.PathValue("id")]
+	var results []result
+	if j != nil {
+		results = slices.Clone(j.results)
+	}
+	s.mu.Unlock()
+	if j == nil {
+		apiError(w, http.StatusNotFound, errNoJob.Error())
+		return
+	}
+	slices.SortFunc(results, compareResults)
+	if results == nil {
+		results = []result{}
+	}
+	writeJSON(w, http.StatusOK, results)
+}
+
+func (s *jobServer) cancelJob(w http.ResponseWriter, r *http.Request) {
+	if err := s.stop(r.PathValue("id")); err != nil {
+		apiError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// TestJobSnapshotsWhileRunning polls a running job the way the status and
+// list handlers do; under -race a snapshot sharing the live summary's maps
+// shows up as a race with run counting results.
+func TestJobSnapshotsWhileRunning(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	open := ln.Addr().(*net.TCPAddr).Port
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s := newJobServer(ctx)
+	j, err := s.create(jobRequest{Targets: []string{"127.0.0.1"}, Ports: "1-500," + strconv.Itoa(open), Timeout: "1s"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(30 * time.Second)
+	for {
+		snapshot, err := s.get(j.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := json.Marshal(snapshot); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := json.Marshal(s.all()); err != nil {
+			t.Fatal(err)
+		}
+		if snapshot.Finished != nil {
+			if snapshot.Status != "done" || snapshot.Summary.Probed != snapshot.Probes {
+				t.Fatalf("job ended %s after %d of %d probes", snapshot.Status, snapshot.Summary.Probed, snapshot.Probes)
+			}
+			if snapshot.Summary.Open == 0 {
+				t.Fatalf("port %d not found open", open)
+			}
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("job still running after 30s")
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+)
+
+// assertOpen and assertClosed are the ports `portcheck assert` requires to
+// be open and closed.
+var assertOpen, assertClosed string
+
+// violation is a port whose state breaks an assertion, or for verify, has
+// drifted from the manifest.
+type violation struct {
+	Type   string `json:"type"`
+	Host   string `json:"host"`
+	Port   int    `json:"port"`
+	Proto  string `json:"proto"`
+	Want   string `json:"want"`
+	Got    string `json:"got"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// portRules maps ports to the state they must be in, "open" or "closed".
+type portRules map[int]string
+
+// assertFormatter replaces the normal output in assert and verify mode: it
+// prints only the ports in the wrong state. A port meets "closed" if it's
+// closed or filtered, unreachable either way, and "open" only if it's open,
+// so open|filtered UDP ports and probes that failed meet neither.
+type assertFormatter struct {
+	w      io.Writer
+	asJSON bool
+	// kind is the JSON type of what's printed, violation or drift
+	kind string
+	// rules are per host; "" holds the ones for every host
+	rules      map[string]portRules
+	checks     int
+	violations int
+}
+
+func newAssertFormatter(format string, w io.Writer) (*assertFormatter, error) {
+	if format != "text" && format != "json" {
+		return nil, fmt.Errorf("%s supports text and json output, not %q", subcommand.name, format)
+	}
+	f := &assertFormatter{w: w, asJSON: format == "json", kind: "violation", rules: manifestRules}
+	if subcommand.name == "verify" {
+		f.kind = "drift"
+		return f, nil
+	}
+	if assertOpen == "" && assertClosed == "" {
+		return nil, fmt.Errorf("assert needs -open or -closed ports")
+	}
+	rules, err := parseRules(assertOpen, assertClosed)
+	if err != nil {
+		return nil, err
+	}
+	f.rules = map[string]portRules{"": rules}
+	return f, nil
+}
+
+// parseRules reads the port lists that must be open and closed.
+func parseRules(open, closed string) (portRules, error) {
+	rules := portRules{}
+	for _, rule := range []struct{ spec, state string }{{open, "open"}, {closed, "closed"}} {
+		if rule.spec == "" {
+			continue
+		}
+		ports, err := parsePorts(rule.spec, scanProto())
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", rule.state, err)
+		}
+		for _, port := range ports {
+			n, _ := strconv.Atoi(port)
+			if rules[n] != "" && rules[n] != rule.state {
+				return nil, fmt.Errorf("port %d can't be both open and closed", n)
+			}
+			rules[n] = rule.state
+		}
+	}
+	return rules, nil
+}
+
+// assertPortSpec is the ports assert scans: every one it has a rule for.
+func assertPortSpec() string {
+	rules, err := parseRules(assertOpen, assertClosed)
+	if err != nil {
+		fatal(err)
+	}
+	return rules.spec()
+}
+
+// spec lists the ports of the rules as a port list.
+func (r portRules) spec() string {
+	ports := []int{}
+	for port := range r {
+		ports = append(ports, port)
+	}
+	slices.Sort(ports)
+	return compressPorts(ports)
+}
+
+func (f *assertFormatter) result(r result) {
+	want := f.rules[r.Host][r.Port]
+	if want == "" {
+		want = f.rules[""][r.Port]
+	}
+	f.checks++
+	switch {
+	case want == "open" && r.State == "open":
+		return
+	case want == "closed" && (r.State == "closed" || r.State == "filtered"):
+		return
+	}
+	f.violations++
+	if f.asJSON {
+		_ = json.NewEncoder(f.w).Encode(violation{Type: f.kind, Host: r.Host, Port: r.Port, Proto: r.Proto, Want: want, Got: r.State, Reason: r.Reason})
+		return
+	}
+	got := r.State
+	if r.Reason != "" {
+		got += " (" + r.Reason + ")"
+	}
+	_, _ = fmt.Fprintf(f.w, "%s: want %s, got %s\n", portKey{r.Host, r.Port, r.Proto}, want, got)
+}
+
+func (f *assertFormatter) finish(summary) error {
+	return nil
+}
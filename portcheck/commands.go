@@ -0,0 +1,366 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gishyanart/helper-scripts/portcheck/portscan"
+)
+
+// command is one portcheck subcommand. Every command scans, so all of them
+// take the probe flags; flags registers the ones particular to it.
+type command struct {
+	name    string
+	args    string
+	summary string
+	flags   func(fs *flag.FlagSet)
+}
+
+var commands = []*command{
+	{"scan", "<host> [ports]", "Scan the ports once and print the results.", scanFlags},
+	{"diff", "<previous.json> <host> [ports]", "Scan and print only the ports whose state changed since a saved -json scan.", diffFlags},
+	{"monitor", "<host> [ports]", "Rescan every -interval and report ports that come up or go down.", monitorFlags},
+	{"daemon", "-config jobs.yaml", "Run the jobs of a config file on their cron schedules, reporting what changed.", daemonFlags},
+	{"assert", "<host> -open ports -closed ports", "Scan the ports of -open and -closed and print only those in the wrong state.", assertFlags},
+	{"verify", "<manifest.yaml>", "Scan the hosts of a manifest and print the ports that drifted from the state it declares.", verifyFlags},
+	{"lan", "[ports]", "ARP-scan the local subnets and list the live hosts with their MAC vendors, then scan any ports given on them.", lanFlags},
+	{"serve", "[<host> [ports]]", "Run the scan API, and rescan any targets given every -interval for Prometheus.", serveFlags},
+}
+
+// subcommand is the command being run; scan when none is named.
+var subcommand = commands[0]
+
+func lookupCommand(name string) *command {
+	for _, c := range commands {
+		if c.name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+func (c *command) flagSet() *flag.FlagSet {
+	fs := flag.NewFlagSet("portcheck "+c.name, flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: portcheck %s [flags] %s\n\n%s\n\nFlags:\n", c.name, c.args, c.summary)
+		fs.PrintDefaults()
+	}
+	fs.StringVar(&configPath, "config", "", "read settings from YAML `file`; flags on the command line take precedence")
+	fs.BoolFunc("version", "print the version, commit and build date, then exit", printVersion)
+	probeFlags(fs)
+	c.flags(fs)
+	return fs
+}
+
+// usage lists the commands, for `portcheck help` and a bare `portcheck`.
+func usage(w io.Writer) {
+	fmt.Fprintf(w, "usage: portcheck <command> [flags] <host> [ports]\n\nCommands:\n")
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %-11s %s\n", c.name, c.summary)
+	}
+	fmt.Fprintf(w, "  %-11s %s\n", "help", "Show the commands, or the flags of one.")
+	fmt.Fprintf(w, "  %-11s %s\n", "completion", "Print a bash, zsh or fish completion script.")
+	fmt.Fprintf(w, "  %-11s %s\n", "self-update", "Replace this binary with the latest release.")
+	fmt.Fprintf(w, "\nThe command may be left out for a plain scan: portcheck [flags] <host> [ports].\n")
+	fmt.Fprintf(w, "Run 'portcheck help <command>' for its flags.\n")
+}
+
+// probeFlags are shared by every command: what to scan and how.
+func probeFlags(fs *flag.FlagSet) {
+	fs.DurationVar(&timeout, "timeout", timeout, "connection timeout per port (e.g. 500ms, 5s)")
+	fs.BoolVar(&adaptiveTimeout, "adaptive-timeout", false, "shorten -timeout for each host to what its measured round-trip time calls for")
+	fs.DurationVar(&maxRuntime, "max-runtime", 0, "stop after this long, cancelling probes in flight (0 = no limit)")
+	fs.IntVar(&workers, "workers", workers, "number of concurrent connection attempts")
+	fs.IntVar(&hostParallelism, "host-parallelism", 0, "at most `n` probes at a time against any one host (0 = an even share of -workers)")
+	fs.StringVar(&engine, "engine", "", "run TCP connect probes on this `engine`: epoll drives them all from one epoll instance instead of a goroutine each, for very high -workers (Linux)")
+	fs.BoolVar(&adaptiveWorkers, "adaptive-workers", false, "start with fewer concurrent probes and grow or shrink them with the error rate, up to -workers")
+	fs.BoolVar(&udpScan, "udp", false, "scan UDP ports instead of TCP")
+	fs.BoolVar(&synScan, "syn", false, "half-open SYN scan over a raw socket (Linux, needs root or CAP_NET_RAW)")
+	fs.BoolVar(&sctpScan, "sctp", false, "scan SCTP ports with INIT chunks over a raw socket, for Diameter, SIGTRAN and other telecom services (Linux, IPv4, needs root or CAP_NET_RAW)")
+	fs.BoolVar(&dualStack, "dual-stack", false, "race IPv6 and IPv4 for each port of names with both A and AAAA records and report how each family answered")
+	fs.BoolVar(&allAddresses, "all-addresses", false, "scan every address a hostname resolves to instead of the one the dialer picks")
+	fs.BoolVar(&discoverFirst, "discover", false, "ping each host first (ICMP echo and TCP to -discover-ports) and scan only the ones that answer")
+	fs.Func("discover-ports", "TCP `ports` that host discovery knocks on (default 80,443)", func(v string) error {
+		ports, err := parsePorts(v, "tcp")
+		if err != nil {
+			return err
+		}
+		discoverPorts = nil
+		for _, port := range ports {
+			n, _ := strconv.Atoi(port)
+			discoverPorts = append(discoverPorts, n)
+		}
+		return nil
+	})
+	fs.StringVar(&inputList, "iL", "", "read hosts/CIDRs from `file`, one per line (- for stdin)")
+	fs.StringVar(&hostnameList, "hostnames", "", "read hostnames from `file`, e.g. subdomain enumeration output, and scan every address they resolve to once, labelled with each name (- for stdin; implies -all-addresses)")
+	fs.BoolFunc("4", "use IPv4 only", func(string) error {
+		ipFamily = "4"
+		return nil
+	})
+	fs.BoolFunc("6", "use IPv6 only", func(string) error {
+		ipFamily = "6"
+		return nil
+	})
+	fs.Func("resolver", "resolve host names with the nameserver at `address` (ip[:port]) instead of the system's", func(v string) error {
+		var err error
+		resolver, err = newResolver(v)
+		return err
+	})
+	fs.StringVar(&sourceIP, "source-ip", "", "send probes from this local `address`")
+	fs.Func("source-port", "send probes from this local `port` or range of ports, e.g. 53 or 40000-40100 (Linux)", func(v string) error {
+		lo, hi, isRange := strings.Cut(v, "-")
+		var err error
+		if sourcePorts[0], err = strconv.Atoi(lo); err != nil || sourcePorts[0] < 1 || sourcePorts[0] > portRangeEnd {
+			return fmt.Errorf("bad port %q", lo)
+		}
+		sourcePorts[1] = 0
+		if isRange {
+			if sourcePorts[1], err = strconv.Atoi(hi); err != nil || sourcePorts[1] < sourcePorts[0] || sourcePorts[1] > portRangeEnd {
+				return fmt.Errorf("bad range %q", v)
+			}
+		}
+		return nil
+	})
+	fs.BoolVar(&icmpReasons, "icmp-reasons", false, "read ICMP unreachables to tell firewalled ports from missing routes and closed UDP ports (needs root or CAP_NET_RAW)")
+	fs.StringVar(&netInterface, "interface", "", "send probes out of this network `interface` only (Linux, needs root or CAP_NET_RAW)")
+	fs.StringVar(&proxyURL, "proxy", "", "connect through a proxy: socks5://, http:// or https://[user:password@]host[:port] (TCP connect scans only)")
+	fs.BoolVar(&grabBanners, "banner", false, "read and print what open ports send after connecting")
+	fs.IntVar(&bannerBytes, "banner-bytes", bannerBytes, "maximum banner size in bytes")
+	fs.BoolVar(&reverseDNS, "rdns", false, "look up the PTR name of every scanned IP and include it in the output")
+	fs.BoolVar(&noNames, "no-names", false, "don't annotate ports with service names")
+	fs.BoolVar(&detectVersions, "sV", false, "probe open TCP ports to identify the service and version")
+	fs.Func("service-probes", "identify services with the probes and patterns of an nmap-service-probes `file` (implies -sV)", func(v string) error {
+		var err error
+		serviceProbes, err = portscan.LoadServiceProbes(v)
+		return err
+	})
+	fs.BoolVar(&loginChecks, "login-checks", false, "with -sV, log in to MySQL as root and PostgreSQL as postgres with no password to learn if they want credentials; these are real login attempts that show up as failed logins and may trip intrusion detection or lockouts")
+	fs.BoolVar(&tlsInspect, "tls-info", false, "report TLS certificate details for open ports that speak TLS")
+	fs.BoolVar(&sshInfo, "ssh-info", false, "report the version and offered key exchange, host key, cipher and MAC algorithms of SSH servers on any open port, flagging weak ones")
+	fs.BoolVar(&tlsAudit, "tls-audit", false, "list the TLS versions and cipher suites open ports accept and flag SSLv3, TLS 1.0/1.1 and weak suites")
+	fs.BoolVar(&verifyOpen, "verify-open", false, "only report a TCP port open if it sends data or answers TLS or HTTP, not just for accepting the connection")
+	fs.BoolVar(&httpProbe, "http-probe", false, "request / from open ports and report status, server and page title")
+	fs.IntVar(&retries, "retries", 0, "extra attempts for ports that gave no answer")
+	fs.Float64Var(&rate, "rate", 0, "maximum probes per second across all workers (0 = unlimited)")
+	fs.DurationVar(&probeDelay, "delay", 0, "wait this long between probe launches across all workers, e.g. 50ms")
+	fs.DurationVar(&probeJitter, "jitter", 0, "vary each -delay by up to this much either way at random, e.g. 20ms")
+	fs.StringVar(&timingName, "T", "", "timing `template` setting -timeout, -retries, -workers and -rate together, from 0 (slowest) to 5 (fastest) or by name: "+strings.Join(timingNames(), ", ")+"; -T4 works as in nmap")
+	fs.StringVar(&profileName, "profile", "", "scan the ports of a built-in `profile` with settings to suit: "+strings.Join(profileNames(), ", "))
+	fs.StringVar(&portsFile, "ports-file", "", "read ports from `file`, one port, range or service name per line (- for stdin)")
+	fs.IntVar(&topPortsN, "top-ports", 0, "scan the `n` most common ports (100 or 1000) instead of all of them")
+	fs.StringVar(&excludePorts, "exclude-ports", "", "ports or ranges to leave out, e.g. 22,5900,8000-9000")
+	fs.StringVar(&excludeHosts, "exclude-hosts", "", "comma-separated hosts to skip")
+	fs.StringVar(&excludeCIDRs, "exclude-cidr", "", "comma-separated CIDRs whose addresses are skipped")
+	fs.BoolVar(&randomize, "randomize", false, "probe host:port pairs in random order")
+	fs.Func("seed", "shuffle seed for -randomize, to repeat an order (implies -randomize)", func(v string) error {
+		n, err := strconv.ParseUint(v, 10, 64)
+		seed, seedSet, randomize = n, true, true
+		return err
+	})
+	fs.BoolFunc("v", "verbose: log resolution, retries and probe errors to stderr (repeat or use -vv for every attempt)", func(string) error {
+		verbosity++
+		return nil
+	})
+	fs.BoolFunc("vv", "very verbose: also log every probe attempt", func(string) error {
+		verbosity = 2
+		return nil
+	})
+	fs.Func("log-format", "write logs to stderr as `format`: text, or json for log aggregators", logFormatFlag)
+}
+
+// formatFlags registers -format and its -json shorthand with the formats the
+// command supports.
+func formatFlags(fs *flag.FlagSet, names []string) {
+	fs.StringVar(&outputFormat, "format", outputFormat, "output format: "+strings.Join(names, ", "))
+	fs.BoolFunc("json", "shorthand for -format json", func(string) error {
+		outputFormat = "json"
+		return nil
+	})
+}
+
+func outputFileFlags(fs *flag.FlagSet) {
+	fs.StringVar(&outputPath, "o", "", "write results to `file` instead of stdout, replacing it once the scan completes")
+	fs.BoolVar(&appendOutput, "append", false, "with -o, add to the end of the file instead of replacing it")
+	fs.BoolVar(&compressOutput, "compress", false, "gzip the -o file (the default for names ending in .gz)")
+	fs.BoolVar(&noProgress, "no-progress", false, "don't draw the progress line on stderr")
+}
+
+func notifyFlag(fs *flag.FlagSet, what string) {
+	fs.Func("notify", "send "+what+" to a chat `url`: slack://hooks.slack.com/... or discord://discord.com/api/webhooks/... (repeatable)", func(spec string) error {
+		n, err := parseNotify(spec)
+		if err != nil {
+			return err
+		}
+		alerts = append(alerts, n)
+		return nil
+	})
+}
+
+func scanFlags(fs *flag.FlagSet) {
+	formatFlags(fs, formatNames())
+	fs.BoolFunc("q", "print only host:port of open ports (shorthand for -format quiet -no-progress)", func(string) error {
+		outputFormat, noProgress = "quiet", true
+		return nil
+	})
+	outputFileFlags(fs)
+	fs.Func("template", "with -format template, print each result through Go text/template `text`, e.g. '{{.Host}} {{.Port}} {{.State}}'", func(v string) error {
+		var err error
+		resultTemplate, err = parseResultTemplate(v)
+		return err
+	})
+	fs.BoolVar(&sortResults, "sort", false, "hold results until the scan completes and print them sorted by host and port")
+	fs.BoolVar(&latencyReport, "latency", false, "report the p50, p90 and p99 connect latency of each host at the end of the scan")
+	fs.BoolVar(&whoisLookup, "whois", false, "at the end of the scan, look up the registered netblock, name, organization and country of each host with open ports")
+	fs.Func("whois-server", "with -whois, ask the WHOIS server at `address` (host[:port]) instead of starting at IANA's, e.g. an internal registry that knows private ranges too", func(v string) error {
+		whoisServer, whoisLookup = v, true
+		return nil
+	})
+	fs.Func("geoip", "add the ASN, AS name and country of each address from `source`, a MaxMind DB file (GeoLite2, DB-IP, IPinfo) or cymru for Team Cymru's DNS service, and count hosts per AS; repeat to combine sources", geoipFlag)
+	fs.BoolVar(&showAll, "show-all", false, "also print closed and filtered ports with the reason")
+	fs.BoolVar(&showErrors, "show-errors", false, "print every probe that didn't find an open port with its failure category and error, and a count per category")
+	fs.BoolVar(&noColor, "no-color", false, "don't color text output (also set by the NO_COLOR environment variable)")
+	fs.StringVar(&resumePath, "resume", "", "record finished probes in state `file` and skip the ones it already has")
+	fs.StringVar(&dbPath, "db", "", "record the scan in SQLite database `file`, created if missing")
+	fs.StringVar(&syslogSpec, "syslog", "", "also send results to syslog: local, udp://host[:port] or tcp://host[:port]")
+	notifyFlag(fs, "the open ports")
+}
+
+func diffFlags(fs *flag.FlagSet) {
+	formatFlags(fs, textOrJSON)
+	outputFileFlags(fs)
+}
+
+func monitorFlags(fs *flag.FlagSet) {
+	formatFlags(fs, textOrJSON)
+	fs.DurationVar(&watchEvery, "interval", time.Minute, "time between scans")
+	fs.StringVar(&webhookURL, "webhook", "", "POST each change as JSON to `url`")
+	fs.StringVar(&syslogSpec, "syslog", "", "also send changes to syslog: local, udp://host[:port] or tcp://host[:port]")
+	notifyFlag(fs, "each change")
+}
+
+func daemonFlags(fs *flag.FlagSet) {
+	formatFlags(fs, textOrJSON)
+	fs.StringVar(&dbPath, "db", "", "record every run in SQLite database `file`, created if missing")
+	fs.StringVar(&syslogSpec, "syslog", "", "also send changes to syslog: local, udp://host[:port] or tcp://host[:port]")
+}
+
+func assertFlags(fs *flag.FlagSet) {
+	formatFlags(fs, textOrJSON)
+	outputFileFlags(fs)
+	fs.StringVar(&assertOpen, "open", "", "`ports` that must be open, e.g. 443,8443")
+	fs.StringVar(&assertClosed, "closed", "", "`ports` that must be closed or filtered, e.g. 22,3306")
+}
+
+func verifyFlags(fs *flag.FlagSet) {
+	formatFlags(fs, textOrJSON)
+	outputFileFlags(fs)
+}
+
+func lanFlags(fs *flag.FlagSet) {
+	scanFlags(fs)
+	fs.Func("subnet", "ARP-scan this IPv4 `cidr` instead of the subnets of the interfaces; it must be on one of them", subnetFlag)
+	fs.Func("oui", "read MAC vendor names from `file`, the IEEE's oui.txt or oui.csv or Wireshark's manuf, on top of the built-in list", loadOUI)
+}
+
+func serveFlags(fs *flag.FlagSet) {
+	fs.StringVar(&listenAddr, "listen", listenAddr, "`address` to expose /metrics on")
+	fs.DurationVar(&serveInterval, "interval", serveInterval, "time between scans of the targets given")
+	fs.StringVar(&apiToken, "api-token", "", "require this bearer `token` on scan API requests; without it the API is served on loopback only")
+	fs.StringVar(&grpcListen, "grpc-listen", "", "also serve the scan API over gRPC on `address`")
+}
+
+// parseCommand picks the command named by the first argument, or scan, and
+// parses its flags. For diff the baseline must come first, before or after
+// the flags.
+func parseCommand(argv []string) []string {
+	if len(argv) == 0 && !slices.ContainsFunc(os.Environ(), func(kv string) bool { return strings.HasPrefix(kv, envPrefix) }) {
+		usage(os.Stderr)
+		os.Exit(exitError)
+	}
+	switch {
+	case len(argv) == 0:
+	case argv[0] == "help" || argv[0] == "-h" || argv[0] == "-help" || argv[0] == "--help":
+		if len(argv) > 1 {
+			if c := lookupCommand(argv[1]); c != nil {
+				fs := c.flagSet()
+				fs.SetOutput(os.Stdout)
+				fs.Usage()
+				os.Exit(exitOpen)
+			}
+		}
+		usage(os.Stdout)
+		os.Exit(exitOpen)
+	case argv[0] == "version" || argv[0] == "--version":
+		_ = printVersion("")
+	case argv[0] == "self-update":
+		runSelfUpdate(argv[1:])
+	case argv[0] == "completion":
+		if len(argv) != 2 {
+			fatal("usage: portcheck completion bash|zsh|fish")
+		}
+		if err := writeCompletion(os.Stdout, argv[1]); err != nil {
+			fatal(err)
+		}
+		os.Exit(exitOpen)
+	case lookupCommand(argv[0]) != nil:
+		subcommand, argv = lookupCommand(argv[0]), argv[1:]
+	}
+	if subcommand.name == "diff" && len(argv) > 0 && !strings.HasPrefix(argv[0], "-") {
+		baselinePath, argv = argv[0], argv[1:]
+	}
+	fs := subcommand.flagSet()
+	_ = fs.Parse(splitTiming(argv))
+	args := fs.Args()
+	if subcommand.name == "assert" {
+		// assert reads like a policy, host first: flags may follow it
+		positional := []string{}
+		for len(args) > 0 {
+			positional = append(positional, args[0])
+			_ = fs.Parse(splitTiming(args[1:]))
+			args = fs.Args()
+		}
+		args = positional
+	}
+	if subcommand.name == "diff" && baselinePath == "" {
+		if len(args) == 0 {
+			fs.Usage()
+			os.Exit(exitError)
+		}
+		baselinePath, args = args[0], args[1:]
+	}
+	if subcommand.name == "verify" {
+		if len(args) != 1 {
+			fs.Usage()
+			os.Exit(exitError)
+		}
+		manifestPath, args = args[0], nil
+	}
+	args, err := applyEnv(fs, args)
+	if err != nil {
+		fatal(err)
+	}
+	if configPath != "" {
+		if args, err = applyConfig(fs, configPath, args); err != nil {
+			fatal(err)
+		}
+	}
+	// before the profile, whose timing is only a default
+	if timingName != "" {
+		if err := applyTiming(fs); err != nil {
+			fatal(err)
+		}
+	}
+	if profileName != "" {
+		if err := applyProfile(fs); err != nil {
+			fatal(err)
+		}
+	}
+	return args
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// textOrJSON is the -format choice of the commands that print changes.
+var textOrJSON = []string{"text", "json"}
+
+// completionFlag is what a shell needs to know about one flag.
+type completionFlag struct {
+	name       string
+	usage      string
+	takesValue bool
+	files      bool
+	values     []string
+	repeatable bool
+}
+
+// completionFlags describes the flags of c. Flags whose value is a `file`
+// complete file names; -format, -top-ports and the sink flags offer their
+// choices.
+func completionFlags(c *command) []completionFlag {
+	flags := []completionFlag{}
+	c.flagSet().VisitAll(func(f *flag.Flag) {
+		valueName, usage := flag.UnquoteUsage(f)
+		cf := completionFlag{
+			name:       f.Name,
+			usage:      usage,
+			takesValue: valueName != "",
+			files:      valueName == "file",
+			repeatable: strings.Contains(usage, "repeat"),
+		}
+		switch f.Name {
+		case "format":
+			cf.values = textOrJSON
+			if c.name == "scan" {
+				cf.values = formatNames()
+			}
+		case "top-ports":
+			for size := range topPortSets["tcp"] {
+				cf.values = append(cf.values, strconv.Itoa(size))
+			}
+			slices.Sort(cf.values)
+		case "profile":
+			cf.values = profileNames()
+		case "log-format":
+			cf.values = logFormats
+		case "T":
+			cf.values = append([]string{"0", "1", "2", "3", "4", "5"}, timingNames()...)
+		case "syslog":
+			cf.values = []string{"local", "udp://", "tcp://"}
+		case "notify":
+			cf.values = []string{"slack://", "discord://"}
+		}
+		flags = append(flags, cf)
+	})
+	return flags
+}
+
+func commandNames() string {
+	names := []string{}
+	for _, c := range commands {
+		names = append(names, c.name)
+	}
+	return strings.Join(names, " ")
+}
+
+// writeCompletion prints the completion script for shell.
+func writeCompletion(w io.Writer, shell string) error {
+	switch shell {
+	case "bash":
+		bashCompletion(w)
+	case "zsh":
+		zshCompletion(w)
+	case "fish":
+		fishCompletion(w)
+	default:
+		return fmt.Errorf("completion supports bash, zsh and fish, not %q", shell)
+	}
+	return nil
+}
+
+func bashCompletion(w io.Writer) {
+	fmt.Fprintf(w, `# bash completion for portcheck; load with: source <(portcheck completion bash)
+_portcheck() {
+    local cur prev cmd=scan
+    cur="${COMP_WORDS[COMP_CWORD]}"
+    prev="${COMP_WORDS[COMP_CWORD-1]}"
+    case "${COMP_WORDS[1]}" in
+        %s) cmd="${COMP_WORDS[1]}" ;;
+    esac
+    if [[ $COMP_CWORD -eq 1 && $cur != -* ]]; then
+        COMPREPLY=($(compgen -W "%s help completion self-update" -- "$cur"))
+        return
+    fi
+    case "${COMP_WORDS[1]}" in
+        completion) COMPREPLY=($(compgen -W "bash zsh fish" -- "$cur")); return ;;
+        help) COMPREPLY=($(compgen -W "%s" -- "$cur")); return ;;
+    esac
+    case "$cmd $prev" in
+`, strings.ReplaceAll(commandNames(), " ", "|"), commandNames(), commandNames())
+	for _, c := range commands {
+		for _, f := range completionFlags(c) {
+			switch {
+			case f.files:
+				fmt.Fprintf(w, "        \"%s -%s\") COMPREPLY=($(compgen -f -- \"$cur\")); return ;;\n", c.name, f.name)
+			case len(f.values) > 0:
+				fmt.Fprintf(w, "        \"%s -%s\") COMPREPLY=($(compgen -W \"%s\" -- \"$cur\")); return ;;\n", c.name, f.name, strings.Join(f.values, " "))
+			case f.takesValue:
+				fmt.Fprintf(w, "        \"%s -%s\") return ;;\n", c.name, f.name)
+			}
+		}
+	}
+	fmt.Fprintf(w, "    esac\n    if [[ $cur == -* ]]; then\n        case $cmd in\n")
+	for _, c := range commands {
+		names := []string{}
+		for _, f := range completionFlags(c) {
+			names = append(names, "-"+f.name)
+		}
+		fmt.Fprintf(w, "            %s) COMPREPLY=($(compgen -W \"%s\" -- \"$cur\")) ;;\n", c.name, strings.Join(names, " "))
+	}
+	fmt.Fprintf(w, `        esac
+        return
+    fi
+    COMPREPLY=($(compgen -A hostname -- "$cur"))
+}
+complete -o default -F _portcheck portcheck
+`)
+}
+
+// zshQuote makes s safe inside a single-quoted _arguments spec.
+func zshQuote(s string) string {
+	return strings.NewReplacer(`'`, `'\''`, `[`, `\[`, `]`, `\]`, `:`, `\:`).Replace(s)
+}
+
+func zshCompletion(w io.Writer) {
+	fmt.Fprintf(w, "#compdef portcheck\n# zsh completion for portcheck; save as _portcheck somewhere in $fpath\n\n_portcheck() {\n    local -a commands=(\n")
+	for _, c := range commands {
+		fmt.Fprintf(w, "        '%s:%s'\n", c.name, zshQuote(c.summary))
+	}
+	fmt.Fprintf(w, `        'help:Show the commands, or the flags of one'
+        'completion:Print a shell completion script'
+    )
+    local cmd=scan
+    if (( CURRENT == 2 )) && [[ $PREFIX != -* ]]; then
+        _describe command commands
+        _hosts
+        return
+    fi
+    case ${words[2]} in
+        %s)
+            cmd=${words[2]}
+            shift words
+            (( CURRENT-- ))
+            ;;
+        completion)
+            _values shell bash zsh fish
+            return
+            ;;
+        help)
+            _values command %s
+            return
+            ;;
+    esac
+    case $cmd in
+`, strings.ReplaceAll(commandNames(), " ", "|"), commandNames())
+	for _, c := range commands {
+		fmt.Fprintf(w, "        %s)\n            _arguments -S \\\n", c.name)
+		for _, f := range completionFlags(c) {
+			spec := "-" + f.name + "[" + zshQuote(f.usage) + "]"
+			if f.repeatable {
+				spec = "*" + spec
+			}
+			switch {
+			case f.files:
+				spec += ":file:_files"
+			case len(f.values) > 0:
+				spec += ":" + f.name + ":(" + strings.Join(f.values, " ") + ")"
+			case f.takesValue:
+				spec += ":" + f.name + ":"
+			}
+			fmt.Fprintf(w, "                '%s' \\\n", spec)
+		}
+		if c.name == "diff" {
+			fmt.Fprintf(w, "                '1:previous scan:_files' \\\n                '2:host:_hosts' \\\n                '3:ports:'\n            ;;\n")
+		} else {
+			fmt.Fprintf(w, "                '1:host:_hosts' \\\n                '2:ports:'\n            ;;\n")
+		}
+	}
+	fmt.Fprintf(w, "    esac\n}\n\n_portcheck \"$@\"\n")
+}
+
+// fishQuote makes s safe inside a single-quoted fish string.
+func fishQuote(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s)
+}
+
+func fishCompletion(w io.Writer) {
+	fmt.Fprintf(w, "# fish completion for portcheck; load with: portcheck completion fish | source\ncomplete -c portcheck -f\n")
+	subcommands := commandNames() + " help completion self-update"
+	for _, c := range commands {
+		fmt.Fprintf(w, "complete -c portcheck -n 'not __fish_seen_subcommand_from %s' -a %s -d '%s'\n", subcommands, c.name, fishQuote(c.summary))
+	}
+	fmt.Fprintf(w, "complete -c portcheck -n 'not __fish_seen_subcommand_from %s' -a help -d 'Show the commands, or the flags of one'\n", subcommands)
+	fmt.Fprintf(w, "complete -c portcheck -n 'not __fish_seen_subcommand_from %s' -a completion -d 'Print a shell completion script'\n", subcommands)
+	fmt.Fprintf(w, "complete -c portcheck -n '__fish_seen_subcommand_from completion' -a 'bash zsh fish'\n")
+	for _, c := range commands {
+		cond := "__fish_seen_subcommand_from " + c.name
+		if c.name == "scan" {
+			// scan is also what runs when no command is named
+			cond = "not __fish_seen_subcommand_from " + strings.TrimPrefix(subcommands, "scan ")
+		}
+		for _, f := range completionFlags(c) {
+			line := fmt.Sprintf("complete -c portcheck -n '%s' -o %s -d '%s'", cond, f.name, fishQuote(f.usage))
+			switch {
+			case f.files:
+				line += " -r -F"
+			case len(f.values) > 0:
+				line += " -x -a '" + strings.Join(f.values, " ") + "'"
+			case f.takesValue:
+				line += " -x"
+			}
+			fmt.Fprintln(w, line)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// configPath is the -config file.
+var configPath string
+
+// applyConfig reads a YAML config whose keys are the command's flag names
+// without the dash, plus targets and ports for the positional arguments, and
+// sets every flag that wasn't given on the command line. Lists set
+// repeatable flags once per entry. args are the positional arguments from the
+// command line; a host or port list given there wins over the config's.
+func applyConfig(fs *flag.FlagSet, path string, args []string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	settings := map[string]any{}
+	if err := yaml.Unmarshal(data, &settings); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	given := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { given[f.Name] = true })
+
+	var targets, ports string
+	names := []string{}
+	for name := range settings {
+		names = append(names, name)
+	}
+	// sorted so that of two contradicting settings the error is stable
+	slices.Sort(names)
+	for _, name := range names {
+		if name == "jobs" && subcommand.name == "daemon" {
+			// read by loadDaemonJobs
+			continue
+		}
+		values, err := settingValues(settings[name])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s: %w", path, name, err)
+		}
+		switch name {
+		case "targets":
+			targets = strings.Join(values, ",")
+			continue
+		case "ports":
+			ports = strings.Join(values, ",")
+			continue
+		}
+		f := fs.Lookup(name)
+		if f == nil {
+			return nil, fmt.Errorf("%s: %s is not a %s setting", path, name, subcommand.name)
+		}
+		if given[name] {
+			continue
+		}
+		for _, v := range values {
+			// all boolean flags default to off, and the shorthand ones
+			// can't be turned back off
+			if b, ok := f.Value.(interface{ IsBoolFlag() bool }); ok && b.IsBoolFlag() && v == "false" {
+				continue
+			}
+			if err := fs.Set(name, v); err != nil {
+				return nil, fmt.Errorf("%s: %s: %w", path, name, err)
+			}
+		}
+	}
+
+	if inputList != "" || hostnameList != "" || subcommand.name == "lan" {
+		if targets != "" {
+			return nil, fmt.Errorf("%s: targets can't be combined with iL, hostnames or lan", path)
+		}
+		if len(args) == 0 && ports != "" {
+			args = []string{ports}
+		}
+		return args, nil
+	}
+	if len(args) == 0 && targets != "" {
+		args = []string{targets}
+	}
+	if len(args) == 1 && ports != "" {
+		args = append(args, ports)
+	}
+	return args, nil
+}
+
+// settingValues turns a scalar or a list of scalars into flag values.
+func settingValues(v any) ([]string, error) {
+	switch v := v.(type) {
+	case nil:
+		return nil, nil
+	case []any:
+		values := []string{}
+		for _, e := range v {
+			switch e.(type) {
+			case []any, map[string]any:
+				return nil, fmt.Errorf("lists may only hold plain values")
+			}
+			values = append(values, fmt.Sprint(e))
+		}
+		return values, nil
+	case map[string]any:
+		return nil, fmt.Errorf("expected a value or a list, not a mapping")
+	default:
+		return []string{fmt.Sprint(v)}, nil
+	}
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// daemonJob is one entry of the jobs list in a daemon config: a scan, when
+// to run it, and where to send the ports that changed since its last run.
+type daemonJob struct {
+	Name       string   `yaml:"name"`
+	Schedule   string   `yaml:"schedule"`
+	Notify     []string `yaml:"notify"`
+	Webhook    string   `yaml:"webhook"`
+	jobRequest `yaml:",inline"`
+
+	when   schedule
+	alerts []*notifier
+}
+
+// loadDaemonJobs reads the jobs list of a daemon config and checks every
+// job, so a typo fails at start rather than at 3 a.m.
+func loadDaemonJobs(path string) ([]*daemonJob, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var doc struct {
+		Jobs yaml.Node `yaml:"jobs"`
+	}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	// decode the jobs again, strictly, so misspelled keys are caught
+	jobsYAML, err := yaml.Marshal(&doc.Jobs)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	var jobs []*daemonJob
+	dec := yaml.NewDecoder(bytes.NewReader(jobsYAML))
+	dec.KnownFields(true)
+	if err := dec.Decode(&jobs); err != nil {
+		return nil, fmt.Errorf("%s: jobs: %w", path, err)
+	}
+	if len(jobs) == 0 {
+		return nil, fmt.Errorf("%s: no jobs", path)
+	}
+	names := map[string]bool{}
+	for i, j := range jobs {
+		if j.Name == "" {
+			return nil, fmt.Errorf("%s: job %d has no name", path, i+1)
+		}
+		if names[j.Name] {
+			return nil, fmt.Errorf("%s: job %s is defined twice", path, j.Name)
+		}
+		names[j.Name] = true
+		if j.when, err = parseSchedule(j.Schedule); err != nil {
+			return nil, fmt.Errorf("%s: job %s: %w", path, j.Name, err)
+		}
+		if _, _, err := j.plan(); err != nil {
+			return nil, fmt.Errorf("%s: job %s: %w", path, j.Name, err)
+		}
+		for _, spec := range j.Notify {
+			n, err := parseNotify(spec)
+			if err != nil {
+				return nil, fmt.Errorf("%s: job %s: %w", path, j.Name, err)
+			}
+			j.alerts = append(j.alerts, n)
+		}
+		if j.Webhook != "" {
+			if err := checkWebhookURL(j.Webhook); err != nil {
+				return nil, fmt.Errorf("%s: job %s: %w", path, j.Name, err)
+			}
+			j.alerts = append(j.alerts, newNotifier("webhook", j.Webhook, webhookPayload))
+		}
+	}
+	return jobs, nil
+}
+
+// runDaemon runs every job of the -config file on its schedule until ctx
+// ends. Jobs run one at a time; one that comes due while another is scanning
+// waits its turn, and a run that is still going when its next time comes
+// skips that time. Each run is recorded in -db, if set, and the ports that
+// came up or went down since the job's previous run are printed and sent to
+// its notify and webhook targets and to -syslog.
+func runDaemon(ctx context.Context) error {
+	jobs, err := loadDaemonJobs(configPath)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		for _, j := range jobs {
+			for _, n := range j.alerts {
+				n.close()
+			}
+		}
+	}()
+	server := newJobServer(ctx)
+	var (
+		turn sync.Mutex
+		// out keeps the changes of jobs finishing together from
+		// interleaving on stdout
+		out sync.Mutex
+		wg  sync.WaitGroup
+	)
+	enc := json.NewEncoder(os.Stdout)
+	for _, j := range jobs {
+		wg.Go(func() {
+			var previous map[portKey]string
+			for {
+				at := j.when.next(time.Now())
+				if at.IsZero() {
+					slog.Error("schedule never fires", "job", j.Name, "schedule", j.Schedule)
+					return
+				}
+				slog.Debug("next run", "job", j.Name, "at", at.Format(time.RFC3339))
+				select {
+				case <-time.After(time.Until(at)):
+				case <-ctx.Done():
+					return
+				}
+				turn.Lock()
+				current, err := j.run(ctx, server)
+				turn.Unlock()
+				if err != nil {
+					if ctx.Err() == nil {
+						slog.Error("run failed", "job", j.Name, "err", err)
+					}
+					continue
+				}
+				if previous != nil {
+					out.Lock()
+					j.report(changedPorts(previous, current), previous, current, enc)
+					out.Unlock()
+				}
+				previous = current
+			}
+		})
+	}
+	slog.Info("daemon started", "jobs", len(jobs), "config", configPath)
+	wg.Wait()
+	return nil
+}
+
+// run scans the job once and returns the state of every port. A run that
+// didn't finish is an error, since comparing against it would report
+// every port it missed as gone.
+func (j *daemonJob) run(ctx context.Context, server *jobServer) (map[portKey]string, error) {
+	snap, err := server.create(j.jobRequest)
+	if err != nil {
+		return nil, err
+	}
+	var store *resultsDB
+	if dbPath != "" {
+		if store, err = openResultsDB(dbPath, []string{"daemon", j.Name}); err != nil {
+			_ = server.stop(snap.ID)
+			return nil, err
+		}
+	}
+	states := map[portKey]string{}
+	err = server.follow(ctx, snap.ID, func(r result) error {
+		states[portKey{r.Host, r.Port, r.Proto}] = r.State
+		if store != nil {
+			store.record(r)
+		}
+		return nil
+	})
+	final, _ := server.get(snap.ID)
+	if store != nil {
+		if err := store.finish(final.Summary); err != nil {
+			slog.Error("writing to database failed", "db", dbPath, "err", err)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if final.Status != "done" {
+		return nil, errors.New("scan " + final.Status)
+	}
+	s := final.Summary
+	slog.Debug("run done", "job", j.Name, "probes", s.Probed, "open", s.Open, "closed", s.Closed, "filtered", s.Filtered, "took", formatLatency(s.DurationMS))
+	return states, nil
+}
+
+func (j *daemonJob) report(keys []portKey, previous, current map[portKey]string, enc *json.Encoder) {
+	now := time.Now().UTC().Format(time.RFC3339)
+	for _, k := range keys {
+		c := change{Type: "change", Host: k.host, Port: k.port, Proto: k.proto, From: previous[k], To: current[k], Time: now, Job: j.Name}
+		reportChange(os.Stdout, enc, c)
+		for _, n := range j.alerts {
+			n.notify(alert{text: changeText(c), change: &c})
+		}
+		if syslogSink != nil {
+			syslogSink.change(c)
+		}
+	}
+}
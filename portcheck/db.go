@@ -0,0 +1,136 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+var dbPath string
+
+// dbSchema keeps every scan: one scans row per run, the hosts ever seen, and
+// one ports row per probe result. Created on first use; existing tables are
+// left alone.
+const dbSchema = `
+CREATE TABLE IF NOT EXISTS scans (
+	id            INTEGER PRIMARY KEY,
+	started_at    TEXT NOT NULL,
+	finished_at   TEXT,
+	args          TEXT NOT NULL,
+	probed        INTEGER,
+	open          INTEGER,
+	open_filtered INTEGER,
+	filtered      INTEGER,
+	closed        INTEGER,
+	errors        INTEGER,
+	duration_ms   REAL,
+	interrupted   INTEGER NOT NULL DEFAULT 0
+);
+CREATE TABLE IF NOT EXISTS hosts (
+	id   INTEGER PRIMARY KEY,
+	name TEXT NOT NULL UNIQUE
+);
+CREATE TABLE IF NOT EXISTS ports (
+	scan_id    INTEGER NOT NULL REFERENCES scans(id),
+	host_id    INTEGER NOT NULL REFERENCES hosts(id),
+	port       INTEGER NOT NULL,
+	proto      TEXT NOT NULL,
+	state      TEXT NOT NULL,
+	reason     TEXT,
+	service    TEXT,
+	version    TEXT,
+	latency_ms REAL,
+	banner     TEXT,
+	PRIMARY KEY (scan_id, host_id, port, proto)
+);
+CREATE INDEX IF NOT EXISTS ports_by_host ON ports (host_id, port, proto);
+`
+
+// resultsDB records one scan into a SQLite file inside a single transaction,
+// committed when the scan ends, so a crash leaves no half-recorded scan.
+type resultsDB struct {
+	db     *sql.DB
+	tx     *sql.Tx
+	scanID int64
+	hosts  map[string]int64
+	insert *sql.Stmt
+}
+
+func openResultsDB(path string, args []string) (*resultsDB, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+	d := &resultsDB{db: db, hosts: map[string]int64{}}
+	if err := d.begin(args); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return d, nil
+}
+
+func (d *resultsDB) begin(args []string) error {
+	if _, err := d.db.Exec(dbSchema); err != nil {
+		return err
+	}
+	var err error
+	if d.tx, err = d.db.Begin(); err != nil {
+		return err
+	}
+	res, err := d.tx.Exec(`INSERT INTO scans (started_at, args) VALUES (?, ?)`,
+		time.Now().UTC().Format(time.RFC3339Nano), strings.Join(redactArgs(args), " "))
+	if err == nil {
+		d.scanID, err = res.LastInsertId()
+	}
+	if err == nil {
+		d.insert, err = d.tx.Prepare(`INSERT OR REPLACE INTO ports
+			(scan_id, host_id, port, proto, state, reason, service, version, latency_ms, banner)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	}
+	if err != nil {
+		_ = d.tx.Rollback()
+	}
+	return err
+}
+
+func (d *resultsDB) hostID(name string) (int64, error) {
+	if id, ok := d.hosts[name]; ok {
+		return id, nil
+	}
+	var id int64
+	err := d.tx.QueryRow(`INSERT INTO hosts (name) VALUES (?)
+		ON CONFLICT (name) DO UPDATE SET name = excluded.name RETURNING id`, name).Scan(&id)
+	if err == nil {
+		d.hosts[name] = id
+	}
+	return id, err
+}
+
+func (d *resultsDB) record(r result) {
+	hostID, err := d.hostID(r.Host)
+	if err == nil {
+		_, err = d.insert.Exec(d.scanID, hostID, r.Port, r.Proto, r.State,
+			r.Reason, r.Service, r.Version, r.LatencyMS, r.Banner)
+	}
+	if err != nil {
+		slog.Error("writing to database failed", "db", dbPath, "err", err)
+	}
+}
+
+// finish stores the summary and commits the scan.
+func (d *resultsDB) finish(s summary) error {
+	defer d.db.Close()
+	_, err := d.tx.Exec(`UPDATE scans SET finished_at = ?, probed = ?, open = ?, open_filtered = ?,
+		filtered = ?, closed = ?, errors = ?, duration_ms = ?, interrupted = ? WHERE id = ?`,
+		time.Now().UTC().Format(time.RFC3339Nano), s.Probed, s.Open, s.OpenFiltered, s.Filtered,
+		s.Closed, s.Errors, s.DurationMS, s.Interrupted, d.scanID)
+	if err != nil {
+		_ = d.tx.Rollback()
+		return err
+	}
+	return d.tx.Commit()
+}
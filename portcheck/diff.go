@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bufio"
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// baselinePath is the saved -json scan that `portcheck diff` compares against.
+var baselinePath string
+
+// portKey identifies a scanned port across runs.
+type portKey struct {
+	host  string
+	port  int
+	proto string
+}
+
+func (k portKey) String() string {
+	return net.JoinHostPort(k.host, strconv.Itoa(k.port)) + "/" + k.proto
+}
+
+// change is one port whose state differs from the baseline.
+type change struct {
+	Type  string `json:"type"`
+	Host  string `json:"host"`
+	Port  int    `json:"port"`
+	Proto string `json:"proto"`
+	From  string `json:"from"`
+	To    string `json:"to"`
+	Time  string `json:"time,omitempty"`
+	// Job names the daemon job whose scan saw the change.
+	Job string `json:"job,omitempty"`
+}
+
+// diffFormatter replaces the normal output in diff mode: it collects the scan
+// and, once it's done, prints only the ports that opened or stopped being
+// open since the baseline. Ports the baseline didn't cover count as not open
+// before; ports this scan didn't cover are left out.
+type diffFormatter struct {
+	w        io.Writer
+	asJSON   bool
+	baseline map[portKey]string
+	current  map[portKey]string
+	changes  int
+}
+
+func newDiffFormatter(path, format string, w io.Writer) (*diffFormatter, error) {
+	if format != "text" && format != "json" {
+		return nil, fmt.Errorf("diff supports text and json output, not %q", format)
+	}
+	baseline, err := loadBaseline(path)
+	if err != nil {
+		return nil, err
+	}
+	return &diffFormatter{w: w, asJSON: format == "json", baseline: baseline, current: map[portKey]string{}}, nil
+}
+
+// loadBaseline reads the probe lines of a -json scan, skipping the summary
+// and anything else that isn't a result.
+func loadBaseline(path string) (map[portKey]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	states := map[portKey]string{}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1<<20)
+	for line := 1; scanner.Scan(); line++ {
+		var r result
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		if r.Type == "probe" {
+			states[portKey{r.Host, r.Port, r.Proto}] = r.State
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(states) == 0 {
+		return nil, fmt.Errorf("no results in %s; save the baseline with -json", path)
+	}
+	return states, nil
+}
+
+func (f *diffFormatter) result(r result) {
+	f.current[portKey{r.Host, r.Port, r.Proto}] = r.State
+}
+
+func (f *diffFormatter) finish(summary) error {
+	keys := changedPorts(f.baseline, f.current)
+	f.changes = len(keys)
+	enc := json.NewEncoder(f.w)
+	for _, k := range keys {
+		was, now := stateOf(f.baseline, k), f.current[k]
+		var err error
+		switch {
+		case f.asJSON:
+			err = enc.Encode(change{Type: "change", Host: k.host, Port: k.port, Proto: k.proto, From: was, To: now})
+		case now == "open":
+			_, err = fmt.Fprintf(f.w, "+ %s opened (was %s)\n", k, was)
+		default:
+			_, err = fmt.Fprintf(f.w, "- %s closed (now %s)\n", k, now)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// changedPorts lists, in host and port order, the ports in after that are
+// open but weren't in before, or were open and no longer are.
+func changedPorts(before, after map[portKey]string) []portKey {
+	keys := []portKey{}
+	for k, now := range after {
+		if (now == "open") != (stateOf(before, k) == "open") {
+			keys = append(keys, k)
+		}
+	}
+	slices.SortFunc(keys, comparePortKeys)
+	return keys
+}
+
+func comparePortKeys(a, b portKey) int {
+	return cmp.Or(compareHosts(a.host, b.host), cmp.Compare(a.port, b.port), strings.Compare(a.proto, b.proto))
+}
+
+func stateOf(states map[portKey]string, k portKey) string {
+	if state, ok := states[k]; ok {
+		return state
+	}
+	return "unscanned"
+}
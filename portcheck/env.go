@@ -0,0 +1,59 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// envPrefix starts the environment variable that stands in for each flag:
+// -timeout is PORTCHECK_TIMEOUT, -top-ports is PORTCHECK_TOP_PORTS.
+const envPrefix = "PORTCHECK_"
+
+func envName(flagName string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// applyEnv sets every flag that wasn't given on the command line from its
+// environment variable, and fills in the positional arguments from
+// PORTCHECK_TARGETS and PORTCHECK_PORTS when none were given. It runs before
+// the config file, which only fills in what is still unset.
+func applyEnv(fs *flag.FlagSet, args []string) ([]string, error) {
+	given := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { given[f.Name] = true })
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		v, ok := os.LookupEnv(envName(f.Name))
+		if !ok || given[f.Name] || err != nil {
+			return
+		}
+		if b, isBool := f.Value.(interface{ IsBoolFlag() bool }); isBool && b.IsBoolFlag() {
+			on, perr := strconv.ParseBool(v)
+			if perr != nil {
+				err = fmt.Errorf("%s: %q is not a boolean", envName(f.Name), v)
+				return
+			}
+			if !on {
+				return
+			}
+		}
+		if serr := fs.Set(f.Name, v); serr != nil {
+			err = fmt.Errorf("%s=%q: %w", envName(f.Name), v, serr)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	targets, ports := os.Getenv(envPrefix+"TARGETS"), os.Getenv(envPrefix+"PORTS")
+	fromFile := inputList != "" || hostnameList != "" || subcommand.name == "lan"
+	if !fromFile && len(args) == 0 && targets != "" {
+		args = []string{targets}
+	}
+	if (!fromFile && len(args) == 1 || fromFile && len(args) == 0) && ports != "" {
+		args = append(args, ports)
+	}
+	return args, nil
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	listenAddr    = ":9117"
+	serveInterval = time.Minute
+)
+
+// latencyBuckets are the upper bounds, in seconds, of the probe latency
+// histogram: sub-millisecond LAN answers up to the longest sane timeout.
+var latencyBuckets = []float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5}
+
+type histogram struct {
+	counts []uint64 // per bucket, not cumulative
+	count  uint64
+	sum    float64
+}
+
+func (h *histogram) observe(v float64) {
+	i, _ := slices.BinarySearch(latencyBuckets, v)
+	if i < len(latencyBuckets) {
+		h.counts[i]++
+	}
+	h.count++
+	h.sum += v
+}
+
+type hostProto struct {
+	host, proto string
+}
+
+// exporter holds what the latest scan found, plus latency histograms
+// accumulated over every scan since start, in Prometheus form.
+type exporter struct {
+	mu       sync.Mutex
+	states   map[portKey]string
+	latency  map[hostProto]*histogram
+	duration time.Duration
+	last     time.Time
+	scans    int
+}
+
+func newExporter() *exporter {
+	return &exporter{states: map[portKey]string{}, latency: map[hostProto]*histogram{}}
+}
+
+// record replaces the port states with those of a finished scan. Only probes
+// that got an answer feed the histogram; a timeout's latency is just -timeout.
+func (e *exporter) record(results []result, duration time.Duration) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.states = map[portKey]string{}
+	for _, r := range results {
+		e.states[portKey{r.Host, r.Port, r.Proto}] = r.State
+		if r.State != "open" && r.State != "closed" {
+			continue
+		}
+		hp := hostProto{r.Host, r.Proto}
+		if e.latency[hp] == nil {
+			e.latency[hp] = &histogram{counts: make([]uint64, len(latencyBuckets))}
+		}
+		e.latency[hp].observe(r.LatencyMS / 1000)
+	}
+	e.duration, e.last = duration, time.Now()
+	e.scans++
+}
+
+func (e *exporter) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.write(w)
+}
+
+func (e *exporter) write(w io.Writer) {
+	fmt.Fprintln(w, "# HELP portcheck_port_up Whether the port was open in the last scan.")
+	fmt.Fprintln(w, "# TYPE portcheck_port_up gauge")
+	keys := []portKey{}
+	for k := range e.states {
+		keys = append(keys, k)
+	}
+	slices.SortFunc(keys, comparePortKeys)
+	for _, k := range keys {
+		up := 0
+		if e.states[k] == "open" {
+			up = 1
+		}
+		fmt.Fprintf(w, "portcheck_port_up{%s} %d\n", portLabels(k), up)
+	}
+	fmt.Fprintln(w, "# HELP portcheck_port_state Port state in the last scan, one series per port with value 1.")
+	fmt.Fprintln(w, "# TYPE portcheck_port_state gauge")
+	for _, k := range keys {
+		fmt.Fprintf(w, "portcheck_port_state{%s,state=%s} 1\n", portLabels(k), labelValue(e.states[k]))
+	}
+
+	fmt.Fprintln(w, "# HELP portcheck_probe_latency_seconds Time to an answer (open or closed) per host.")
+	fmt.Fprintln(w, "# TYPE portcheck_probe_latency_seconds histogram")
+	hps := []hostProto{}
+	for hp := range e.latency {
+		hps = append(hps, hp)
+	}
+	slices.SortFunc(hps, func(a, b hostProto) int {
+		return cmp.Or(compareHosts(a.host, b.host), strings.Compare(a.proto, b.proto))
+	})
+	for _, hp := range hps {
+		h := e.latency[hp]
+		labels := "host=" + labelValue(hp.host) + ",proto=" + labelValue(hp.proto)
+		var cumulative uint64
+		for i, le := range latencyBuckets {
+			cumulative += h.counts[i]
+			fmt.Fprintf(w, "portcheck_probe_latency_seconds_bucket{%s,le=\"%s\"} %d\n", labels, strconv.FormatFloat(le, 'g', -1, 64), cumulative)
+		}
+		fmt.Fprintf(w, "portcheck_probe_latency_seconds_bucket{%s,le=\"+Inf\"} %d\n", labels, h.count)
+		fmt.Fprintf(w, "portcheck_probe_latency_seconds_sum{%s} %g\n", labels, h.sum)
+		fmt.Fprintf(w, "portcheck_probe_latency_seconds_count{%s} %d\n", labels, h.count)
+	}
+
+	fmt.Fprintln(w, "# HELP portcheck_scan_duration_seconds How long the last scan took.")
+	fmt.Fprintln(w, "# TYPE portcheck_scan_duration_seconds gauge")
+	fmt.Fprintf(w, "portcheck_scan_duration_seconds %g\n", e.duration.Seconds())
+	fmt.Fprintln(w, "# HELP portcheck_last_scan_timestamp_seconds When the last scan finished, as a Unix time.")
+	fmt.Fprintln(w, "# TYPE portcheck_last_scan_timestamp_seconds gauge")
+	if !e.last.IsZero() {
+		fmt.Fprintf(w, "portcheck_last_scan_timestamp_seconds %d\n", e.last.Unix())
+	}
+	fmt.Fprintln(w, "# HELP portcheck_scans_total Scans completed since start.")
+	fmt.Fprintln(w, "# TYPE portcheck_scans_total counter")
+	fmt.Fprintf(w, "portcheck_scans_total %d\n", e.scans)
+	v, rev, _ := buildVersion()
+	fmt.Fprintln(w, "# HELP portcheck_build_info The portcheck build serving, with value 1.")
+	fmt.Fprintln(w, "# TYPE portcheck_build_info gauge")
+	fmt.Fprintf(w, "portcheck_build_info{version=%s,commit=%s,goversion=%s} 1\n", labelValue(v), labelValue(rev), labelValue(runtime.Version()))
+}
+
+func portLabels(k portKey) string {
+	return "host=" + labelValue(k.host) + ",port=\"" + strconv.Itoa(k.port) + "\",proto=" + labelValue(k.proto)
+}
+
+// labelValue quotes v as the exposition format wants it.
+func labelValue(v string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v) + `"`
+}
+
+// serve runs the scan API on listenAddr, and on grpcListen if set, and when addresses were given,
+// scans them every serveInterval and publishes the results for Prometheus to
+// scrape, until ctx ends. Without -api-token the API is only served on
+// loopback.
+func serve(ctx context.Context, addresses addressList) error {
+	api := apiAllowed(listenAddr)
+	if !api && addresses.len() == 0 {
+		return fmt.Errorf("serving the scan API on %s needs -api-token, as it isn't a loopback address", listenAddr)
+	}
+	if grpcListen != "" && !apiAllowed(grpcListen) {
+		return fmt.Errorf("serving the gRPC scan API on %s needs -api-token, as it isn't a loopback address", grpcListen)
+	}
+	jobs := newJobServer(ctx)
+	mux := http.NewServeMux()
+	if api {
+		jobs.register(mux)
+	}
+	srv := &http.Server{Addr: listenAddr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	errc := make(chan error, 2)
+	go func() { errc <- srv.ListenAndServe() }()
+	if api {
+		slog.Info("serving the scan API", "url", listenAddr+"/scans")
+	} else {
+		slog.Info("not serving the scan API: set -api-token to serve it beyond loopback", "listen", listenAddr)
+	}
+	if grpcListen != "" {
+		lis, err := net.Listen("tcp", grpcListen)
+		if err != nil {
+			return err
+		}
+		gs := newGRPCServer(jobs)
+		go func() { errc <- gs.Serve(lis) }()
+		// jobs end with ctx, which ends the result streams
+		defer gs.GracefulStop()
+		slog.Info("serving the gRPC scan API", "address", grpcListen)
+	}
+
+	scans := make(chan struct{})
+	if addresses.len() == 0 {
+		close(scans)
+	} else {
+		exp := newExporter()
+		mux.Handle("GET /metrics", exp)
+		slog.Info("serving metrics", "url", listenAddr+"/metrics", "ports", addresses.len(), "interval", serveInterval)
+		go func() {
+			defer close(scans)
+			for {
+				start := time.Now()
+				results := []result{}
+				for r := range scan(ctx, ctx, addresses) {
+					results = append(results, r)
+				}
+				if ctx.Err() != nil {
+					return
+				}
+				exp.record(results, time.Since(start))
+				select {
+				case <-time.After(serveInterval):
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+	<-scans
+	shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdown); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"log/slog"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// geoSources are where -geoip looks addresses up, in the order given; the
+// first to know a field provides it, so an ASN and a country database can
+// be combined.
+var geoSources []geoSource
+
+// geoInfo is what -geoip adds to the results of an address.
+type geoInfo struct {
+	ASN     uint32
+	Org     string
+	Country string
+}
+
+func (g geoInfo) String() string {
+	parts := []string{}
+	if g.ASN != 0 {
+		parts = append(parts, strings.TrimSpace(fmt.Sprintf("AS%d %s", g.ASN, g.Org)))
+	}
+	if g.Country != "" {
+		parts = append(parts, g.Country)
+	}
+	return strings.Join(parts, ", ")
+}
+
+func (g geoInfo) merge(o geoInfo) geoInfo {
+	if g.ASN == 0 {
+		g.ASN, g.Org = o.ASN, o.Org
+	}
+	g.Country = cmp.Or(g.Country, o.Country)
+	return g
+}
+
+type geoSource interface {
+	lookup(ip netip.Addr) (geoInfo, error)
+}
+
+// geoipFlag adds a -geoip source: cymru, or a MaxMind DB file.
+func geoipFlag(v string) error {
+	if v == "cymru" {
+		geoSources = append(geoSources, &cymruSource{orgs: map[uint32]string{}})
+		return nil
+	}
+	db, err := openMMDB(v)
+	if err != nil {
+		return err
+	}
+	geoSources = append(geoSources, mmdbSource{db})
+	return nil
+}
+
+var geoCache = struct {
+	sync.Mutex
+	byHost map[string]geoInfo
+}{byHost: map[string]geoInfo{}}
+
+// geoLookup is what the -geoip sources know about host, looked up once per
+// address. Hostnames aren't resolved here: scanning them with
+// -all-addresses gets their addresses looked up.
+func geoLookup(host string) geoInfo {
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return geoInfo{}
+	}
+	geoCache.Lock()
+	defer geoCache.Unlock()
+	if g, ok := geoCache.byHost[host]; ok {
+		return g
+	}
+	var g geoInfo
+	for _, s := range geoSources {
+		found, err := s.lookup(ip)
+		if err != nil {
+			slog.Debug("geoip lookup failed", "host", host, "err", err)
+			continue
+		}
+		g = g.merge(found)
+	}
+	geoCache.byHost[host] = g
+	return g
+}
+
+// mmdbSource reads the ASN and country fields of the MaxMind GeoLite2 and
+// GeoIP2 databases, which DB-IP's share, and of IPinfo's.
+type mmdbSource struct {
+	db *mmdb
+}
+
+func (s mmdbSource) lookup(ip netip.Addr) (geoInfo, error) {
+	v, err := s.db.lookup(ip)
+	rec, _ := v.(map[string]any)
+	if err != nil || rec == nil {
+		return geoInfo{}, err
+	}
+	var g geoInfo
+	if n, ok := rec["autonomous_system_number"].(uint64); ok {
+		g.ASN = uint32(n)
+		g.Org, _ = rec["autonomous_system_organization"].(string)
+	} else if s, ok := rec["asn"].(string); ok {
+		// IPinfo: "AS13335"
+		n, _ := strconv.ParseUint(strings.TrimPrefix(s, "AS"), 10, 32)
+		g.ASN = uint32(n)
+		g.Org, _ = rec["as_name"].(string)
+	}
+	for _, key := range []string{"country", "registered_country"} {
+		if c, ok := rec[key].(map[string]any); ok {
+			if g.Country, _ = c["iso_code"].(string); g.Country != "" {
+				break
+			}
+		}
+	}
+	if g.Country == "" {
+		g.Country, _ = rec["country_code"].(string)
+	}
+	return g, nil
+}
+
+// cymruSource asks Team Cymru's IP to ASN service over DNS
+// (https://www.team-cymru.com/ip-asn-mapping). Answers are kept per
+// announced prefix and AS, so a sweep costs a lookup or two per route
+// rather than per address.
+type cymruSource struct {
+	mu       sync.Mutex
+	prefixes []cymruPrefix
+	orgs     map[uint32]string
+}
+
+type cymruPrefix struct {
+	prefix netip.Prefix
+	geoInfo
+}
+
+func (c *cymruSource) lookup(ip netip.Addr) (geoInfo, error) {
+	ip = ip.Unmap()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, p := range c.prefixes {
+		if p.prefix.Contains(ip) {
+			return p.geoInfo, nil
+		}
+	}
+	name := ""
+	if ip.Is4() {
+		b := ip.As4()
+		name = fmt.Sprintf("%d.%d.%d.%d.origin.asn.cymru.com", b[3], b[2], b[1], b[0])
+	} else {
+		var sb strings.Builder
+		b := ip.As16()
+		for i := len(b) - 1; i >= 0; i-- {
+			fmt.Fprintf(&sb, "%x.%x.", b[i]&0xf, b[i]>>4)
+		}
+		name = sb.String() + "origin6.asn.cymru.com"
+	}
+	// "13335 | 1.1.1.0/24 | AU | apnic | 2011-08-11", one per prefix
+	// announcing ip; the most specific is the one routed
+	txts, err := c.query(name)
+	if err != nil {
+		return geoInfo{}, err
+	}
+	var best cymruPrefix
+	for _, txt := range txts {
+		fields := cymruFields(txt)
+		if len(fields) < 3 {
+			continue
+		}
+		p, err := netip.ParsePrefix(fields[1])
+		asns := strings.Fields(fields[0])
+		if err != nil || len(asns) == 0 || (best.prefix.IsValid() && p.Bits() <= best.prefix.Bits()) {
+			continue
+		}
+		asn, err := strconv.ParseUint(asns[0], 10, 32)
+		if err != nil {
+			continue
+		}
+		best = cymruPrefix{p.Masked(), geoInfo{ASN: uint32(asn), Country: fields[2]}}
+	}
+	if !best.prefix.IsValid() {
+		return geoInfo{}, nil
+	}
+	best.Org = c.org(best.ASN)
+	c.prefixes = append(c.prefixes, best)
+	return best.geoInfo, nil
+}
+
+// org is the name Team Cymru has for an AS, e.g. CLOUDFLARENET from
+// "13335 | US | arin | 2010-07-14 | CLOUDFLARENET, US".
+func (c *cymruSource) org(asn uint32) string {
+	if org, ok := c.orgs[asn]; ok {
+		return org
+	}
+	org := ""
+	txts, err := c.query(fmt.Sprintf("AS%d.asn.cymru.com", asn))
+	if err != nil {
+		slog.Debug("geoip lookup failed", "asn", asn, "err", err)
+	}
+	for _, txt := range txts {
+		if fields := cymruFields(txt); len(fields) >= 5 {
+			org = strings.TrimSuffix(fields[4], ", "+fields[1])
+			break
+		}
+	}
+	c.orgs[asn] = org
+	return org
+}
+
+func (c *cymruSource) query(name string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return lookupResolver().LookupTXT(ctx, name)
+}
+
+func cymruFields(txt string) []string {
+	fields := strings.Split(txt, "|")
+	for i, f := range fields {
+		fields[i] = strings.TrimSpace(f)
+	}
+	return fields
+}
+
+// providerCount is how many of the scanned hosts an AS announces and how
+// many open ports they have, for -geoip.
+type providerCount struct {
+	ASN   uint32 `json:"asn"`
+	Org   string `json:"as_org,omitempty"`
+	Hosts int    `json:"hosts"`
+	Open  int    `json:"open"`
+}
+
+func (p providerCount) String() string {
+	name := "unknown"
+	if p.ASN != 0 {
+		name = strings.TrimSpace(fmt.Sprintf("AS%d %s", p.ASN, p.Org))
+	}
+	hosts := "hosts"
+	if p.Hosts == 1 {
+		hosts = "host"
+	}
+	return fmt.Sprintf("%s: %d %s, %d open", name, p.Hosts, hosts, p.Open)
+}
+
+// providers groups the results of a scan by the AS announcing their host,
+// hosts no source knew under AS 0.
+type providers struct {
+	byASN map[uint32]*providerCount
+	hosts map[string]bool
+}
+
+func newProviders() *providers {
+	return &providers{byASN: map[uint32]*providerCount{}, hosts: map[string]bool{}}
+}
+
+func (p *providers) add(r result) {
+	c := p.byASN[r.ASN]
+	if c == nil {
+		c = &providerCount{ASN: r.ASN, Org: r.ASOrg}
+		p.byASN[r.ASN] = c
+	}
+	if !p.hosts[r.Host] {
+		p.hosts[r.Host] = true
+		c.Hosts++
+	}
+	if r.State == "open" {
+		c.Open++
+	}
+}
+
+// report is the providers with the most hosts first.
+func (p *providers) report() []providerCount {
+	counts := []providerCount{}
+	for _, c := range p.byASN {
+		counts = append(counts, *c)
+	}
+	slices.SortFunc(counts, func(a, b providerCount) int {
+		return cmp.Or(cmp.Compare(b.Hosts, a.Hosts), cmp.Compare(a.ASN, b.ASN))
+	})
+	return counts
+}
+
+// providerLines is the report as text, one line per AS.
+func providerLines(counts []providerCount) string {
+	var b strings.Builder
+	for _, p := range counts {
+		b.WriteString("provider " + p.String() + "\n")
+	}
+	return b.String()
+}
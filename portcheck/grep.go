@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+)
+
+// grepFormatter mimics nmap -oG: one line per host listing every open port
+// as port/state/proto//service///, with everything else folded into the
+// Ignored State field.
+type grepFormatter struct {
+	w      io.Writer
+	hosts  []string
+	byHost map[string][]result
+}
+
+func (f *grepFormatter) result(r result) {
+	if f.byHost == nil {
+		f.byHost = map[string][]result{}
+	}
+	f.byHost[r.Host] = append(f.byHost[r.Host], r)
+}
+
+func (f *grepFormatter) finish(s summary) error {
+	end := time.Now()
+	start := end.Add(-time.Duration(s.DurationMS * float64(time.Millisecond)))
+	if _, err := fmt.Fprintf(f.w, "# portcheck scan initiated %s as: %s\n",
+		start.Format(time.ANSIC), commandLine()); err != nil {
+		return err
+	}
+	for _, host := range scanHosts {
+		rs := f.byHost[host]
+		slices.SortFunc(rs, func(a, b result) int { return a.Port - b.Port })
+		open := []string{}
+		latency := []string{}
+		ignored := map[string]int{}
+		for _, r := range rs {
+			if r.State == "open" || r.State == "open|filtered" {
+				open = append(open, fmt.Sprintf("%d/%s/%s//%s//%s/", r.Port, r.State, r.Proto, r.Service, r.Version))
+				if r.State == "open" {
+					latency = append(latency, fmt.Sprintf("%d/%s", r.Port, formatLatency(r.LatencyMS)))
+				}
+				continue
+			}
+			if r.State != "error" {
+				ignored[r.State]++
+			}
+		}
+		name := ""
+		if len(rs) > 0 {
+			name = rs[0].Hostname
+		}
+		line := "Host: " + grepHost(host, name)
+		if len(open) > 0 {
+			line += "\tPorts: " + strings.Join(open, ", ")
+		}
+		states := []string{}
+		for state := range ignored {
+			states = append(states, state)
+		}
+		slices.Sort(states)
+		for _, state := range states {
+			line += fmt.Sprintf("\tIgnored State: %s (%d)", state, ignored[state])
+		}
+		// not part of nmap's format; extra fields are ignored by -oG parsers
+		if len(latency) > 0 {
+			line += "\tLatency: " + strings.Join(latency, ", ")
+		}
+		if _, err := fmt.Fprintln(f.w, line); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(f.w, "# portcheck done at %s -- %d IP address scanned in %.2f seconds\n",
+		end.Format(time.ANSIC), len(scanHosts), end.Sub(start).Seconds())
+	return err
+}
+
+// grepHost renders "IP (name)" like nmap. The name is the target as given,
+// or for an address its -rdns name, which may be empty.
+func grepHost(host, ptr string) string {
+	addr := nmapAddr(host).Addr
+	if addr == host {
+		return fmt.Sprintf("%s (%s)", addr, ptr)
+	}
+	return fmt.Sprintf("%s (%s)", addr, host)
+}
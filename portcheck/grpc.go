@@ -0,0 +1,234 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/gishyanart/helper-scripts/portcheck/portscan"
+	"github.com/gishyanart/helper-scripts/portcheck/scanpb"
+)
+
+// grpcListen is the serve -grpc-listen address; empty leaves gRPC off.
+var grpcListen string
+
+// grpcScans serves the jobs of a jobServer over gRPC.
+type grpcScans struct {
+	scanpb.UnimplementedScanServiceServer
+	jobs *jobServer
+}
+
+func newGRPCServer(jobs *jobServer) *grpc.Server {
+	srv := grpc.NewServer(
+		grpc.UnaryInterceptor(func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, h grpc.UnaryHandler) (any, error) {
+			if err := checkToken(ctx); err != nil {
+				return nil, err
+			}
+			return h(ctx, req)
+		}),
+		grpc.StreamInterceptor(func(srv any, ss grpc.ServerStream, _ *grpc.StreamServerInfo, h grpc.StreamHandler) error {
+			if err := checkToken(ss.Context()); err != nil {
+				return err
+			}
+			return h(srv, ss)
+		}),
+	)
+	scanpb.RegisterScanServiceServer(srv, &grpcScans{jobs: jobs})
+	return srv
+}
+
+// checkToken wants the same bearer token as the HTTP API, in the
+// authorization metadata.
+func checkToken(ctx context.Context) error {
+	if apiToken == "" {
+		return nil
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, v := range md.Get("authorization") {
+		token, ok := strings.CutPrefix(v, "Bearer ")
+		if ok && subtle.ConstantTimeCompare([]byte(token), []byte(apiToken)) == 1 {
+			return nil
+		}
+	}
+	return status.Error(codes.Unauthenticated, "missing or wrong bearer token")
+}
+
+func grpcError(err error) error {
+	if errors.Is(err, errNoJob) {
+		return status.Error(codes.NotFound, err.Error())
+	}
+	return err
+}
+
+func (g *grpcScans) SubmitScan(_ context.Context, req *scanpb.ScanRequest) (*scanpb.Job, error) {
+	j, err := g.jobs.create(fromScanRequest(req))
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	return toJob(j), nil
+}
+
+func (g *grpcScans) GetScan(_ context.Context, req *scanpb.GetScanRequest) (*scanpb.Job, error) {
+	j, err := g.jobs.get(req.GetId())
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return toJob(j), nil
+}
+
+func (g *grpcScans) ListScans(context.Context, *scanpb.ListScansRequest) (*scanpb.ListScansResponse, error) {
+	resp := &scanpb.ListScansResponse{}
+	for _, j := range g.jobs.all() {
+		resp.Jobs = append(resp.Jobs, toJob(j))
+	}
+	return resp, nil
+}
+
+func (g *grpcScans) CancelScan(_ context.Context, req *scanpb.CancelScanRequest) (*scanpb.Job, error) {
+	if err := g.jobs.stop(req.GetId()); err != nil {
+		return nil, grpcError(err)
+	}
+	j, err := g.jobs.get(req.GetId())
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return toJob(j), nil
+}
+
+func (g *grpcScans) StreamResults(req *scanpb.StreamResultsRequest, stream grpc.ServerStreamingServer[scanpb.Result]) error {
+	return grpcError(g.jobs.follow(stream.Context(), req.GetId(), func(r result) error {
+		return stream.Send(toResult(r))
+	}))
+}
+
+func (g *grpcScans) Scan(req *scanpb.ScanRequest, stream grpc.ServerStreamingServer[scanpb.Result]) error {
+	j, err := g.jobs.create(fromScanRequest(req))
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	err = g.jobs.follow(stream.Context(), j.ID, func(r result) error {
+		return stream.Send(toResult(r))
+	})
+	if err != nil {
+		// nobody is left to read the results
+		_ = g.jobs.stop(j.ID)
+	}
+	return grpcError(err)
+}
+
+func fromScanRequest(req *scanpb.ScanRequest) jobRequest {
+	jr := jobRequest{
+		Targets:          req.GetTargets(),
+		Ports:            req.GetPorts(),
+		TopPorts:         int(req.GetTopPorts()),
+		UDP:              req.GetUdp(),
+		Timeout:          req.GetTimeout(),
+		Banner:           req.GetBanner(),
+		VersionDetection: req.GetVersionDetection(),
+		TLSInfo:          req.GetTlsInfo(),
+		HTTPProbe:        req.GetHttpProbe(),
+	}
+	if req.Retries != nil {
+		n := int(req.GetRetries())
+		jr.Retries = &n
+	}
+	return jr
+}
+
+func toScanRequest(jr jobRequest) *scanpb.ScanRequest {
+	req := &scanpb.ScanRequest{
+		Targets:          jr.Targets,
+		Ports:            jr.Ports,
+		TopPorts:         int32(jr.TopPorts),
+		Udp:              jr.UDP,
+		Timeout:          jr.Timeout,
+		Banner:           jr.Banner,
+		VersionDetection: jr.VersionDetection,
+		TlsInfo:          jr.TLSInfo,
+		HttpProbe:        jr.HTTPProbe,
+	}
+	if jr.Retries != nil {
+		n := int32(*jr.Retries)
+		req.Retries = &n
+	}
+	return req
+}
+
+func timestamp(t *time.Time) *timestamppb.Timestamp {
+	if t == nil {
+		return nil
+	}
+	return timestamppb.New(*t)
+}
+
+func toJob(j job) *scanpb.Job {
+	s := j.Summary
+	return &scanpb.Job{
+		Id:       j.ID,
+		Status:   j.Status,
+		Request:  toScanRequest(j.Request),
+		Created:  timestamppb.New(j.Created),
+		Started:  timestamp(j.Started),
+		Finished: timestamp(j.Finished),
+		Probes:   int32(j.Probes),
+		Summary: &scanpb.Summary{
+			Probed:       int32(s.Probed),
+			Open:         int32(s.Open),
+			OpenFiltered: int32(s.OpenFiltered),
+			Filtered:     int32(s.Filtered),
+			Closed:       int32(s.Closed),
+			Errors:       int32(s.Errors),
+			DurationMs:   s.DurationMS,
+			Interrupted:  s.Interrupted,
+		},
+		Error: j.Error,
+	}
+}
+
+func toResult(r portscan.Result) *scanpb.Result {
+	pr := &scanpb.Result{
+		Host:      r.Host,
+		Port:      int32(r.Port),
+		Proto:     r.Proto,
+		Service:   r.Service,
+		Version:   validUTF8(r.Version),
+		State:     r.State,
+		LatencyMs: r.LatencyMS,
+		Reason:    r.Reason,
+		Error:     r.Error,
+		Attempts:  int32(r.Attempts),
+		Banner:    r.Banner,
+	}
+	if t := r.TLS; t != nil {
+		sans := make([]string, len(t.SANs))
+		for i, san := range t.SANs {
+			sans[i] = validUTF8(san)
+		}
+		pr.Tls = &scanpb.TLSInfo{
+			Version:  t.Version,
+			Subject:  validUTF8(t.Subject),
+			Issuer:   validUTF8(t.Issuer),
+			Sans:     sans,
+			NotAfter: timestamppb.New(t.NotAfter),
+			DaysLeft: int32(t.DaysLeft),
+		}
+	}
+	if h := r.HTTP; h != nil {
+		pr.Http = &scanpb.HTTPInfo{Url: h.URL, Status: int32(h.Status), Server: validUTF8(h.Server), Title: validUTF8(h.Title)}
+	}
+	return pr
+}
+
+// validUTF8 makes a string a remote service sent fit a proto3 string field,
+// which won't marshal with invalid UTF-8 in it: a Latin-1 page title, say.
+func validUTF8(s string) string {
+	return strings.ToValidUTF8(s, "\uFFFD")
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"html/template"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// htmlFormatter writes a standalone HTML report once the scan is done: the
+// scan's command line and totals, every open port in one table, and a table
+// per host. Tables sort by any column on a click, with the script and styles
+// inline so the file opens anywhere, attached to a ticket or offline.
+type htmlFormatter struct {
+	w       io.Writer
+	results []result
+}
+
+func (f *htmlFormatter) result(r result) {
+	f.results = append(f.results, r)
+}
+
+type htmlReport struct {
+	Command  string
+	Started  string
+	Finished string
+	Duration string
+	Hosts    int
+	Summary  summary
+	Open     []reportRow
+	PerHost  []reportHost
+}
+
+// reportHost is one host's section of a report.
+type reportHost struct {
+	Host     string
+	Hostname string
+	Open     int
+	Rows     []reportRow
+}
+
+// reportHosts groups results by host, every scanned host included and in
+// address order, keeping the ports text output would show.
+func reportHosts(results []result) []reportHost {
+	byHost := map[string][]result{}
+	for _, r := range results {
+		byHost[r.Host] = append(byHost[r.Host], r)
+	}
+	hosts := slices.Clone(scanHosts)
+	for host := range byHost {
+		if !slices.Contains(hosts, host) {
+			hosts = append(hosts, host)
+		}
+	}
+	slices.SortFunc(hosts, compareHosts)
+	sections := []reportHost{}
+	for _, host := range hosts {
+		rs := byHost[host]
+		slices.SortFunc(rs, compareResults)
+		h := reportHost{Host: host}
+		for _, r := range rs {
+			if h.Hostname == "" {
+				h.Hostname = r.Hostname
+			}
+			if r.State != "open" && r.State != "open|filtered" && !showAll && !showErrors {
+				continue
+			}
+			h.Rows = append(h.Rows, newReportRow(r))
+			if r.State == "open" {
+				h.Open++
+			}
+		}
+		sections = append(sections, h)
+	}
+	return sections
+}
+
+// reportRow is one port as the HTML and Markdown reports show it.
+type reportRow struct {
+	Host       string
+	Port       int
+	Proto      string
+	State      string
+	Reason     string
+	Service    string
+	Version    string
+	Auth       string
+	LatencyMS  float64
+	Latency    string
+	Details    []string
+	StateClass string
+}
+
+func (f *htmlFormatter) finish(s summary) error {
+	end := time.Now()
+	start := end.Add(-time.Duration(s.DurationMS * float64(time.Millisecond)))
+	report := htmlReport{
+		Command:  commandLine(),
+		Started:  start.Format(time.RFC1123),
+		Finished: end.Format(time.RFC1123),
+		Duration: formatLatency(s.DurationMS),
+		Hosts:    len(scanHosts),
+		Summary:  s,
+	}
+	report.PerHost = reportHosts(f.results)
+	for _, h := range report.PerHost {
+		for _, row := range h.Rows {
+			if row.State == "open" {
+				report.Open = append(report.Open, row)
+			}
+		}
+	}
+	return htmlTemplate.Execute(f.w, report)
+}
+
+// newReportRow lays r out for a report, with what the inspections found
+// as one line each in Details.
+func newReportRow(r result) reportRow {
+	row := reportRow{
+		Host:       r.Host,
+		Port:       r.Port,
+		Proto:      r.Proto,
+		State:      r.State,
+		Reason:     r.Reason,
+		Service:    r.Service,
+		Version:    r.Version,
+		Auth:       strings.TrimPrefix(authNote(r.Auth), ", "),
+		LatencyMS:  r.LatencyMS,
+		Latency:    formatLatency(r.LatencyMS),
+		StateClass: strings.ReplaceAll(r.State, "|", "-"),
+	}
+	if showErrors && r.Error != "" {
+		row.Details = append(row.Details, "error: "+r.Error)
+	}
+	if r.Banner != "" {
+		row.Details = append(row.Details, "banner: "+strconv.Quote(r.Banner))
+	}
+	if r.TLS != nil {
+		row.Details = append(row.Details, "tls: "+r.TLS.String())
+	}
+	if r.SSH != nil {
+		row.Details = append(row.Details, "ssh: "+r.SSH.String())
+	}
+	if r.TLSAudit != nil {
+		row.Details = append(row.Details, "tls-audit: "+r.TLSAudit.String())
+	}
+	if r.HTTP != nil {
+		row.Details = append(row.Details, "http: "+r.HTTP.String())
+	}
+	if r.DualStack != nil {
+		row.Details = append(row.Details, "dual-stack: "+r.DualStack.String())
+	}
+	return row
+}
+
+var htmlTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>portcheck report</title>
+<style>
+body { font-family: system-ui, sans-serif; margin: 2em; color: #222; }
+h1 { font-size: 1.5em; }
+h2 { font-size: 1.2em; margin-top: 2em; }
+code { background: #f3f3f3; padding: 0.1em 0.3em; word-break: break-all; }
+dl { display: grid; grid-template-columns: max-content auto; gap: 0.2em 1em; }
+dt { font-weight: bold; }
+table { border-collapse: collapse; margin-top: 0.5em; }
+th, td { border: 1px solid #ccc; padding: 0.3em 0.6em; text-align: left; vertical-align: top; }
+th { background: #eee; cursor: pointer; user-select: none; }
+th[data-dir="asc"]::after { content: " \25b2"; }
+th[data-dir="desc"]::after { content: " \25bc"; }
+td.details { font-family: monospace; font-size: 0.9em; white-space: pre-wrap; }
+.open { color: #14802e; font-weight: bold; }
+.closed { color: #b3261e; }
+.filtered, .open-filtered { color: #9a6700; }
+.none { color: #666; }
+</style>
+</head>
+<body>
+<h1>portcheck report</h1>
+<dl>
+<dt>Command</dt><dd><code>{{.Command}}</code></dd>
+<dt>Started</dt><dd>{{.Started}}</dd>
+<dt>Finished</dt><dd>{{.Finished}}{{if .Summary.Interrupted}} (interrupted){{end}}</dd>
+<dt>Duration</dt><dd>{{.Duration}}</dd>
+<dt>Hosts</dt><dd>{{.Hosts}}</dd>
+<dt>Probes</dt><dd>{{.Summary.Probed}}: {{.Summary.Open}} open{{if .Summary.OpenFiltered}}, {{.Summary.OpenFiltered}} open|filtered{{end}}, {{.Summary.Closed}} closed, {{.Summary.Filtered}} filtered, {{.Summary.Errors}} errors</dd>
+</dl>
+
+<h2>Open ports</h2>
+{{if .Open}}
+<table class="sortable">
+<thead><tr><th>Host</th><th>Port</th><th>Proto</th><th>Service</th><th>Version</th><th>Auth</th><th>Latency</th></tr></thead>
+<tbody>
+{{range .Open}}<tr><td>{{.Host}}</td><td data-sort="{{.Port}}">{{.Port}}</td><td>{{.Proto}}</td><td>{{.Service}}</td><td>{{.Version}}</td><td>{{.Auth}}</td><td data-sort="{{.LatencyMS}}">{{.Latency}}</td></tr>
+{{end}}</tbody>
+</table>
+{{else}}<p class="none">No open ports.</p>
+{{end}}
+{{range .PerHost}}
+<h2>{{.Host}}{{with .Hostname}} ({{.}}){{end}}: {{.Open}} open</h2>
+{{if .Rows}}
+<table class="sortable">
+<thead><tr><th>Port</th><th>Proto</th><th>State</th><th>Reason</th><th>Service</th><th>Version</th><th>Auth</th><th>Latency</th><th>Details</th></tr></thead>
+<tbody>
+{{range .Rows}}<tr><td data-sort="{{.Port}}">{{.Port}}</td><td>{{.Proto}}</td><td class="{{.StateClass}}">{{.State}}</td><td>{{.Reason}}</td><td>{{.Service}}</td><td>{{.Version}}</td><td>{{.Auth}}</td><td data-sort="{{.LatencyMS}}">{{.Latency}}</td><td class="details">{{range $i, $d := .Details}}{{if $i}}
+{{end}}{{$d}}{{end}}</td></tr>
+{{end}}</tbody>
+</table>
+{{else}}<p class="none">No ports to show.</p>
+{{end}}
+{{end}}
+<script>
+document.querySelectorAll("table.sortable th").forEach(function (th) {
+  th.addEventListener("click", function () {
+    var table = th.closest("table"), body = table.tBodies[0];
+    var col = Array.prototype.indexOf.call(th.parentNode.children, th);
+    var dir = th.dataset.dir === "asc" ? "desc" : "asc";
+    table.querySelectorAll("th").forEach(function (h) { delete h.dataset.dir; });
+    th.dataset.dir = dir;
+    var key = function (row) {
+      var cell = row.children[col];
+      var v = cell.dataset.sort !== undefined ? cell.dataset.sort : cell.textContent;
+      return v !== "" && !isNaN(v) ? Number(v) : v.toLowerCase();
+    };
+    var rows = Array.prototype.slice.call(body.rows);
+    rows.sort(function (a, b) {
+      var x = key(a), y = key(b);
+      var c = typeof x === typeof y ? (x < y ? -1 : x > y ? 1 : 0) : (typeof x === "number" ? -1 : 1);
+      return dir === "asc" ? c : -c;
+    });
+    rows.forEach(function (row) { body.appendChild(row); });
+  });
+});
+</script>
+</body>
+</html>
+`))
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// JUnit XML as Jenkins, GitLab, GitHub Actions reporters and the rest read
+// it: a suite per host and a test case per port, which passes if the port
+// is open.
+type junitSuites struct {
+	XMLName  xml.Name     `xml:"testsuites"`
+	Name     string       `xml:"name,attr"`
+	Tests    int          `xml:"tests,attr"`
+	Failures int          `xml:"failures,attr"`
+	Errors   int          `xml:"errors,attr"`
+	Skipped  int          `xml:"skipped,attr"`
+	Time     string       `xml:"time,attr"`
+	Suites   []junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+	Name      string      `xml:"name,attr"`
+	Tests     int         `xml:"tests,attr"`
+	Failures  int         `xml:"failures,attr"`
+	Errors    int         `xml:"errors,attr"`
+	Skipped   int         `xml:"skipped,attr"`
+	Time      string      `xml:"time,attr"`
+	Timestamp string      `xml:"timestamp,attr"`
+	Cases     []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitProblem `xml:"failure,omitempty"`
+	Error     *junitProblem `xml:"error,omitempty"`
+	Skipped   *junitProblem `xml:"skipped,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitProblem struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr,omitempty"`
+	Text    string `xml:",chardata"`
+}
+
+type junitFormatter struct {
+	w       io.Writer
+	results []result
+}
+
+func (f *junitFormatter) result(r result) {
+	f.results = append(f.results, r)
+}
+
+func (f *junitFormatter) finish(s summary) error {
+	start := time.Now().Add(-time.Duration(s.DurationMS * float64(time.Millisecond)))
+	run := junitSuites{Name: "portcheck", Time: junitSeconds(s.DurationMS)}
+	byHost := map[string][]result{}
+	hosts := []string{}
+	for _, r := range f.results {
+		if _, ok := byHost[r.Host]; !ok {
+			hosts = append(hosts, r.Host)
+		}
+		byHost[r.Host] = append(byHost[r.Host], r)
+	}
+	slices.SortFunc(hosts, compareHosts)
+	for _, host := range hosts {
+		rs := byHost[host]
+		slices.SortFunc(rs, compareResults)
+		suite := junitSuite{Name: host, Timestamp: start.Format("2006-01-02T15:04:05")}
+		total := 0.0
+		for _, r := range rs {
+			c := newJUnitCase(r)
+			switch {
+			case c.Failure != nil:
+				suite.Failures++
+			case c.Error != nil:
+				suite.Errors++
+			case c.Skipped != nil:
+				suite.Skipped++
+			}
+			total += r.LatencyMS
+			suite.Cases = append(suite.Cases, c)
+		}
+		suite.Tests = len(suite.Cases)
+		suite.Time = junitSeconds(total)
+		run.Tests += suite.Tests
+		run.Failures += suite.Failures
+		run.Errors += suite.Errors
+		run.Skipped += suite.Skipped
+		run.Suites = append(run.Suites, suite)
+	}
+	if _, err := io.WriteString(f.w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(f.w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(run); err != nil {
+		return err
+	}
+	_, err := io.WriteString(f.w, "\n")
+	return err
+}
+
+// newJUnitCase passes an open port, fails a closed or filtered one, skips
+// one UDP couldn't tell from filtered and counts probes that failed to run
+// as errors.
+func newJUnitCase(r result) junitCase {
+	c := junitCase{
+		Name:      strconv.Itoa(r.Port) + "/" + r.Proto,
+		ClassName: "portcheck." + r.Host,
+		Time:      junitSeconds(r.LatencyMS),
+	}
+	if r.Service != "" {
+		c.Name += " (" + strings.TrimSpace(r.Service+" "+r.Version) + ")"
+	}
+	message := r.State
+	if r.Reason != "" {
+		message += " (" + r.Reason + ")"
+	}
+	switch r.State {
+	case "open":
+		c.SystemOut = strings.Join(newReportRow(r).Details, "\n")
+	case "open|filtered":
+		c.Skipped = &junitProblem{Message: message}
+	case "closed", "filtered":
+		c.Failure = &junitProblem{Message: message, Type: r.State, Text: r.Error}
+	default:
+		c.Error = &junitProblem{Message: message, Type: r.State, Text: r.Error}
+	}
+	return c
+}
+
+func junitSeconds(ms float64) string {
+	return fmt.Sprintf("%.3f", ms/1000)
+}
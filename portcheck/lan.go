@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/netip"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/gishyanart/helper-scripts/portcheck/portscan"
+)
+
+// lanSubnet is -subnet: what lan sweeps instead of the subnets of the
+// interfaces.
+var lanSubnet netip.Prefix
+
+// subnetFlag validates -subnet as the command line sets it.
+func subnetFlag(v string) error {
+	p, err := netip.ParsePrefix(v)
+	if err != nil {
+		return err
+	}
+	if !p.Addr().Is4() {
+		return errors.New("ARP is IPv4 only")
+	}
+	lanSubnet = p.Masked()
+	return nil
+}
+
+// lanTarget is a subnet lan sweeps and the interface it's on.
+type lanTarget struct {
+	iface  string
+	prefix netip.Prefix
+}
+
+// lanHost is a line of the host list lan prints.
+type lanHost struct {
+	Type string `json:"type"`
+	portscan.Neighbor
+	Vendor string `json:"vendor,omitempty"`
+}
+
+// lanTargets are the IPv4 subnets of the Ethernet interfaces that are up,
+// or of -interface only; with -subnet, that subnet on the interface it's
+// part of.
+func lanTargets() ([]lanTarget, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+	targets := []lanTarget{}
+	for _, ifi := range ifaces {
+		if netInterface != "" && ifi.Name != netInterface {
+			continue
+		}
+		if ifi.Flags&net.FlagUp == 0 || ifi.Flags&net.FlagLoopback != 0 || len(ifi.HardwareAddr) != 6 {
+			continue
+		}
+		addrs, err := ifi.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, a := range addrs {
+			n, ok := a.(*net.IPNet)
+			if !ok {
+				continue
+			}
+			ip, _ := netip.AddrFromSlice(n.IP)
+			if ip = ip.Unmap(); !ip.Is4() {
+				continue
+			}
+			bits, _ := n.Mask.Size()
+			p := netip.PrefixFrom(ip, bits).Masked()
+			if lanSubnet.IsValid() {
+				if p.Bits() > lanSubnet.Bits() || !p.Contains(lanSubnet.Addr()) {
+					continue
+				}
+				p = lanSubnet
+			}
+			if t := (lanTarget{ifi.Name, p}); !slices.Contains(targets, t) {
+				targets = append(targets, t)
+			}
+		}
+	}
+	switch {
+	case len(targets) > 0:
+	case lanSubnet.IsValid():
+		return nil, fmt.Errorf("no interface is on %s, and ARP only reaches the local link", lanSubnet)
+	case netInterface != "":
+		return nil, fmt.Errorf("%s is not an Ethernet interface that is up with an IPv4 subnet", netInterface)
+	default:
+		return nil, errors.New("no Ethernet interface is up with an IPv4 subnet")
+	}
+	for _, t := range targets {
+		if 1<<(32-t.prefix.Bits()) > maxCIDRHosts {
+			return nil, fmt.Errorf("%s on %s has more than %d addresses; pick part of it with -subnet", t.prefix, t.iface, maxCIDRHosts)
+		}
+	}
+	return targets, nil
+}
+
+// lanHosts ARP-scans the subnets lan covers and lists the hosts that
+// answer. Listing them is all lan does when no ports are given, and then
+// the list is the output; otherwise it goes to stderr and the hosts are
+// returned to have their ports scanned.
+func lanHosts(listOnly bool) []string {
+	targets, err := lanTargets()
+	if err != nil {
+		fatal(err)
+	}
+	s, err := portscan.New(scanOptions())
+	if err != nil {
+		fatal(err)
+	}
+	defer func() { _ = s.Close() }()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	start := time.Now()
+	hosts := []lanHost{}
+	for _, t := range targets {
+		slog.Debug("ARP scanning", "interface", t.iface, "subnet", t.prefix)
+		neighbors, err := s.ARPScan(ctx, t.iface, t.prefix)
+		if err != nil {
+			fatal(err)
+		}
+		for _, n := range neighbors {
+			hosts = append(hosts, lanHost{Type: "host", Neighbor: n, Vendor: macVendor(n.MAC)})
+		}
+	}
+	slog.Info("ARP scan done", "up", len(hosts), "subnets", len(targets), "took", time.Since(start).Round(time.Millisecond))
+
+	if !listOnly {
+		_ = writeLANHosts(os.Stderr, hosts, "text", len(targets) > 1)
+		if len(hosts) == 0 {
+			os.Exit(exitNoneOpen)
+		}
+		ips := []string{}
+		for _, h := range hosts {
+			if !slices.Contains(ips, h.IP) {
+				ips = append(ips, h.IP)
+			}
+		}
+		return ips
+	}
+	var w io.Writer = os.Stdout
+	var file *outputFile
+	if outputPath != "" {
+		if file, err = createOutput(outputPath, appendOutput); err != nil {
+			fatal(err)
+		}
+		w = file
+	}
+	err = writeLANHosts(w, hosts, outputFormat, len(targets) > 1)
+	if err == nil && file != nil {
+		err = file.commit()
+	}
+	if err != nil {
+		fatal("writing output failed: ", err)
+	}
+	if len(hosts) == 0 {
+		os.Exit(exitNoneOpen)
+	}
+	os.Exit(exitOpen)
+	return nil
+}
+
+// writeLANHosts prints the host list as JSON lines for -format json or
+// jsonl, and otherwise as a table, with the interface of each host if the
+// sweep took in more than one.
+func writeLANHosts(w io.Writer, hosts []lanHost, format string, interfaces bool) error {
+	if format == "json" || format == "jsonl" {
+		enc := json.NewEncoder(w)
+		for _, h := range hosts {
+			if err := enc.Encode(h); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for _, h := range hosts {
+		line := strings.TrimSpace(fmt.Sprintf("%-15s  %-17s  %-9s %s", h.IP, h.MAC, formatLatency(h.LatencyMS), h.Vendor))
+		if interfaces {
+			line = fmt.Sprintf("%-8s %s", h.Interface, line)
+		}
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+)
+
+// Latency histograms have log-scale buckets 2% wide from 1µs up, so a
+// percentile is within 2% of the true value whatever the scale, and a host
+// costs a few kilobytes however many ports it has.
+const (
+	latencyFloorMS = 0.001
+	latencyGrowth  = 1.02
+	// 1µs * 1.02^1000 is about 400s, past any -timeout
+	latencySteps = 1000
+)
+
+type latencyHistogram struct {
+	counts []uint32
+	total  int
+	max    float64
+}
+
+func (h *latencyHistogram) observe(ms float64) {
+	i := 0
+	if ms > latencyFloorMS {
+		i = min(int(math.Ceil(math.Log(ms/latencyFloorMS)/math.Log(latencyGrowth))), latencySteps-1)
+	}
+	h.counts[i]++
+	h.total++
+	h.max = max(h.max, ms)
+}
+
+// percentile is the upper bound of the bucket the p-th percentile falls in,
+// capped at the slowest answer seen.
+func (h *latencyHistogram) percentile(p float64) float64 {
+	rank := max(int(math.Ceil(p/100*float64(h.total))), 1)
+	seen := 0
+	for i, n := range h.counts {
+		if seen += int(n); seen >= rank {
+			return min(latencyFloorMS*math.Pow(latencyGrowth, float64(i)), h.max)
+		}
+	}
+	return h.max
+}
+
+// hostLatency is what -latency reports for a host, in the JSON summary and
+// on stderr.
+type hostLatency struct {
+	Host    string  `json:"host"`
+	Answers int     `json:"answers"`
+	P50     float64 `json:"p50_ms"`
+	P90     float64 `json:"p90_ms"`
+	P99     float64 `json:"p99_ms"`
+	Max     float64 `json:"max_ms"`
+}
+
+func (l hostLatency) String() string {
+	return fmt.Sprintf("%s: %d answers, p50 %s, p90 %s, p99 %s, max %s", l.Host, l.Answers,
+		formatLatency(l.P50), formatLatency(l.P90), formatLatency(l.P99), formatLatency(l.Max))
+}
+
+// latencies collects the connect latency of every probe that got an answer,
+// open or closed, per host. Probes that timed out are left out: their
+// latency is only -timeout.
+type latencies map[string]*latencyHistogram
+
+func (l latencies) add(r result) {
+	if r.State != "open" && r.State != "closed" {
+		return
+	}
+	h := l[r.Host]
+	if h == nil {
+		h = &latencyHistogram{counts: make([]uint32, latencySteps)}
+		l[r.Host] = h
+	}
+	h.observe(r.LatencyMS)
+}
+
+// report is the percentiles of each host that answered, in address order.
+func (l latencies) report() []hostLatency {
+	hosts := []string{}
+	for host := range l {
+		hosts = append(hosts, host)
+	}
+	slices.SortFunc(hosts, compareHosts)
+	stats := []hostLatency{}
+	for _, host := range hosts {
+		h := l[host]
+		stats = append(stats, hostLatency{
+			Host:    host,
+			Answers: h.total,
+			P50:     round3(h.percentile(50)),
+			P90:     round3(h.percentile(90)),
+			P99:     round3(h.percentile(99)),
+			Max:     round3(h.max),
+		})
+	}
+	return stats
+}
+
+func round3(ms float64) float64 {
+	return math.Round(ms*1000) / 1000
+}
+
+// latencyLines is the report as text, one line per host.
+func latencyLines(stats []hostLatency) string {
+	var b strings.Builder
+	for _, l := range stats {
+		b.WriteString("latency " + l.String() + "\n")
+	}
+	return b.String()
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// logFormat is -log-format: text for people, json for log aggregators.
+var logFormat = "text"
+
+var logFormats = []string{"text", "json"}
+
+// levelTrace is what -vv adds below slog's debug level: every probe attempt.
+const levelTrace = slog.LevelDebug - 4
+
+func init() {
+	setupLogging()
+}
+
+// setupLogging points the default slog logger, which the log package and
+// portscan write through too, at stderr in -log-format, at the level -v and
+// -vv ask for.
+func setupLogging() {
+	level := slog.LevelInfo
+	switch {
+	case verbosity >= 2:
+		level = levelTrace
+	case verbosity == 1:
+		level = slog.LevelDebug
+	}
+	var h slog.Handler
+	if logFormat == "json" {
+		h = slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{
+			Level: level,
+			ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+				if a.Key == slog.LevelKey && len(groups) == 0 && a.Value.Any() == levelTrace {
+					a.Value = slog.StringValue("TRACE")
+				}
+				return a
+			},
+		})
+	} else {
+		h = &textHandler{w: os.Stderr, level: level, mu: &sync.Mutex{}}
+	}
+	slog.SetDefault(slog.New(h))
+}
+
+// textHandler writes a record a line at a time the way the log package
+// did, after the date and time, with the level for anything but info and
+// the attributes as key=value pairs:
+//
+//	2024/05/01 12:00:00 WARN queue full, dropping alert notifier=slack
+type textHandler struct {
+	w     io.Writer
+	level slog.Level
+	mu    *sync.Mutex
+	// attrs are those of WithAttrs, already formatted
+	attrs  string
+	prefix string
+}
+
+func (h *textHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level
+}
+
+func (h *textHandler) Handle(_ context.Context, r slog.Record) error {
+	var b strings.Builder
+	t := r.Time
+	if t.IsZero() {
+		t = time.Now()
+	}
+	b.WriteString(t.Format("2006/01/02 15:04:05 "))
+	switch {
+	case r.Level < slog.LevelDebug:
+		b.WriteString("TRACE ")
+	case r.Level != slog.LevelInfo:
+		b.WriteString(r.Level.String() + " ")
+	}
+	b.WriteString(r.Message)
+	b.WriteString(h.attrs)
+	r.Attrs(func(a slog.Attr) bool {
+		writeAttr(&b, h.prefix, a)
+		return true
+	})
+	b.WriteByte('\n')
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := io.WriteString(h.w, b.String())
+	return err
+}
+
+func (h *textHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	var b strings.Builder
+	for _, a := range attrs {
+		writeAttr(&b, h.prefix, a)
+	}
+	h2 := *h
+	h2.attrs += b.String()
+	return &h2
+}
+
+func (h *textHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	h2 := *h
+	h2.prefix += name + "."
+	return &h2
+}
+
+// writeAttr adds " key=value", quoting values with spaces or quotes in them
+// and flattening groups into dotted keys.
+func writeAttr(b *strings.Builder, prefix string, a slog.Attr) {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return
+	}
+	if a.Value.Kind() == slog.KindGroup {
+		if a.Key != "" {
+			prefix += a.Key + "."
+		}
+		for _, ga := range a.Value.Group() {
+			writeAttr(b, prefix, ga)
+		}
+		return
+	}
+	v := a.Value.String()
+	if v == "" || strings.ContainsFunc(v, func(c rune) bool { return c <= ' ' || c == '"' || c == '=' }) {
+		v = strconv.Quote(v)
+	}
+	fmt.Fprintf(b, " %s%s=%s", prefix, a.Key, v)
+}
+
+// logFormatFlag validates -log-format as the command line sets it.
+func logFormatFlag(v string) error {
+	if !slices.Contains(logFormats, v) {
+		return fmt.Errorf("expected one of: %s", strings.Join(logFormats, ", "))
+	}
+	logFormat = v
+	return nil
+}
@@ -1,98 +1,909 @@
 package main
 
 import (
+	"cmp"
+	"context"
+	"errors"
 	"fmt"
-	"log"
-	"net"
+	"io"
+	"log/slog"
+	"math"
+	"math/rand/v2"
 	"os"
+	"os/signal"
 	"runtime"
+	"slices"
 	"strconv"
 	"strings"
-	"sync"
+	"syscall"
 	"time"
+
+	"github.com/gishyanart/helper-scripts/portcheck/portscan"
 )
 
 var (
 	timeout = time.Second * 3
 	workers = runtime.NumCPU() * 10
+
+	outputFormat    = "text"
+	udpScan         bool
+	synScan         bool
+	sctpScan        bool
+	showAll         bool
+	showErrors      bool
+	grabBanners     bool
+	bannerBytes     = 256
+	noNames         bool
+	detectVersions  bool
+	serviceProbes   *portscan.ServiceProbes
+	tlsInspect      bool
+	tlsAudit        bool
+	sshInfo         bool
+	httpProbe       bool
+	verifyOpen      bool
+	loginChecks     bool
+	retries         int
+	rate            float64
+	probeDelay      time.Duration
+	probeJitter     time.Duration
+	topPortsN       int
+	excludePorts    string
+	excludeHosts    string
+	excludeCIDRs    string
+	randomize       bool
+	seed            uint64
+	seedSet         bool
+	noProgress      bool
+	outputPath      string
+	appendOutput    bool
+	compressOutput  bool
+	latencyReport   bool
+	noColor         bool
+	sortResults     bool
+	maxRuntime      time.Duration
+	resumePath      string
+	scanner         *portscan.Scanner
+	scanHosts       []string
+	inputList       string
+	hostnameList    string
+	ipFamily        string
+	proxyURL        string
+	sourceIP        string
+	sourcePorts     [2]int
+	netInterface    string
+	icmpReasons     bool
+	reverseDNS      bool
+	allAddresses    bool
+	dualStack       bool
+	discoverFirst   bool
+	discoverPorts   = []int{80, 443}
+	adaptiveTimeout bool
+	adaptiveWorkers bool
+	hostParallelism int
+	engine          string
+	portsFile       string
 )
 
 const (
 	portRangeEnd = 65535
+	maxWorkers   = 16384
+	// maxPollWorkers is the cap with -engine epoll, whose probes in flight
+	// cost a socket each and no goroutine
+	maxPollWorkers = 1 << 20
+	// fdReserve is the open files kept for everything but probe sockets:
+	// output, databases, reverse DNS and the follow-up checks of open ports
+	fdReserve = 128
+)
+
+// Exit codes, so scripts can gate on the result: portcheck db 5432 && deploy
+const (
+	exitOpen     = 0
+	exitNoneOpen = 1
+	exitError    = 2
+	// exitInterrupted follows the shell convention of 128 + SIGINT.
+	exitInterrupted = 130
 )
 
-func getPorts(r string) []string {
-	s := strings.Split(r, "-")
-	start, err := strconv.Atoi(s[0])
-	if err != nil || start > portRangeEnd || start < 1 {
-		return nil
+// interruptGrace caps how long an interrupted scan waits for probes already
+// in flight before printing what it has.
+const interruptGrace = 2 * time.Second
+
+// fatal reports a usage or setup error and exits before anything is scanned.
+func fatal(v ...any) {
+	slog.Error(fmt.Sprint(v...))
+	os.Exit(exitError)
+}
+
+func loadArgs() []string {
+	args := parseCommand(os.Args[1:])
+	setupLogging()
+
+	if timeout <= 0 {
+		fatal("timeout must be positive")
+	}
+	if udpScan && synScan {
+		fatal("-udp and -syn are mutually exclusive")
+	}
+	if sctpScan && (udpScan || synScan) {
+		fatal("-sctp can't be combined with -udp or -syn")
+	}
+	if retries < 0 {
+		fatal("retries must not be negative")
+	}
+	if rate < 0 {
+		fatal("rate must not be negative")
+	}
+	if probeDelay < 0 || probeJitter < 0 {
+		fatal("delay and jitter must not be negative")
+	}
+	if probeJitter > probeDelay {
+		fatal("-jitter must not exceed -delay")
+	}
+	if inputList == "-" && portsFile == "-" {
+		fatal("-iL and -ports-file can't both read stdin")
+	}
+	if hostParallelism < 0 {
+		fatal("host-parallelism must not be negative")
+	}
+	if maxRuntime < 0 {
+		fatal("max-runtime must not be negative")
+	}
+	if (subcommand.name == "monitor" && watchEvery <= 0) || serveInterval <= 0 {
+		fatal("interval must be positive")
+	}
+	if subcommand.name == "daemon" && configPath == "" {
+		fatal("daemon needs -config with a jobs list")
+	}
+	if (subcommand.name == "monitor" || subcommand.name == "daemon") && outputFormat != "text" && outputFormat != "json" {
+		fatal(subcommand.name + " supports text and json output")
+	}
+	if webhookURL != "" {
+		if err := checkWebhookURL(webhookURL); err != nil {
+			fatal(err)
+		}
+		alerts = append(alerts, newNotifier("webhook", webhookURL, webhookPayload))
+	}
+	if syslogSpec != "" {
+		var err error
+		if syslogSink, err = newSyslogWriter(syslogSpec); err != nil {
+			fatal(err)
+		}
+	}
+	if subcommand.name == "lan" && (inputList != "" || hostnameList != "" || allAddresses) {
+		fatal("lan scans the hosts ARP finds, so it can't be combined with -iL, -hostnames or -all-addresses")
+	}
+	if hostnameList != "" {
+		if inputList != "" {
+			fatal("-hostnames can't be combined with -iL")
+		}
+		if hostnameList == "-" && portsFile == "-" {
+			fatal("-hostnames and -ports-file can't both read stdin")
+		}
+		allAddresses = true
+	}
+	if manifestPath != "" {
+		if inputList != "" || allAddresses {
+			fatal("verify scans the hosts of the manifest as named there, so it can't be combined with -iL, -hostnames or -all-addresses")
+		}
+		if err := loadManifest(manifestPath); err != nil {
+			fatal(err)
+		}
+	}
+	if appendOutput && outputPath == "" {
+		fatal("-append needs -o")
+	}
+	if compressOutput && outputPath == "" {
+		fatal("-compress needs -o")
+	}
+	if strings.HasSuffix(outputPath, ".gz") {
+		compressOutput = true
+	}
+	if outputFormat == "template" && resultTemplate == nil {
+		fatal("-format template needs -template")
+	}
+	if outputFormat == "jsonl" && sortResults {
+		fatal("-format jsonl writes results as they arrive, so it can't be combined with -sort")
+	}
+	if resultTemplate != nil && outputFormat != "template" {
+		fatal("-template needs -format template")
+	}
+	if bannerBytes < 1 {
+		fatal("banner-bytes must be positive")
+	}
+	if serviceProbes != nil {
+		detectVersions = true
+		slog.Debug("loaded service probes", "patterns", serviceProbes.Matches, "skipped", serviceProbes.Skipped)
+	}
+	if synScan && ipFamily == "6" {
+		fatal("SYN scan supports IPv4 targets only")
+	}
+	if sctpScan && ipFamily == "6" {
+		fatal("SCTP scan supports IPv4 targets only")
+	}
+	if sctpScan && (dualStack || verifyOpen) {
+		fatal("-dual-stack and -verify-open need TCP, so they can't be combined with -sctp")
+	}
+	if proxyURL != "" && (udpScan || synScan || sctpScan) {
+		fatal("-proxy works with TCP connect scans only")
+	}
+	if proxyURL != "" && allAddresses {
+		fatal("-all-addresses can't be combined with -proxy, which resolves host names on its side")
+	}
+	if dualStack && allAddresses {
+		fatal("-dual-stack can't be combined with -all-addresses, which scans each address on its own")
+	}
+	if proxyURL != "" && resolver != nil {
+		fatal("-resolver can't be combined with -proxy, which resolves host names on its side")
 	}
-	if len(s) == 1 {
-		return []string{s[0]}
+	if workers < 1 {
+		slog.Warn("workers must be at least 1, using 1")
+		workers = 1
 	}
-	if len(s) > 2 {
-		return nil
+	if engine != "" && engine != "epoll" {
+		fatal("-engine must be epoll")
 	}
-	end, err := strconv.Atoi(s[1])
-	if err != nil || start > portRangeEnd || start < 1 {
-		return nil
+	if engine == "epoll" && (udpScan || synScan || sctpScan || proxyURL != "") {
+		fatal("-engine epoll runs TCP connect scans only, without -proxy")
 	}
-	toReturn := []string{}
-	for i := int64(start); i <= int64(end); i++ {
-		toReturn = append(toReturn, strconv.FormatInt(i, 10))
+	ceiling := maxWorkers
+	if engine == "epoll" {
+		ceiling = maxPollWorkers
 	}
-	return toReturn
+	if workers > ceiling {
+		slog.Warn("workers capped", "workers", ceiling)
+		workers = ceiling
+	}
+	fitOpenFileLimit()
+	return args
 }
 
-func getAddresses() []string {
-	if len(os.Args) < 2 {
-		log.Fatal("Not enough arguments. Usage: portcheck HOST [port|port-range|port1,port2,...]")
+func getAddresses(args []string) ([]string, addressList) {
+	var hosts []string
+	var err error
+	switch {
+	case subcommand.name == "verify":
+		hosts = manifestHosts
+	case subcommand.name == "lan":
+		hosts = lanHosts(len(args) == 0 && portsFile == "" && topPortsN == 0 && profilePorts == "")
+	case inputList != "":
+		hosts, err = readTargets(inputList)
+	case hostnameList != "":
+		hosts, err = readHostnames(hostnameList)
+	default:
+		if len(args) < 1 {
+			fatal("Not enough arguments. Usage: portcheck " + subcommand.name + " [flags] HOST|CIDR[,HOST|CIDR...] [port|port-range|port1,port2,...]\n" +
+				"       portcheck " + subcommand.name + " [flags] -iL FILE [port|port-range|port1,port2,...]")
+		}
+		hosts, err = expandTargets(args[0])
+		args = args[1:]
 	}
-	host := os.Args[1]
-	addresses := []string{}
-	if len(os.Args) == 2 {
-		for i := range portRangeEnd {
-			if i == 0 {
-				continue
-			}
-			addresses = append(
-				addresses,
-				net.JoinHostPort(host, strconv.FormatInt(int64(i), 10)))
-		}
-	}
-	if len(os.Args) > 2 {
-		ports := os.Args[2]
-		for i := range strings.SplitSeq(ports, ",") {
-			if r := getPorts(i); r != nil {
-				addresses = append(addresses, func(r []string) []string {
-					toReturn := []string{}
-					for _, j := range r {
-						toReturn = append(toReturn, net.JoinHostPort(host, j))
-					}
-					return toReturn
-				}(r)...)
+	if err == nil && allAddresses {
+		hosts = resolveTargets(hosts)
+		if len(hosts) == 0 {
+			err = errors.New("none of the hostnames resolve")
+		}
+	}
+	if err == nil {
+		hosts, err = excludeTargets(hosts)
+	}
+	if err != nil {
+		fatal(err)
+	}
+	if discoverFirst {
+		hosts = discoverHosts(hosts)
+	}
+	portSpec := ""
+	if len(args) > 0 {
+		portSpec = args[0]
+	}
+	if portsFile != "" {
+		fromFile, err := readPortsFile(portsFile, scanProto())
+		if err != nil {
+			fatal(err)
+		}
+		// ports given on the command line are scanned as well
+		portSpec = strings.Trim(fromFile+","+portSpec, ",")
+	}
+	if portSpec == "" && topPortsN == 0 {
+		portSpec = profilePorts
+	}
+	switch subcommand.name {
+	case "assert":
+		portSpec = assertPortSpec()
+	case "verify":
+		portSpec = manifestPortSpec()
+	}
+	ports, err := portsToScan(portSpec, topPortsN, scanProto())
+	if err != nil {
+		fatal(err)
+	}
+	addresses := interleave(hosts, ports)
+	if randomize {
+		if !seedSet {
+			seed = rand.Uint64()
+			slog.Info("randomizing probe order", "seed", seed)
+		}
+		addresses.shuffle = newPermutation(uint64(addresses.len()), seed)
+	}
+	if subcommand.name == "verify" {
+		// only the ports each host has rules for
+		addresses = manifestPairs(addresses)
+	}
+	return hosts, addresses
+}
+
+// result is what the output formats, state file and sinks all work with.
+type result = portscan.Result
+
+// formatFailures lists the categories of failed probes, most common first.
+func formatFailures(failures map[string]int) string {
+	reasons := []string{}
+	for reason := range failures {
+		reasons = append(reasons, reason)
+	}
+	slices.SortFunc(reasons, func(a, b string) int {
+		return cmp.Or(failures[b]-failures[a], strings.Compare(a, b))
+	})
+	parts := []string{}
+	for _, reason := range reasons {
+		parts = append(parts, fmt.Sprintf("%d %s", failures[reason], reason))
+	}
+	return strings.Join(parts, ", ")
+}
+
+type summary struct {
+	Type string `json:"type"`
+	// Hosts counts the hosts probed, Probed the host:port pairs
+	Hosts        int `json:"hosts"`
+	Probed       int `json:"probed"`
+	Open         int `json:"open"`
+	OpenFiltered int `json:"open_filtered,omitempty"`
+	Filtered     int `json:"filtered"`
+	Closed       int `json:"closed"`
+	Errors       int `json:"errors"`
+	// Failures breaks the probes that found no open port down by reason:
+	// refused, timeout, host-unreachable and the rest.
+	Failures map[string]int `json:"failures,omitempty"`
+	// DualStackMismatches counts ports that answered differently over
+	// IPv4 and IPv6, with -dual-stack.
+	DualStackMismatches int `json:"dual_stack_mismatches,omitempty"`
+	// TLSAudited and TLSNonCompliant count the TLS ports -tls-audit
+	// checked and those of them that accept a deprecated version or a
+	// weak cipher suite.
+	TLSAudited      int `json:"tls_audited,omitempty"`
+	TLSNonCompliant int `json:"tls_noncompliant,omitempty"`
+	// SSHServers and SSHWeak count the SSH servers -ssh-info read and
+	// those of them offering weak algorithms.
+	SSHServers int `json:"ssh_servers,omitempty"`
+	SSHWeak    int `json:"ssh_weak,omitempty"`
+	// Datastores and NoAuth count the datastores -sV learned the access
+	// control of and those of them that let anyone in.
+	Datastores int     `json:"datastores,omitempty"`
+	NoAuth     int     `json:"no_auth,omitempty"`
+	DurationMS float64 `json:"duration_ms"`
+	// Latency is the connect latency percentiles of each host, with
+	// -latency.
+	Latency []hostLatency `json:"latency,omitempty"`
+	// Providers counts the hosts and open ports of each AS, with -geoip.
+	Providers []providerCount `json:"providers,omitempty"`
+	// Netblocks are the registered blocks of the hosts with open ports,
+	// with -whois.
+	Netblocks []netblock `json:"netblocks,omitempty"`
+	// Rate is the probes per second over DurationMS.
+	Rate        float64 `json:"probes_per_second"`
+	Interrupted bool    `json:"interrupted,omitempty"`
+
+	seen map[string]bool
+}
+
+func (s *summary) count(r result) {
+	s.Probed++
+	if !s.seen[r.Host] {
+		if s.seen == nil {
+			s.seen = map[string]bool{}
+		}
+		s.seen[r.Host] = true
+		s.Hosts++
+	}
+	if r.State != "open" {
+		if s.Failures == nil {
+			s.Failures = map[string]int{}
+		}
+		s.Failures[r.Reason]++
+	}
+	if r.DualStack != nil && r.DualStack.Mismatch() {
+		s.DualStackMismatches++
+	}
+	if r.SSH != nil {
+		s.SSHServers++
+		if len(r.SSH.Weak) > 0 {
+			s.SSHWeak++
+		}
+	}
+	if r.Auth != "" {
+		s.Datastores++
+		if r.Auth == portscan.AuthNone {
+			s.NoAuth++
+		}
+	}
+	if r.TLSAudit != nil {
+		s.TLSAudited++
+		if !r.TLSAudit.Compliant() {
+			s.TLSNonCompliant++
+		}
+	}
+	switch r.State {
+	case "open":
+		s.Open++
+	case "open|filtered":
+		s.OpenFiltered++
+	case "filtered":
+		s.Filtered++
+	case "closed":
+		s.Closed++
+	default:
+		s.Errors++
+	}
+}
+
+// finish records how long the scan took, and so its rate.
+func (s *summary) finish(d time.Duration) {
+	s.DurationMS = milliseconds(d)
+	if d > 0 {
+		s.Rate = math.Round(float64(s.Probed)/d.Seconds()*10) / 10
+	}
+}
+
+// String is the summary as text output ends with, on stderr.
+func (s summary) String() string {
+	hosts := "hosts"
+	if s.Hosts == 1 {
+		hosts = "host"
+	}
+	probes := "probes"
+	if s.Probed == 1 {
+		probes = "probe"
+	}
+	d := time.Duration(s.DurationMS * float64(time.Millisecond))
+	took := formatLatency(s.DurationMS)
+	if d >= time.Second {
+		took = d.Round(10 * time.Millisecond).String()
+	}
+	rate := strconv.FormatFloat(s.Rate, 'f', 0, 64)
+	if s.Rate < 10 {
+		rate = strconv.FormatFloat(s.Rate, 'f', 1, 64)
+	}
+	return fmt.Sprintf("%d %s, %d %s in %s at %s/s: %s", s.Hosts, hosts, s.Probed, probes, took, rate, s.counts())
+}
+
+// counts is the probes in each state, and why those that found no open
+// port failed.
+func (s summary) counts() string {
+	counts := fmt.Sprintf("%d open", s.Open)
+	if s.OpenFiltered > 0 {
+		counts += fmt.Sprintf(", %d open|filtered", s.OpenFiltered)
+	}
+	counts += fmt.Sprintf(", %d closed, %d filtered, %d errors", s.Closed, s.Filtered, s.Errors)
+	if len(s.Failures) > 0 {
+		counts += " (" + formatFailures(s.Failures) + ")"
+	}
+	return counts
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// formatLatency renders a latency in milliseconds for human-readable output.
+func formatLatency(ms float64) string {
+	return strconv.FormatFloat(ms, 'f', 2, 64) + "ms"
+}
+
+// network narrows proto ("tcp", "udp" or "ip") to the family chosen with -4
+// or -6, which makes the resolver return only A or AAAA records.
+func network(proto string) string {
+	return proto + ipFamily
+}
+
+// scanProto is the protocol the probe flags scan: "tcp", "udp" or "sctp".
+func scanProto() string {
+	switch {
+	case udpScan:
+		return "udp"
+	case sctpScan:
+		return "sctp"
+	}
+	return "tcp"
+}
+
+// portsToScan expands a port spec of proto, adds the -top-ports preset of
+// size topN (if not zero) and drops -exclude-ports. An empty spec without
+// a preset means every port.
+func portsToScan(spec string, topN int, proto string) ([]string, error) {
+	if topN > 0 {
+		top, err := topPorts(proto, topN)
+		if err != nil {
+			return nil, err
+		}
+		// explicit ports are scanned on top of the preset
+		if spec != "" {
+			top += "," + spec
+		}
+		spec = top
+	}
+	ports := allPorts()
+	if spec != "" {
+		var err error
+		if ports, err = parsePorts(spec, proto); err != nil {
+			return nil, err
+		}
+	}
+	if excludePorts != "" {
+		excluded, err := parsePorts(excludePorts, proto)
+		if err != nil {
+			return nil, fmt.Errorf("-exclude-ports: %w", err)
+		}
+		skip := map[string]bool{}
+		for _, port := range excluded {
+			skip[port] = true
+		}
+		ports = slices.DeleteFunc(ports, func(port string) bool { return skip[port] })
+	}
+	if len(ports) == 0 {
+		return nil, errors.New("no ports left to scan")
+	}
+	return ports, nil
+}
+
+// scanOptions maps the probe flags onto the engine's options.
+func scanOptions() portscan.Options {
+	return portscan.Options{
+		Timeout:         timeout,
+		AdaptiveTimeout: adaptiveTimeout,
+		Workers:         workers,
+		AdaptiveWorkers: adaptiveWorkers,
+		HostParallelism: hostParallelism,
+		Engine:          engine,
+		UDP:             udpScan,
+		SYN:             synScan,
+		SCTP:            sctpScan,
+		Family:          ipFamily,
+		DualStack:       dualStack,
+		Retries:         retries,
+		Rate:            rate,
+		Delay:           probeDelay,
+		Jitter:          probeJitter,
+		Banners:         grabBanners,
+		BannerBytes:     bannerBytes,
+		DetectVersions:  detectVersions,
+		ServiceProbes:   serviceProbes,
+		TLSInfo:         tlsInspect,
+		TLSAudit:        tlsAudit,
+		SSHInfo:         sshInfo,
+		HTTPProbe:       httpProbe,
+		VerifyOpen:      verifyOpen,
+		LoginChecks:     loginChecks,
+		ServiceNames:    !noNames,
+		ReverseDNS:      reverseDNS,
+		Resolver:        resolver,
+		Proxy:           proxyURL,
+		SourceIP:        sourceIP,
+		SourcePort:      sourcePorts[0],
+		SourcePortEnd:   sourcePorts[1],
+		Interface:       netInterface,
+		ICMPReasons:     icmpReasons,
+		OnAttempt:       logProbe,
+	}
+}
+
+// scan feeds addresses to the scanner and streams the results. No new probes
+// start after launch ends; probes already running are bounded by probeCtx.
+func scan(launch, probeCtx context.Context, addresses addressList) <-chan result {
+	feed := make(chan string)
+	go func() {
+		defer close(feed)
+		for address := range addresses.all() {
+			select {
+			case feed <- address:
+			case <-launch.Done():
+				return
 			}
 		}
+	}()
+	results := scanner.ScanUntil(launch, probeCtx, feed)
+	if len(targetNames) == 0 && len(geoSources) == 0 {
+		return results
 	}
-	return addresses
+	// label the addresses -all-addresses found with the names they came
+	// from, and with -geoip who announces them and where
+	labelled := make(chan result)
+	go func() {
+		defer close(labelled)
+		for r := range results {
+			if names := targetNames[r.Host]; len(names) > 0 {
+				r.Hostname = names[0]
+				if len(names) > 1 {
+					r.Names = names
+				}
+			}
+			if len(geoSources) > 0 {
+				g := geoLookup(r.Host)
+				r.ASN, r.ASOrg, r.Country = g.ASN, g.Org, g.Country
+			}
+			labelled <- r
+		}
+	}()
+	return labelled
 }
 
 func main() {
-	workerChan := make(chan struct{}, workers)
-	addresses := getAddresses()
-	wg := sync.WaitGroup{}
-	for _, address := range addresses {
-		workerChan <- struct{}{}
-		wg.Go(func() {
-			conn, _ := net.DialTimeout("tcp", address, timeout)
-			defer func() { <-workerChan }()
-			if conn != nil {
-				_, _ = fmt.Fprintf(os.Stdout, "SUCCESS: %s\n", address)
-				if errE := conn.Close(); errE != nil {
-					fmt.Fprintf(os.Stderr, "error closing connection: %s\n", errE)
-				}
+	args := loadArgs()
+	var (
+		addresses addressList
+		err       error
+	)
+	// serve without targets only runs the scan API; daemon jobs bring
+	// their own
+	if subcommand.name != "daemon" && (subcommand.name != "serve" || len(args) > 0 || inputList != "" || hostnameList != "") {
+		scanHosts, addresses = getAddresses(args)
+	}
+	total := addresses.len()
+	logResolution(scanHosts)
+	var state *stateFile
+	if resumePath != "" {
+		if state, err = openState(resumePath, os.Args[1:]); err != nil {
+			fatal(err)
+		}
+		addresses = addresses.without(state.done)
+		if len(state.done) > 0 {
+			slog.Info("resuming", "done", len(state.done), "probes", total)
+		}
+	}
+	opts := scanOptions()
+	// No point holding more slots than there are addresses to probe
+	opts.Workers = max(min(workers, addresses.len()), 1)
+	scanner, err = portscan.New(opts)
+	if err != nil {
+		fatal(err)
+	}
+	// scanCtx bounds the whole scan and cancels dials in flight when
+	// -max-runtime runs out; ctx also ends on Ctrl-C, which only stops new
+	// probes from starting.
+	scanCtx, cancel := context.WithCancel(context.Background())
+	if maxRuntime > 0 {
+		scanCtx, cancel = context.WithTimeout(context.Background(), maxRuntime)
+	}
+	defer cancel()
+	ctx, stop := signal.NotifyContext(scanCtx, os.Interrupt, syscall.SIGTERM)
+	switch subcommand.name {
+	case "monitor":
+		watch(ctx, addresses, os.Stdout)
+		return
+	case "serve":
+		if err := serve(ctx, addresses); err != nil {
+			fatal(err)
+		}
+		return
+	case "daemon":
+		if err := runDaemon(ctx); err != nil {
+			fatal(err)
+		}
+		return
+	}
+	var store *resultsDB
+	if dbPath != "" {
+		if store, err = openResultsDB(dbPath, os.Args[1:]); err != nil {
+			fatal(err)
+		}
+	}
+	var dest io.Writer = os.Stdout
+	var file *outputFile
+	if outputPath != "" {
+		open := createOutput
+		if outputFormat == "jsonl" {
+			open = openStream
+		}
+		if file, err = open(outputPath, appendOutput); err != nil {
+			fatal(err)
+		}
+		if compressOutput {
+			file.compress()
+		}
+		dest = file
+	}
+	var out formatter
+	var diff *diffFormatter
+	var assertion *assertFormatter
+	switch subcommand.name {
+	case "diff":
+		diff, err = newDiffFormatter(baselinePath, outputFormat, dest)
+		out = diff
+	case "assert", "verify":
+		assertion, err = newAssertFormatter(outputFormat, dest)
+		out = assertion
+	default:
+		out, err = newFormatter(outputFormat, dest)
+	}
+	if err != nil {
+		if file != nil {
+			file.abort()
+		}
+		fatal(err)
+	}
+	start := time.Now()
+	results := scan(ctx, scanCtx, addresses)
+
+	sum := summary{Type: "summary"}
+	unresolved := map[string]bool{}
+	var opened []portKey
+	var lat latencies
+	if latencyReport {
+		lat = latencies{}
+	}
+	var prov *providers
+	if len(geoSources) > 0 {
+		prov = newProviders()
+	}
+	var whoisHosts map[string]int
+	if whoisLookup {
+		whoisHosts = map[string]int{}
+	}
+	tally := func(r result) {
+		if store != nil {
+			store.record(r)
+		}
+		sum.count(r)
+		if lat != nil {
+			lat.add(r)
+		}
+		if prov != nil {
+			prov.add(r)
+		}
+		if whoisHosts != nil && r.State == "open" {
+			whoisHosts[r.Host]++
+		}
+		if r.Reason == "dns-failure" && !unresolved[r.Host] {
+			unresolved[r.Host] = true
+			slog.Error("resolve failed", "host", r.Host, "err", r.Error)
+		}
+		if r.State == "open" && len(alerts) > 0 {
+			opened = append(opened, portKey{r.Host, r.Port, r.Proto})
+		}
+		out.result(r)
+	}
+	if state != nil {
+		for _, r := range state.done {
+			tally(r)
+		}
+	}
+	prog := newProgress(addresses.len())
+	interrupted := ctx.Done()
+	var grace <-chan time.Time
+scan:
+	for {
+		var r result
+		select {
+		case res, ok := <-results:
+			if !ok {
+				break scan
+			}
+			r = res
+		case <-interrupted:
+			if scanCtx.Err() != nil {
+				sum.Interrupted = true
+				prog.clear()
+				slog.Warn("max runtime reached, stopping", "max_runtime", maxRuntime)
+				break scan
 			}
-		})
+			// Stop listening so a second Ctrl-C kills the process outright
+			stop()
+			interrupted = nil
+			sum.Interrupted = true
+			grace = time.After(min(timeout, interruptGrace))
+			prog.clear()
+			slog.Warn("interrupted, waiting for probes in flight")
+			continue
+		case <-grace:
+			break scan
+		}
+		prog.clear()
+		prog.advance()
+		if state != nil {
+			state.record(r)
+		}
+		if syslogSink != nil && (r.State == "open" || showAll) {
+			syslogSink.result(r)
+		}
+		tally(r)
+	}
+	prog.finish()
+	if state != nil {
+		state.close(!sum.Interrupted)
+	}
+	if len(opened) > 0 {
+		slices.SortFunc(opened, comparePortKeys)
+		notifyAll(alert{text: openPortsText(opened)})
+	}
+	closeAlerts()
+	sum.finish(time.Since(start))
+	if store != nil {
+		if err := store.finish(sum); err != nil {
+			slog.Error("writing to database failed", "db", dbPath, "err", err)
+		}
+	}
+	if lat != nil {
+		sum.Latency = lat.report()
+	}
+	if prov != nil {
+		sum.Providers = prov.report()
+	}
+	if len(whoisHosts) > 0 {
+		sum.Netblocks = whoisReport(whoisHosts)
+	}
+	err = out.finish(sum)
+	if err == nil && file != nil {
+		err = file.commit()
+	}
+	if err != nil {
+		slog.Error("writing output failed", "err", err)
+	}
+	// after the output, which text prints at the end when grouping by host
+	if (subcommand.name == "scan" || subcommand.name == "lan") && outputFormat == "text" {
+		fmt.Fprintf(os.Stderr, "summary: %s\n", sum)
+	} else if showErrors && len(sum.Failures) > 0 {
+		fmt.Fprintf(os.Stderr, "failures by category: %s\n", formatFailures(sum.Failures))
+	}
+	if len(sum.Latency) > 0 {
+		fmt.Fprint(os.Stderr, latencyLines(sum.Latency))
+	}
+	if len(sum.Providers) > 0 {
+		fmt.Fprint(os.Stderr, providerLines(sum.Providers))
+	}
+	if len(sum.Netblocks) > 0 {
+		fmt.Fprint(os.Stderr, netblockLines(sum.Netblocks))
+	}
+	if dualStack && sum.DualStackMismatches > 0 {
+		fmt.Fprintf(os.Stderr, "dual-stack: %d of %d ports answered differently over IPv4 and IPv6\n", sum.DualStackMismatches, sum.Probed)
+	}
+	if sshInfo && sum.SSHServers > 0 {
+		fmt.Fprintf(os.Stderr, "ssh-info: %d of %d SSH servers offer weak algorithms\n", sum.SSHWeak, sum.SSHServers)
+	}
+	if sum.Datastores > 0 {
+		fmt.Fprintf(os.Stderr, "datastores: %d of %d accept connections without authentication\n", sum.NoAuth, sum.Datastores)
+	}
+	if tlsAudit && sum.TLSAudited > 0 {
+		fmt.Fprintf(os.Stderr, "tls-audit: %d of %d TLS ports accept deprecated versions or weak cipher suites\n", sum.TLSNonCompliant, sum.TLSAudited)
+	}
+	switch {
+	case sum.Interrupted:
+		fmt.Fprintf(os.Stderr, "scan interrupted after %d of %d probes\n", sum.Probed, total)
+		if state != nil {
+			fmt.Fprintf(os.Stderr, "run the same command again to resume from %s\n", resumePath)
+		}
+		if scanCtx.Err() != nil {
+			os.Exit(exitError)
+		}
+		os.Exit(exitInterrupted)
+	case len(unresolved) > 0:
+		os.Exit(exitError)
+	case diff != nil:
+		// like diff(1): 0 when nothing changed, 1 when something did
+		if diff.changes > 0 {
+			os.Exit(exitNoneOpen)
+		}
+		os.Exit(exitOpen)
+	case assertion != nil:
+		switch {
+		case assertion.violations > 0 && subcommand.name == "verify":
+			fmt.Fprintf(os.Stderr, "verify: %d of %d ports drifted from %s\n", assertion.violations, assertion.checks, manifestPath)
+			os.Exit(exitNoneOpen)
+		case assertion.violations > 0:
+			fmt.Fprintf(os.Stderr, "assert: %d of %d checks failed\n", assertion.violations, assertion.checks)
+			os.Exit(exitNoneOpen)
+		}
+		os.Exit(exitOpen)
+	case sum.Open == 0:
+		os.Exit(exitNoneOpen)
 	}
-	wg.Wait()
+	os.Exit(exitOpen)
 }
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+
+	"gopkg.in/yaml.v3"
+)
+
+// manifestPath is the manifest `portcheck verify` checks the hosts against,
+// and manifestRules what it declares per host, CIDRs expanded.
+var (
+	manifestPath  string
+	manifestRules map[string]portRules
+	manifestHosts []string
+)
+
+// manifestHost is what a manifest declares for a host or CIDR.
+type manifestHost struct {
+	Open   string `yaml:"open"`
+	Closed string `yaml:"closed"`
+}
+
+// loadManifest reads a manifest, a hosts mapping from hosts and CIDRs to
+// the ports that must be open and closed on them:
+//
+//	hosts:
+//	  web01.example.com:
+//	    open: 80,443
+//	    closed: 22,3306
+//	  10.0.0.0/28:
+//	    closed: 23,3389
+//
+// A host covered by several entries, a name and a CIDR say, must meet them
+// all.
+func loadManifest(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var doc struct {
+		Hosts yaml.Node `yaml:"hosts"`
+	}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	// decode the hosts again, strictly, so misspelled keys are caught
+	hostsYAML, err := yaml.Marshal(&doc.Hosts)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	var entries map[string]manifestHost
+	dec := yaml.NewDecoder(bytes.NewReader(hostsYAML))
+	dec.KnownFields(true)
+	if err := dec.Decode(&entries); err != nil {
+		return fmt.Errorf("%s: hosts: %w", path, err)
+	}
+	if len(entries) == 0 {
+		return fmt.Errorf("%s: no hosts", path)
+	}
+	names := []string{}
+	for name := range entries {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	manifestRules = map[string]portRules{}
+	for _, name := range names {
+		entry := entries[name]
+		if entry.Open == "" && entry.Closed == "" {
+			return fmt.Errorf("%s: %s: no open or closed ports", path, name)
+		}
+		rules, err := parseRules(entry.Open, entry.Closed)
+		if err != nil {
+			return fmt.Errorf("%s: %s: %w", path, name, err)
+		}
+		hosts, err := expandTargets(name)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		for _, host := range hosts {
+			if manifestRules[host] == nil {
+				manifestRules[host] = portRules{}
+				manifestHosts = append(manifestHosts, host)
+			}
+			for port, state := range rules {
+				if was := manifestRules[host][port]; was != "" && was != state {
+					return fmt.Errorf("%s: %s: port %d can't be both open and closed", path, host, port)
+				}
+				manifestRules[host][port] = state
+			}
+		}
+	}
+	return nil
+}
+
+// manifestPortSpec is every port the manifest has a rule for, on any host.
+func manifestPortSpec() string {
+	all := portRules{}
+	for _, rules := range manifestRules {
+		for port, state := range rules {
+			all[port] = state
+		}
+	}
+	return all.spec()
+}
+
+// manifestPairs narrows addresses to the pairs of hosts and ports the
+// manifest has a rule for, without listing them: a /16 over every port is
+// billions of pairs.
+func manifestPairs(addresses addressList) addressList {
+	listed := map[int]bool{}
+	for _, port := range addresses.ports {
+		n, _ := strconv.Atoi(port)
+		listed[n] = true
+	}
+	kept := 0
+	for _, host := range addresses.hosts {
+		for port := range manifestRules[host] {
+			if listed[port] {
+				kept++
+			}
+		}
+	}
+	return addresses.only(func(host, port string) bool {
+		n, _ := strconv.Atoi(port)
+		return manifestRules[host][n] != ""
+	}, kept)
+}
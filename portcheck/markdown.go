@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// markdownFormatter writes a table per host, GitHub-flavored, once the scan
+// is done, for pasting into issues, wikis and runbooks.
+type markdownFormatter struct {
+	w       io.Writer
+	results []result
+}
+
+func (f *markdownFormatter) result(r result) {
+	f.results = append(f.results, r)
+}
+
+func (f *markdownFormatter) finish(s summary) error {
+	var b strings.Builder
+	end := time.Now()
+	fmt.Fprintf(&b, "## portcheck results\n\n- Command: `%s`\n- Finished: %s", mdCode(commandLine()), end.Format(time.RFC1123))
+	if s.Interrupted {
+		b.WriteString(" (interrupted)")
+	}
+	fmt.Fprintf(&b, "\n- Duration: %s\n- Hosts: %d\n- Probes: %d: %d open, %d closed, %d filtered, %d errors\n",
+		formatLatency(s.DurationMS), len(scanHosts), s.Probed, s.Open, s.Closed, s.Filtered, s.Errors)
+	for _, h := range reportHosts(f.results) {
+		b.WriteString("\n### " + mdEscape(h.Host))
+		if h.Hostname != "" {
+			b.WriteString(" (" + mdEscape(h.Hostname) + ")")
+		}
+		b.WriteString("\n\n")
+		if len(h.Rows) == 0 {
+			b.WriteString("No open ports.\n")
+			continue
+		}
+		// columns only some ports have are left out when none do
+		auth, details := false, false
+		for _, row := range h.Rows {
+			auth = auth || row.Auth != ""
+			details = details || len(row.Details) > 0
+		}
+		header := []string{"Port", "Proto", "State"}
+		if showAll || showErrors {
+			header = append(header, "Reason")
+		}
+		header = append(header, "Service", "Version")
+		if auth {
+			header = append(header, "Auth")
+		}
+		header = append(header, "Latency")
+		if details {
+			header = append(header, "Details")
+		}
+		mdRow(&b, header)
+		rule := []string{}
+		for range header {
+			rule = append(rule, "---")
+		}
+		mdRow(&b, rule)
+		for _, row := range h.Rows {
+			cells := []string{strconv.Itoa(row.Port), row.Proto, row.State}
+			if showAll || showErrors {
+				cells = append(cells, row.Reason)
+			}
+			cells = append(cells, row.Service, row.Version)
+			if auth {
+				cells = append(cells, row.Auth)
+			}
+			cells = append(cells, row.Latency)
+			for i := range cells {
+				cells[i] = mdEscape(cells[i])
+			}
+			if details {
+				lines := []string{}
+				for _, d := range row.Details {
+					lines = append(lines, mdEscape(d))
+				}
+				cells = append(cells, strings.Join(lines, "<br>"))
+			}
+			mdRow(&b, cells)
+		}
+	}
+	_, err := io.WriteString(f.w, b.String())
+	return err
+}
+
+func mdRow(b *strings.Builder, cells []string) {
+	b.WriteString("| " + strings.Join(cells, " | ") + " |\n")
+}
+
+// mdEscape keeps s from breaking out of a table cell or turning into
+// markup: pipes and the characters Markdown and HTML treat specially are
+// escaped, and line breaks become spaces.
+func mdEscape(s string) string {
+	var b strings.Builder
+	for _, c := range strings.NewReplacer("\r\n", " ", "\n", " ", "\r", " ").Replace(s) {
+		switch c {
+		case '\\', '|', '*', '_', '`', '[', ']', '<', '>', '#', '~':
+			b.WriteByte('\\')
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+// mdCode is s for an inline code span, which can't escape anything: a
+// backtick becomes a quote, and a pipe, which still ends a table cell on
+// GitHub, is left alone outside tables.
+func mdCode(s string) string {
+	return strings.ReplaceAll(s, "`", "'")
+}
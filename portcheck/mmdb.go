@@ -0,0 +1,265 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"net/netip"
+	"os"
+)
+
+// mmdb reads MaxMind DB files (https://maxmind.github.io/MaxMind-DB/), the
+// format GeoLite2, DB-IP and IPinfo ship their databases in, as far as
+// looking up the record of an address. The whole file is held in memory.
+type mmdb struct {
+	tree       []byte
+	data       []byte
+	nodeCount  uint
+	recordSize uint
+	ipVersion  uint
+	// ipv4Start is the node ::/96 leads to, where IPv4 lookups start in an
+	// IPv6 tree
+	ipv4Start uint
+}
+
+var mmdbMetadataMarker = []byte("\xab\xcd\xefMaxMind.com")
+
+var errMMDBCorrupt = errors.New("corrupt MaxMind DB data")
+
+func openMMDB(path string) (*mmdb, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	i := bytes.LastIndex(buf, mmdbMetadataMarker)
+	if i < 0 {
+		return nil, fmt.Errorf("%s is not a MaxMind DB file", path)
+	}
+	v, _, err := mmdbDecoder{buf[i+len(mmdbMetadataMarker):]}.decode(0, 0)
+	if err != nil {
+		return nil, fmt.Errorf("%s: reading metadata: %w", path, err)
+	}
+	meta, ok := v.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("%s: reading metadata: %w", path, errMMDBCorrupt)
+	}
+	db := &mmdb{
+		nodeCount:  mmdbUint(meta["node_count"]),
+		recordSize: mmdbUint(meta["record_size"]),
+		ipVersion:  mmdbUint(meta["ip_version"]),
+	}
+	if db.recordSize != 24 && db.recordSize != 28 && db.recordSize != 32 {
+		return nil, fmt.Errorf("%s: unsupported record size %d", path, db.recordSize)
+	}
+	// the tree, 16 zero bytes, then the data section up to the metadata
+	treeSize := db.recordSize * 2 / 8 * db.nodeCount
+	if treeSize+16 > uint(i) {
+		return nil, fmt.Errorf("%s: %w", path, errMMDBCorrupt)
+	}
+	db.tree, db.data = buf[:treeSize], buf[treeSize+16:i]
+	if db.ipVersion == 6 {
+		node := uint(0)
+		for range 96 {
+			if node >= db.nodeCount {
+				break
+			}
+			node = db.record(node, 0)
+		}
+		db.ipv4Start = node
+	}
+	return db, nil
+}
+
+// record is the left (bit 0) or right (bit 1) record of a tree node.
+func (db *mmdb) record(node, bit uint) uint {
+	switch db.recordSize {
+	case 24:
+		b := db.tree[node*6+bit*3:]
+		return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+	case 28:
+		b := db.tree[node*7:]
+		if bit == 0 {
+			return uint(b[3]&0xf0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+		}
+		return uint(b[3]&0x0f)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6])
+	default:
+		return uint(binary.BigEndian.Uint32(db.tree[node*8+bit*4:]))
+	}
+}
+
+// lookup returns the record of ip, decoded into maps, slices, strings and
+// numbers, or nil if the database has none.
+func (db *mmdb) lookup(ip netip.Addr) (any, error) {
+	ip = ip.Unmap()
+	node := uint(0)
+	if ip.Is4() && db.ipVersion == 6 {
+		node = db.ipv4Start
+	} else if ip.Is6() && db.ipVersion == 4 {
+		return nil, nil
+	}
+	addr := ip.AsSlice()
+	for i := 0; i < len(addr)*8 && node < db.nodeCount; i++ {
+		node = db.record(node, uint(addr[i/8]>>(7-i%8))&1)
+	}
+	switch {
+	case node == db.nodeCount:
+		return nil, nil
+	case node < db.nodeCount:
+		return nil, errMMDBCorrupt
+	}
+	v, _, err := mmdbDecoder{db.data}.decode(node-db.nodeCount-16, 0)
+	return v, err
+}
+
+// mmdbDecoder decodes values of the data section format, which the
+// metadata is written in too.
+type mmdbDecoder struct {
+	buf []byte
+}
+
+// decode returns the value at off and the offset after it. depth bounds
+// the nesting, and so a pointer loop in a corrupt file.
+func (d mmdbDecoder) decode(off uint, depth int) (any, uint, error) {
+	if depth > 32 {
+		return nil, 0, errMMDBCorrupt
+	}
+	b, err := d.bytes(off, 1)
+	if err != nil {
+		return nil, 0, err
+	}
+	ctrl := b[0]
+	off++
+	typ := uint(ctrl >> 5)
+	if typ == 1 {
+		// a pointer: its size bits are part of the offset
+		n := uint(ctrl>>3&3) + 1
+		b, err := d.bytes(off, n)
+		if err != nil {
+			return nil, 0, err
+		}
+		ptr := uint(ctrl & 7)
+		if n == 4 {
+			ptr = 0
+		}
+		for _, c := range b {
+			ptr = ptr<<8 | uint(c)
+		}
+		ptr += [...]uint{0, 2048, 526336, 0}[n-1]
+		v, _, err := d.decode(ptr, depth+1)
+		return v, off + n, err
+	}
+	if typ == 0 {
+		b, err := d.bytes(off, 1)
+		if err != nil {
+			return nil, 0, err
+		}
+		typ = 7 + uint(b[0])
+		off++
+	}
+	size := uint(ctrl & 0x1f)
+	if size >= 29 {
+		n := size - 28
+		b, err := d.bytes(off, n)
+		if err != nil {
+			return nil, 0, err
+		}
+		size = 0
+		for _, c := range b {
+			size = size<<8 | uint(c)
+		}
+		size += [...]uint{29, 285, 65821}[n-1]
+		off += n
+	}
+
+	switch typ {
+	case 7: // map
+		m := make(map[string]any, min(size, 64))
+		for range size {
+			k, next, err := d.decode(off, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			key, ok := k.(string)
+			if !ok {
+				return nil, 0, errMMDBCorrupt
+			}
+			if m[key], off, err = d.decode(next, depth+1); err != nil {
+				return nil, 0, err
+			}
+		}
+		return m, off, nil
+	case 11: // array
+		a := make([]any, 0, min(size, 64))
+		for range size {
+			v, next, err := d.decode(off, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			a = append(a, v)
+			off = next
+		}
+		return a, off, nil
+	case 14: // boolean, in the size bits
+		return size != 0, off, nil
+	}
+	b, err = d.bytes(off, size)
+	if err != nil {
+		return nil, 0, err
+	}
+	off += size
+	switch typ {
+	case 2: // UTF-8 string
+		return string(b), off, nil
+	case 4: // bytes
+		return bytes.Clone(b), off, nil
+	case 3: // double
+		if size != 8 {
+			return nil, 0, errMMDBCorrupt
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), off, nil
+	case 15: // float
+		if size != 4 {
+			return nil, 0, errMMDBCorrupt
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(b))), off, nil
+	case 5, 6, 9: // uint16, uint32, uint64
+		if size > 8 {
+			return nil, 0, errMMDBCorrupt
+		}
+		var n uint64
+		for _, c := range b {
+			n = n<<8 | uint64(c)
+		}
+		return n, off, nil
+	case 8: // int32
+		if size > 4 {
+			return nil, 0, errMMDBCorrupt
+		}
+		var n uint32
+		for _, c := range b {
+			n = n<<8 | uint32(c)
+		}
+		if size == 4 {
+			return int64(int32(n)), off, nil
+		}
+		return int64(n), off, nil
+	case 10: // uint128
+		return new(big.Int).SetBytes(b), off, nil
+	}
+	return nil, 0, fmt.Errorf("unsupported MaxMind DB data type %d", typ)
+}
+
+func (d mmdbDecoder) bytes(off, n uint) ([]byte, error) {
+	if off+n > uint(len(d.buf)) || off+n < off {
+		return nil, errMMDBCorrupt
+	}
+	return d.buf[off : off+n], nil
+}
+
+func mmdbUint(v any) uint {
+	n, _ := v.(uint64)
+	return uint(n)
+}
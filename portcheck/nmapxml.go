@@ -0,0 +1,339 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The element and attribute names below follow nmap.dtd closely enough for
+// ndiff and the usual importers; only the parts portcheck can fill are kept.
+
+type nmapRun struct {
+	XMLName          xml.Name     `xml:"nmaprun"`
+	Scanner          string       `xml:"scanner,attr"`
+	Args             string       `xml:"args,attr"`
+	Start            int64        `xml:"start,attr"`
+	StartStr         string       `xml:"startstr,attr"`
+	Version          string       `xml:"version,attr"`
+	XMLOutputVersion string       `xml:"xmloutputversion,attr"`
+	ScanInfo         nmapScanInfo `xml:"scaninfo"`
+	Hosts            []nmapHost   `xml:"host"`
+	RunStats         nmapRunStats `xml:"runstats"`
+}
+
+type nmapScanInfo struct {
+	Type        string `xml:"type,attr"`
+	Protocol    string `xml:"protocol,attr"`
+	NumServices int    `xml:"numservices,attr"`
+	Services    string `xml:"services,attr"`
+}
+
+type nmapHost struct {
+	Status    nmapStatus     `xml:"status"`
+	Address   nmapAddress    `xml:"address"`
+	Hostnames []nmapHostname `xml:"hostnames>hostname"`
+	Ports     nmapPorts      `xml:"ports"`
+	Times     *nmapTimes     `xml:"times"`
+}
+
+// nmapTimes holds round-trip statistics in microseconds, as nmap does.
+type nmapTimes struct {
+	SRTT   int64 `xml:"srtt,attr"`
+	RTTVar int64 `xml:"rttvar,attr"`
+	To     int64 `xml:"to,attr"`
+}
+
+type nmapStatus struct {
+	State  string `xml:"state,attr"`
+	Reason string `xml:"reason,attr"`
+}
+
+type nmapAddress struct {
+	Addr     string `xml:"addr,attr"`
+	AddrType string `xml:"addrtype,attr"`
+}
+
+type nmapHostname struct {
+	Name string `xml:"name,attr"`
+	Type string `xml:"type,attr"`
+}
+
+type nmapPorts struct {
+	ExtraPorts []nmapExtraPorts `xml:"extraports"`
+	Ports      []nmapPort       `xml:"port"`
+}
+
+type nmapExtraPorts struct {
+	State   string            `xml:"state,attr"`
+	Count   int               `xml:"count,attr"`
+	Reasons []nmapExtraReason `xml:"extrareasons"`
+}
+
+type nmapExtraReason struct {
+	Reason string `xml:"reason,attr"`
+	Count  int    `xml:"count,attr"`
+}
+
+type nmapPort struct {
+	Protocol string        `xml:"protocol,attr"`
+	PortID   int           `xml:"portid,attr"`
+	State    nmapPortState `xml:"state"`
+	Service  *nmapService  `xml:"service"`
+	Scripts  []nmapScript  `xml:"script"`
+}
+
+type nmapService struct {
+	Name    string `xml:"name,attr"`
+	Product string `xml:"product,attr,omitempty"`
+	Extra   string `xml:"extrainfo,attr,omitempty"`
+	Method  string `xml:"method,attr"`
+	Conf    int    `xml:"conf,attr"`
+}
+
+// nmapScript carries extra findings the way NSE scripts report them, e.g.
+// the banner script.
+type nmapScript struct {
+	ID     string `xml:"id,attr"`
+	Output string `xml:"output,attr"`
+}
+
+type nmapPortState struct {
+	State     string `xml:"state,attr"`
+	Reason    string `xml:"reason,attr"`
+	ReasonTTL int    `xml:"reason_ttl,attr"`
+}
+
+type nmapRunStats struct {
+	Finished nmapFinished `xml:"finished"`
+	Hosts    nmapHostStat `xml:"hosts"`
+}
+
+type nmapFinished struct {
+	Time    int64  `xml:"time,attr"`
+	TimeStr string `xml:"timestr,attr"`
+	Elapsed string `xml:"elapsed,attr"`
+	Summary string `xml:"summary,attr"`
+	Exit    string `xml:"exit,attr"`
+}
+
+type nmapHostStat struct {
+	Up    int `xml:"up,attr"`
+	Down  int `xml:"down,attr"`
+	Total int `xml:"total,attr"`
+}
+
+func nmapReason(proto, state string) string {
+	switch {
+	case state == "open" && proto == "udp":
+		return "udp-response"
+	case state == "open" && proto == "sctp":
+		return "init-ack"
+	case state == "open":
+		return "syn-ack"
+	case state == "closed" && proto == "udp":
+		return "port-unreach"
+	case state == "closed" && proto == "sctp":
+		return "abort"
+	case state == "closed":
+		return "conn-refused"
+	}
+	return "no-response"
+}
+
+// nmapAddr returns the address nmap would report for host, resolving names
+// since the schema requires an IP in <address>.
+func nmapAddr(host string) nmapAddress {
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		ips, err := lookupResolver().LookupNetIP(context.Background(), network("ip"), host)
+		if err != nil || len(ips) == 0 {
+			return nmapAddress{Addr: host, AddrType: "ipv" + cmp.Or(ipFamily, "4")}
+		}
+		addr = ips[0].Unmap()
+	}
+	if addr.Is6() {
+		return nmapAddress{Addr: addr.String(), AddrType: "ipv6"}
+	}
+	return nmapAddress{Addr: addr.String(), AddrType: "ipv4"}
+}
+
+type nmapFormatter struct {
+	w       io.Writer
+	results []result
+}
+
+func (f *nmapFormatter) result(r result) {
+	f.results = append(f.results, r)
+}
+
+func (f *nmapFormatter) finish(s summary) error {
+	end := time.Now()
+	start := end.Add(-time.Duration(s.DurationMS * float64(time.Millisecond)))
+	run := nmapRun{
+		Scanner:          "portcheck",
+		Args:             commandLine(),
+		Start:            start.Unix(),
+		StartStr:         start.Format(time.ANSIC),
+		Version:          "portcheck",
+		XMLOutputVersion: "1.05",
+	}
+
+	byHost := map[string][]result{}
+	ports := map[int]bool{}
+	proto := "tcp"
+	for _, r := range f.results {
+		proto = r.Proto
+		byHost[r.Host] = append(byHost[r.Host], r)
+		ports[r.Port] = true
+	}
+	services := []int{}
+	for p := range ports {
+		services = append(services, p)
+	}
+	slices.Sort(services)
+	run.ScanInfo = nmapScanInfo{
+		Type:        map[string]string{"tcp": "connect", "udp": "udp", "sctp": "sctpinit"}[proto],
+		Protocol:    proto,
+		NumServices: len(services),
+		Services:    compressPorts(services),
+	}
+
+	for _, host := range scanHosts {
+		h := nmapHost{
+			Status:  nmapStatus{State: "down", Reason: "no-response"},
+			Address: nmapAddr(host),
+		}
+		rs := byHost[host]
+		switch {
+		case h.Address.Addr != host:
+			h.Hostnames = []nmapHostname{{Name: host, Type: "user"}}
+		case len(rs) > 0 && rs[0].Hostname != "":
+			h.Hostnames = []nmapHostname{{Name: rs[0].Hostname, Type: "PTR"}}
+		}
+		extra := map[string]int{}
+		rtts := []float64{}
+		slices.SortFunc(rs, func(a, b result) int { return a.Port - b.Port })
+		for _, r := range rs {
+			// a refusal proves the host is there just as well as an accept
+			if r.State == "open" || r.State == "closed" {
+				h.Status = nmapStatus{State: "up", Reason: "user-set"}
+			}
+			if r.State == "open" {
+				rtts = append(rtts, r.LatencyMS)
+				port := nmapPort{
+					Protocol: r.Proto,
+					PortID:   r.Port,
+					State:    nmapPortState{State: r.State, Reason: nmapReason(r.Proto, r.State)},
+				}
+				switch {
+				case r.Fingerprinted:
+					port.Service = &nmapService{Name: r.Service, Product: r.Version, Extra: strings.TrimPrefix(authNote(r.Auth), ", "), Method: "probed", Conf: 10}
+				case r.Service != "":
+					// conf 3 is what nmap uses for a port-table guess
+					port.Service = &nmapService{Name: r.Service, Method: "table", Conf: 3}
+				}
+				if r.Banner != "" {
+					port.Scripts = append(port.Scripts, nmapScript{ID: "banner", Output: r.Banner})
+				}
+				if r.TLS != nil {
+					port.Scripts = append(port.Scripts, nmapScript{ID: "ssl-cert", Output: r.TLS.String()})
+				}
+				if r.HTTP != nil {
+					port.Scripts = append(port.Scripts, nmapScript{ID: "http-title", Output: r.HTTP.String()})
+				}
+				h.Ports.Ports = append(h.Ports.Ports, port)
+				continue
+			}
+			if r.State != "error" {
+				extra[r.State]++
+			}
+		}
+		for state, count := range extra {
+			h.Ports.ExtraPorts = append(h.Ports.ExtraPorts, nmapExtraPorts{
+				State:   state,
+				Count:   count,
+				Reasons: []nmapExtraReason{{Reason: nmapReason(proto, state), Count: count}},
+			})
+		}
+		h.Times = nmapRTT(rtts)
+		slices.SortFunc(h.Ports.ExtraPorts, func(a, b nmapExtraPorts) int { return strings.Compare(a.State, b.State) })
+		if h.Status.State == "up" {
+			run.RunStats.Hosts.Up++
+		} else {
+			run.RunStats.Hosts.Down++
+		}
+		run.Hosts = append(run.Hosts, h)
+	}
+	run.RunStats.Hosts.Total = len(run.Hosts)
+	elapsed := end.Sub(start)
+	run.RunStats.Finished = nmapFinished{
+		Time:    end.Unix(),
+		TimeStr: end.Format(time.ANSIC),
+		Elapsed: strconv.FormatFloat(elapsed.Seconds(), 'f', 2, 64),
+		Summary: fmt.Sprintf("portcheck done at %s; %d IP address (%d host up) scanned in %.2f seconds",
+			end.Format(time.ANSIC), run.RunStats.Hosts.Total, run.RunStats.Hosts.Up, elapsed.Seconds()),
+		Exit: "success",
+	}
+
+	if _, err := io.WriteString(f.w, xml.Header+"<!DOCTYPE nmaprun>\n"); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(f.w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(run); err != nil {
+		return err
+	}
+	_, err := io.WriteString(f.w, "\n")
+	return err
+}
+
+// nmapRTT summarises open-port connect latencies into nmap's <times>, or nil
+// if nothing was open to measure.
+func nmapRTT(rtts []float64) *nmapTimes {
+	if len(rtts) == 0 {
+		return nil
+	}
+	var sum float64
+	for _, rtt := range rtts {
+		sum += rtt
+	}
+	mean := sum / float64(len(rtts))
+	var dev float64
+	for _, rtt := range rtts {
+		dev += math.Abs(rtt - mean)
+	}
+	dev /= float64(len(rtts))
+	return &nmapTimes{
+		SRTT:   int64(mean * 1000),
+		RTTVar: int64(dev * 1000),
+		To:     timeout.Microseconds(),
+	}
+}
+
+// compressPorts renders a sorted port list the way nmap does in scaninfo,
+// collapsing consecutive ports into ranges: 22,80,8000-8100.
+func compressPorts(ports []int) string {
+	parts := []string{}
+	for i := 0; i < len(ports); {
+		j := i
+		for j+1 < len(ports) && ports[j+1] == ports[j]+1 {
+			j++
+		}
+		if i == j {
+			parts = append(parts, strconv.Itoa(ports[i]))
+		} else {
+			parts = append(parts, fmt.Sprintf("%d-%d", ports[i], ports[j]))
+		}
+		i = j + 1
+	}
+	return strings.Join(parts, ",")
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// maxAlertPorts caps how many ports a finished-scan alert lists, keeping it
+// readable and under Discord's 2000 character limit.
+const maxAlertPorts = 50
+
+// parseNotify turns a -notify spec into a notifier. The scheme names the
+// service and is swapped for https to get the incoming webhook URL.
+func parseNotify(spec string) (*notifier, error) {
+	u, err := url.Parse(spec)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid notify URL %q", spec)
+	}
+	var payload func(alert) any
+	switch u.Scheme {
+	case "slack":
+		payload = func(a alert) any { return map[string]string{"text": a.text} }
+	case "discord":
+		payload = func(a alert) any { return map[string]string{"content": a.text} }
+	default:
+		return nil, fmt.Errorf("unknown notifier %q, expected slack:// or discord://", u.Scheme)
+	}
+	name := u.Scheme
+	u.Scheme = "https"
+	return newNotifier(name, u.String(), payload), nil
+}
+
+func changeText(c change) string {
+	k := portKey{c.Host, c.Port, c.Proto}
+	source := "portcheck"
+	if c.Job != "" {
+		source += " " + c.Job
+	}
+	if c.To == "open" {
+		return fmt.Sprintf("%s: %s came UP (was %s)", source, k, c.From)
+	}
+	return fmt.Sprintf("%s: %s went DOWN (now %s)", source, k, c.To)
+}
+
+// openPortsText summarizes the open ports a scan found.
+func openPortsText(open []portKey) string {
+	list := []string{}
+	for _, k := range open[:min(len(open), maxAlertPorts)] {
+		list = append(list, k.String())
+	}
+	if len(open) > maxAlertPorts {
+		list = append(list, fmt.Sprintf("and %d more", len(open)-maxAlertPorts))
+	}
+	return fmt.Sprintf("portcheck: %d open: %s", len(open), strings.Join(list, ", "))
+}
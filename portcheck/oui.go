@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+)
+
+// ouiVendors maps the first three bytes of a MAC address, in upper-case
+// hex, to who the IEEE assigned them to. Built in are the virtualization
+// platforms and the network, server and embedded gear most often found on
+// a LAN; -oui loads the full registry.
+var ouiVendors = map[string]string{
+	"000C29": "VMware",
+	"005056": "VMware",
+	"000569": "VMware",
+	"001C14": "VMware",
+	"080027": "VirtualBox",
+	"525400": "QEMU/KVM",
+	"00155D": "Microsoft Hyper-V",
+	"00163E": "Xen",
+	"001C42": "Parallels",
+	"B827EB": "Raspberry Pi",
+	"DCA632": "Raspberry Pi",
+	"E45F01": "Raspberry Pi",
+	"00000C": "Cisco",
+	"000585": "Juniper Networks",
+	"000B86": "Aruba Networks",
+	"00090F": "Fortinet",
+	"001B17": "Palo Alto Networks",
+	"00095B": "Netgear",
+	"00156D": "Ubiquiti",
+	"002722": "Ubiquiti",
+	"24A43C": "Ubiquiti",
+	"FCECDA": "Ubiquiti",
+	"000C42": "MikroTik",
+	"4C5E0C": "MikroTik",
+	"000DB9": "PC Engines",
+	"001132": "Synology",
+	"002590": "Supermicro",
+	"0CC47A": "Supermicro",
+	"AC1F6B": "Supermicro",
+	"001422": "Dell",
+	"001B21": "Intel",
+	"00E04C": "Realtek",
+	"000393": "Apple",
+	"000A95": "Apple",
+	"18FE34": "Espressif",
+	"240AC4": "Espressif",
+	"30AEA4": "Espressif",
+	"001788": "Philips Hue",
+	"18B430": "Nest Labs",
+	"000E58": "Sonos",
+	"00408C": "Axis Communications",
+	"ACCC8E": "Axis Communications",
+}
+
+// macVendor names the maker of the interface with address mac. Addresses
+// with the locally administered bit set weren't assigned by the IEEE:
+// phones and laptops randomize theirs, for one.
+func macVendor(mac string) string {
+	hw, err := net.ParseMAC(mac)
+	if err != nil || len(hw) < 3 {
+		return ""
+	}
+	if v, ok := ouiVendors[strings.ToUpper(hex.EncodeToString(hw[:3]))]; ok {
+		return v
+	}
+	if hw[0]&0x02 != 0 {
+		return "(locally administered)"
+	}
+	return ""
+}
+
+// loadOUI adds the vendors of an OUI registry file for -oui: the IEEE's
+// oui.txt or oui.csv, or Wireshark's manuf. Blocks smaller than an OUI,
+// which manuf lists with a mask, are skipped.
+func loadOUI(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+	loaded := 0
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		var prefix, vendor string
+		switch {
+		case strings.HasPrefix(line, "#") || line == "":
+			continue
+		case strings.Contains(line, "(hex)"):
+			// oui.txt: 00-00-0C   (hex)		Cisco Systems, Inc
+			p, v, _ := strings.Cut(line, "(hex)")
+			prefix, vendor = p, v
+		case strings.HasPrefix(line, "MA-L,"):
+			// oui.csv: MA-L,00000C,"Cisco Systems, Inc",address
+			fields := strings.SplitN(line, ",", 3)
+			if len(fields) < 3 {
+				continue
+			}
+			prefix, vendor = fields[1], fields[2]
+			if strings.HasPrefix(vendor, `"`) {
+				vendor, _, _ = strings.Cut(vendor[1:], `"`)
+			} else {
+				vendor, _, _ = strings.Cut(vendor, ",")
+			}
+		default:
+			// manuf: 00:00:0C	Cisco	Cisco Systems, Inc
+			fields := strings.Split(line, "\t")
+			if len(fields) < 2 || strings.Contains(fields[0], "/") {
+				continue
+			}
+			prefix, vendor = fields[0], fields[len(fields)-1]
+		}
+		prefix = strings.NewReplacer("-", "", ":", "", ".", "").Replace(strings.TrimSpace(prefix))
+		vendor = strings.TrimSpace(vendor)
+		if len(prefix) != 6 || vendor == "" {
+			continue
+		}
+		if _, err := hex.DecodeString(prefix); err != nil {
+			continue
+		}
+		ouiVendors[strings.ToUpper(prefix)] = vendor
+		loaded++
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("reading %s: %w", path, err)
+	}
+	if loaded == 0 {
+		return fmt.Errorf("%s has no OUI assignments", path)
+	}
+	return nil
+}
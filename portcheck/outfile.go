@@ -0,0 +1,152 @@
+package main
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// outputFile collects results in a temporary file next to path and renames it
+// into place once the scan completes, so path never holds a half-written
+// scan and a lost terminal doesn't lose the results written so far.
+type outputFile struct {
+	*os.File
+	path string
+	// stream is set when the results go straight to path instead
+	stream bool
+	// gz, when set, compresses what's written on its way to the file
+	gz *gzip.Writer
+}
+
+// compress gzips everything written from now on. With -append the new run
+// becomes another gzip member after the old ones, which gunzip and zcat
+// read as one stream.
+func (o *outputFile) compress() {
+	o.gz = gzip.NewWriter(o.File)
+}
+
+func (o *outputFile) Write(p []byte) (int, error) {
+	if o.gz == nil {
+		return o.File.Write(p)
+	}
+	n, err := o.gz.Write(p)
+	if err == nil && o.stream {
+		// so what's in the file so far decompresses
+		err = o.gz.Flush()
+	}
+	return n, err
+}
+
+// createOutput starts the temporary file. With appendTo the current contents
+// of path are copied in first, so the rename still replaces it atomically.
+// The temporary file gets the mode of path if it exists, and otherwise 0666
+// less the umask, as path would if written directly.
+func createOutput(path string, appendTo bool) (*outputFile, error) {
+	perm, keep := fs.FileMode(0o666), false
+	if fi, err := os.Stat(path); err == nil {
+		perm, keep = fi.Mode().Perm(), true
+	}
+	tmp, err := createTemp(path, perm)
+	if err != nil {
+		return nil, err
+	}
+	o := &outputFile{File: tmp, path: path}
+	if keep {
+		// the umask applies to the mode it was created with
+		if err := o.Chmod(perm); err != nil {
+			o.abort()
+			return nil, err
+		}
+	}
+	if appendTo {
+		if err := o.copyFrom(path); err != nil {
+			o.abort()
+			return nil, err
+		}
+	}
+	return o, nil
+}
+
+// createTemp is os.CreateTemp next to path, but with perm masked by the
+// umask rather than 0600.
+func createTemp(path string, perm fs.FileMode) (*os.File, error) {
+	dir, base := filepath.Dir(path), filepath.Base(path)
+	for range 100 {
+		name := filepath.Join(dir, "."+base+"."+strconv.FormatUint(uint64(rand.Uint32()), 10))
+		f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, perm)
+		if !errors.Is(err, fs.ErrExist) {
+			return f, err
+		}
+	}
+	return nil, fmt.Errorf("creating a temporary file next to %s: too many tries", path)
+}
+
+// openStream opens path itself for results to go to as they arrive, for
+// -format jsonl, so others can read it during the scan. Unlike createOutput
+// an interrupted scan leaves the results so far in path.
+func openStream(path string, appendTo bool) (*outputFile, error) {
+	mode := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if appendTo {
+		mode = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	}
+	f, err := os.OpenFile(path, mode, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &outputFile{File: f, path: path, stream: true}, nil
+}
+
+func (o *outputFile) copyFrom(path string) error {
+	old, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer old.Close()
+	_, err = io.Copy(o, old)
+	return err
+}
+
+// commit flushes the temporary file and moves it over path.
+func (o *outputFile) commit() error {
+	if o.gz != nil {
+		if err := o.gz.Close(); err != nil {
+			o.abort()
+			return err
+		}
+	}
+	if err := o.Sync(); err != nil {
+		o.abort()
+		return err
+	}
+	if err := o.Close(); err != nil {
+		if !o.stream {
+			_ = os.Remove(o.Name())
+		}
+		return err
+	}
+	if o.stream {
+		return nil
+	}
+	return os.Rename(o.Name(), o.path)
+}
+
+// abort throws the temporary file away, leaving path untouched. A stream
+// is only closed, ending the gzip stream if there is one.
+func (o *outputFile) abort() {
+	if o.gz != nil && o.stream {
+		_ = o.gz.Close()
+	}
+	_ = o.Close()
+	if !o.stream {
+		_ = os.Remove(o.Name())
+	}
+}
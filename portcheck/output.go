@@ -0,0 +1,443 @@
+package main
+
+import (
+	"cmp"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gishyanart/helper-scripts/portcheck/portscan"
+)
+
+// formatter receives every probe result as it completes and the summary once
+// the scan is done. Formats that need the whole result set buffer in result and
+// write in finish.
+type formatter interface {
+	result(r result)
+	finish(s summary) error
+}
+
+// secretFlags take values that are credentials in themselves: chat webhook
+// URLs embed their token.
+var secretFlags = []string{"api-token", "notify", "webhook"}
+
+// commandLine is the command line for the reports that record it, with
+// redactArgs applied, since reports get attached to tickets and passed
+// around.
+func commandLine() string {
+	return strings.Join(redactArgs(os.Args), " ")
+}
+
+// redactArgs is a copy of command line arguments with the values of
+// secretFlags and the userinfo of URLs, a -proxy password say, redacted.
+func redactArgs(args []string) []string {
+	args = slices.Clone(args)
+	secret := false
+	for i, arg := range args {
+		if secret {
+			args[i], secret = "REDACTED", false
+			continue
+		}
+		if name, ok := strings.CutPrefix(arg, "-"); ok {
+			name = strings.TrimPrefix(name, "-")
+			name, value, hasValue := strings.Cut(name, "=")
+			if slices.Contains(secretFlags, name) {
+				if hasValue {
+					args[i] = arg[:len(arg)-len(value)] + "REDACTED"
+				} else {
+					secret = true
+				}
+				continue
+			}
+			if hasValue {
+				args[i] = arg[:len(arg)-len(value)] + redactURL(value)
+			}
+			continue
+		}
+		args[i] = redactURL(arg)
+	}
+	return args
+}
+
+// redactURL blanks out the user and password of a URL; anything else is
+// returned as is.
+func redactURL(v string) string {
+	u, err := url.Parse(v)
+	if err != nil || u.User == nil {
+		return v
+	}
+	u.User = url.User("REDACTED")
+	return u.String()
+}
+
+var formats = map[string]func(w io.Writer) formatter{
+	"text": func(w io.Writer) formatter { return &textFormatter{w: w, color: colorEnabled(w)} },
+	"json": func(w io.Writer) formatter { return &jsonFormatter{enc: json.NewEncoder(w)} },
+	// jsonl is json written to -o as it arrives rather than on completion
+	"jsonl": func(w io.Writer) formatter { return &jsonFormatter{enc: json.NewEncoder(w)} },
+	"csv":   func(w io.Writer) formatter { return newCSVFormatter(w) },
+
+	"nmap-xml": func(w io.Writer) formatter { return &nmapFormatter{w: w} },
+	"grep":     func(w io.Writer) formatter { return &grepFormatter{w: w} },
+	"html":     func(w io.Writer) formatter { return &htmlFormatter{w: w} },
+	"markdown": func(w io.Writer) formatter { return &markdownFormatter{w: w} },
+	"junit":    func(w io.Writer) formatter { return &junitFormatter{w: w} },
+	"template": func(w io.Writer) formatter { return &templateFormatter{w: w} },
+	"quiet":    func(w io.Writer) formatter { return quietFormatter{w: w} },
+}
+
+func formatNames() []string {
+	names := []string{}
+	for name := range formats {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+func newFormatter(name string, w io.Writer) (formatter, error) {
+	f, ok := formats[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown format %q, expected one of: %v", name, formatNames())
+	}
+	if sortResults {
+		return &sortedFormatter{next: f(w)}, nil
+	}
+	return f(w), nil
+}
+
+// sortedFormatter holds every result back and hands them to next ordered by
+// host then port, so two runs over the same targets produce the same output.
+type sortedFormatter struct {
+	next    formatter
+	results []result
+}
+
+func (f *sortedFormatter) result(r result) {
+	f.results = append(f.results, r)
+}
+
+func (f *sortedFormatter) finish(s summary) error {
+	slices.SortFunc(f.results, compareResults)
+	for _, r := range f.results {
+		f.next.result(r)
+	}
+	return f.next.finish(s)
+}
+
+func compareResults(a, b result) int {
+	return cmp.Or(compareHosts(a.Host, b.Host), cmp.Compare(a.Port, b.Port))
+}
+
+// compareHosts orders IP addresses numerically, ahead of hostnames, which
+// sort alphabetically.
+func compareHosts(a, b string) int {
+	ipA, errA := netip.ParseAddr(a)
+	ipB, errB := netip.ParseAddr(b)
+	switch {
+	case errA == nil && errB == nil:
+		return ipA.Compare(ipB)
+	case errA == nil:
+		return -1
+	case errB == nil:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+// textFormatter prints reachable ports as they are found. When more than one
+// host is scanned the lines are held back and printed per host at the end,
+// each host's followed by its counts, otherwise results from different hosts
+// would interleave.
+type textFormatter struct {
+	w      io.Writer
+	color  bool
+	byHost map[string][]string
+	counts map[string]*summary
+	// labels are the Host: lines of hosts with a name or -geoip details
+	labels map[string]string
+}
+
+// ANSI colors for the state label in text output.
+const (
+	colorReset  = "\033[0m"
+	colorRed    = "\033[31m"
+	colorGreen  = "\033[32m"
+	colorYellow = "\033[33m"
+)
+
+// colorEnabled reports whether text output to w should be colored: only on a
+// terminal, and never with -no-color or NO_COLOR set (https://no-color.org).
+func colorEnabled(w io.Writer) bool {
+	if noColor || os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+func (f *textFormatter) label(text, color string) string {
+	if !f.color {
+		return text
+	}
+	return color + text + colorReset
+}
+
+func stateColor(state string) string {
+	switch state {
+	case "open":
+		return colorGreen
+	case "closed":
+		return colorRed
+	}
+	return colorYellow
+}
+
+// authNote tells the reader whether a datastore lets anyone in.
+func authNote(auth string) string {
+	switch auth {
+	case portscan.AuthNone:
+		return ", no auth"
+	case portscan.AuthRequired:
+		return ", auth required"
+	}
+	return ""
+}
+
+func (f *textFormatter) result(r result) {
+	if len(scanHosts) > 1 {
+		if f.counts == nil {
+			f.counts = map[string]*summary{}
+		}
+		if f.counts[r.Host] == nil {
+			f.counts[r.Host] = &summary{}
+		}
+		f.counts[r.Host].count(r)
+	}
+	addr := net.JoinHostPort(r.Host, strconv.Itoa(r.Port))
+	if r.Service != "" {
+		addr += " (" + strings.TrimSpace(r.Service+" "+r.Version) + authNote(r.Auth) + ")"
+	}
+	line := ""
+	switch r.State {
+	case "open":
+		line = f.label("SUCCESS:", colorGreen) + " " + addr + " " + formatLatency(r.LatencyMS)
+		if r.Banner != "" {
+			line += " " + strconv.Quote(r.Banner)
+		}
+		if r.TLS != nil {
+			line += "\n    tls: " + r.TLS.String()
+		}
+		if r.SSH != nil {
+			line += "\n    ssh: " + r.SSH.String()
+		}
+		if a := r.TLSAudit; a != nil {
+			line += "\n    tls-audit: " + a.String()
+			for _, v := range a.Versions {
+				if len(v.Ciphers) > 0 {
+					line += "\n      " + v.Version + ": " + strings.Join(v.Ciphers, ", ")
+				}
+			}
+		}
+		if r.HTTP != nil {
+			line += "\n    http: " + r.HTTP.String()
+		}
+	case "open|filtered":
+		line = f.label("OPEN|FILTERED:", colorYellow) + " " + addr
+		if showErrors {
+			line += " [" + r.Reason + "]"
+		}
+	default:
+		if !showAll && !showErrors {
+			return
+		}
+		reason := r.Reason
+		if r.ICMP != "" {
+			reason += ": " + r.ICMP
+		}
+		line = fmt.Sprintf("%s %s [%s]", f.label(strings.ToUpper(r.State)+":", stateColor(r.State)), addr, reason)
+		if showErrors && r.Error != "" {
+			line += " " + r.Error
+		}
+	}
+	if r.DualStack != nil {
+		line += " [" + r.DualStack.String() + "]"
+	}
+	if f.labels[r.Host] == "" && (r.Hostname != "" || r.ASN != 0 || r.Country != "") {
+		if f.labels == nil {
+			f.labels = map[string]string{}
+		}
+		f.labels[r.Host] = resultHostLabel(r)
+		if len(scanHosts) < 2 {
+			_, _ = fmt.Fprintf(f.w, "Host: %s\n", f.labels[r.Host])
+		}
+	}
+	if len(scanHosts) < 2 {
+		_, _ = fmt.Fprintln(f.w, line)
+		return
+	}
+	if f.byHost == nil {
+		f.byHost = map[string][]string{}
+	}
+	f.byHost[r.Host] = append(f.byHost[r.Host], line)
+}
+
+// hostLabel names a host the way nmap's reports do: "name (IP)" if it has
+// a reverse DNS name, or just the host.
+func hostLabel(host, name string) string {
+	if name == "" {
+		return host
+	}
+	return fmt.Sprintf("%s (%s)", name, host)
+}
+
+// resultHostLabel is the host header of text output: hostLabel with every
+// name of the address, and what -geoip found after it,
+// e.g. "one.one.one.one (1.1.1.1) [AS13335 CLOUDFLARENET, AU]".
+func resultHostLabel(r result) string {
+	name := r.Hostname
+	if len(r.Names) > 0 {
+		name = strings.Join(r.Names, ", ")
+	}
+	label := hostLabel(r.Host, name)
+	if g := (geoInfo{r.ASN, r.ASOrg, r.Country}).String(); g != "" {
+		label += " [" + g + "]"
+	}
+	return label
+}
+
+func (f *textFormatter) finish(summary) error {
+	printed := 0
+	for _, host := range scanHosts {
+		if len(f.byHost[host]) == 0 {
+			continue
+		}
+		if printed++; printed > 1 {
+			if _, err := fmt.Fprintln(f.w); err != nil {
+				return err
+			}
+		}
+		if _, err := fmt.Fprintf(f.w, "Host: %s\n", cmp.Or(f.labels[host], host)); err != nil {
+			return err
+		}
+		for _, line := range f.byHost[host] {
+			if _, err := fmt.Fprintln(f.w, line); err != nil {
+				return err
+			}
+		}
+		if c := f.counts[host]; c != nil {
+			if _, err := fmt.Fprintf(f.w, "%d probes: %s\n", c.Probed, c.counts()); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// quietFormatter prints host:port for each open port and nothing else, for
+// piping into other tools.
+type quietFormatter struct {
+	w io.Writer
+}
+
+func (f quietFormatter) result(r result) {
+	if r.State == "open" {
+		_, _ = fmt.Fprintln(f.w, net.JoinHostPort(r.Host, strconv.Itoa(r.Port)))
+	}
+}
+
+func (quietFormatter) finish(summary) error {
+	return nil
+}
+
+type jsonFormatter struct {
+	enc *json.Encoder
+}
+
+func (f *jsonFormatter) result(r result) {
+	_ = f.enc.Encode(r)
+}
+
+func (f *jsonFormatter) finish(s summary) error {
+	return f.enc.Encode(s)
+}
+
+type csvFormatter struct {
+	w *csv.Writer
+}
+
+// newCSVFormatter writes the header; with -rdns or -hostnames a hostname
+// column is added at the end, every name of the address space-separated, with -dual-stack the state over each family and with
+// -show-errors the failure category, leaving the others where scripts
+// expect them.
+func newCSVFormatter(w io.Writer) *csvFormatter {
+	f := &csvFormatter{w: csv.NewWriter(w)}
+	header := []string{"host", "port", "proto", "state", "latency_ms", "error"}
+	if reverseDNS || hostnameList != "" {
+		header = append(header, "hostname")
+	}
+	if dualStack {
+		header = append(header, "ipv4_state", "ipv6_state", "first")
+	}
+	if showErrors {
+		header = append(header, "reason")
+	}
+	if len(geoSources) > 0 {
+		header = append(header, "asn", "as_org", "country")
+	}
+	_ = f.w.Write(header)
+	return f
+}
+
+func (f *csvFormatter) result(r result) {
+	row := []string{
+		r.Host,
+		strconv.Itoa(r.Port),
+		r.Proto,
+		r.State,
+		strconv.FormatFloat(r.LatencyMS, 'f', 3, 64),
+		r.Error,
+	}
+	if reverseDNS || hostnameList != "" {
+		name := r.Hostname
+		if len(r.Names) > 0 {
+			name = strings.Join(r.Names, " ")
+		}
+		row = append(row, name)
+	}
+	if dualStack {
+		if ds := r.DualStack; ds != nil {
+			row = append(row, ds.IPv4, ds.IPv6, ds.First)
+		} else {
+			row = append(row, "", "", "")
+		}
+	}
+	if showErrors {
+		row = append(row, r.Reason)
+	}
+	if len(geoSources) > 0 {
+		asn := ""
+		if r.ASN != 0 {
+			asn = strconv.FormatUint(uint64(r.ASN), 10)
+		}
+		row = append(row, asn, r.ASOrg, r.Country)
+	}
+	_ = f.w.Write(row)
+}
+
+func (f *csvFormatter) finish(summary) error {
+	f.w.Flush()
+	return f.w.Error()
+}
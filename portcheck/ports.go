@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/gishyanart/helper-scripts/portcheck/portscan"
+)
+
+// parsePorts expands a port spec: comma-separated ports, lo-hi ranges and
+// service names of proto, in the order given, with ports that more than one
+// entry covers kept at their first place. A malformed entry is an error
+// naming it rather than being skipped, so a typo can't quietly shrink the
+// scan.
+func parsePorts(spec, proto string) ([]string, error) {
+	ports := []string{}
+	seen := map[int]bool{}
+	for entry := range strings.SplitSeq(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		lo, hi, err := parsePortEntry(entry, proto)
+		if err != nil {
+			return nil, err
+		}
+		for port := lo; port <= hi; port++ {
+			if !seen[port] {
+				seen[port] = true
+				ports = append(ports, strconv.Itoa(port))
+			}
+		}
+	}
+	if len(ports) == 0 {
+		return nil, fmt.Errorf("no ports in %q", spec)
+	}
+	return ports, nil
+}
+
+// parsePortEntry reads one entry of a port spec, a port, a lo-hi range or
+// a service name, as the range it covers. Names are tried first, since
+// many have dashes in them (ms-sql-s, http-alt).
+func parsePortEntry(entry, proto string) (lo, hi int, err error) {
+	if entry[0] < '0' || entry[0] > '9' {
+		port, ok := portscan.ServicePort(proto, entry)
+		if !ok {
+			return 0, 0, fmt.Errorf("unknown %s service %q", proto, entry)
+		}
+		return port, port, nil
+	}
+	first, last, isRange := strings.Cut(entry, "-")
+	if lo, err = parsePort(first, entry); err != nil {
+		return 0, 0, err
+	}
+	if !isRange {
+		return lo, lo, nil
+	}
+	if hi, err = parsePort(last, entry); err != nil {
+		return 0, 0, err
+	}
+	if hi < lo {
+		return 0, 0, fmt.Errorf("port range %q runs backwards; did you mean %d-%d?", entry, hi, lo)
+	}
+	return lo, hi, nil
+}
+
+// parsePort reads one port of entry.
+func parsePort(s, entry string) (int, error) {
+	where := ""
+	if s != entry {
+		where = fmt.Sprintf(" in %q", entry)
+	}
+	port, err := strconv.Atoi(strings.TrimSpace(s))
+	switch {
+	case err != nil:
+		return 0, fmt.Errorf("bad port %q%s", s, where)
+	case port < 1 || port > portRangeEnd:
+		return 0, fmt.Errorf("port %d%s is out of range 1-%d", port, where, portRangeEnd)
+	}
+	return port, nil
+}
+
+// readPortsFile loads a port spec from a file with one port, range, service
+// name or comma-separated list of them per line. Blank lines and anything
+// after a # are ignored, and a bad entry is reported with its line.
+func readPortsFile(path, proto string) (string, error) {
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return "", err
+		}
+		defer func() { _ = f.Close() }()
+		r = f
+	}
+	entries := []string{}
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		if line = strings.TrimSpace(line); line == "" {
+			continue
+		}
+		if _, err := parsePorts(line, proto); err != nil {
+			return "", fmt.Errorf("%s:%d: %w", path, n, err)
+		}
+		entries = append(entries, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return "", fmt.Errorf("reading %s: %w", path, err)
+	}
+	if len(entries) == 0 {
+		return "", fmt.Errorf("%s has no ports", path)
+	}
+	return strings.Join(entries, ","), nil
+}
+
+// allPorts is every port, 1 to 65535.
+func allPorts() []string {
+	ports := make([]string, 0, portRangeEnd)
+	for port := 1; port <= portRangeEnd; port++ {
+		ports = append(ports, strconv.Itoa(port))
+	}
+	return ports
+}
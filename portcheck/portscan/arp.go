@@ -0,0 +1,71 @@
+package portscan
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"slices"
+)
+
+// Neighbor is a host on the local link that answered an ARP request.
+type Neighbor struct {
+	IP        string  `json:"ip"`
+	MAC       string  `json:"mac"`
+	Interface string  `json:"interface"`
+	LatencyMS float64 `json:"latency_ms"`
+}
+
+// ARPScan asks who has each address of prefix on the Ethernet interface
+// iface and returns the hosts that answer, in address order. Every host on
+// the link has to answer ARP, firewall or not, so this finds hosts that
+// ping and port probes miss. Requests are sent at Rate, if set; addresses
+// still silent are asked again up to Retries times, and each round waits
+// Timeout for the last replies. The network and broadcast addresses of
+// prefix and iface's own address are skipped.
+//
+// It takes a raw packet socket, so Linux only, as root or with
+// CAP_NET_RAW.
+func (s *Scanner) ARPScan(ctx context.Context, iface string, prefix netip.Prefix) ([]Neighbor, error) {
+	ifi, err := net.InterfaceByName(iface)
+	if err != nil {
+		return nil, err
+	}
+	if len(ifi.HardwareAddr) != 6 {
+		return nil, fmt.Errorf("%s is not an Ethernet interface", iface)
+	}
+	prefix = prefix.Masked()
+	if !prefix.Addr().Is4() {
+		return nil, fmt.Errorf("ARP is IPv4 only, got %s", prefix)
+	}
+	var source netip.Addr
+	addrs, err := ifi.Addrs()
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range addrs {
+		if n, ok := a.(*net.IPNet); ok {
+			if ip, ok := netip.AddrFromSlice(n.IP); ok && ip.Unmap().Is4() && (!source.IsValid() || prefix.Contains(ip.Unmap())) {
+				source = ip.Unmap()
+			}
+		}
+	}
+	if !source.IsValid() {
+		return nil, fmt.Errorf("%s has no IPv4 address to send ARP requests from", iface)
+	}
+	targets := []netip.Addr{}
+	for ip := prefix.Addr(); prefix.Contains(ip); ip = ip.Next() {
+		network, broadcast := ip == prefix.Addr(), !prefix.Contains(ip.Next())
+		if ip != source && (prefix.Bits() >= 31 || !network && !broadcast) {
+			targets = append(targets, ip)
+		}
+	}
+	neighbors, err := s.arpScan(ctx, ifi, source, targets)
+	if err != nil {
+		return nil, err
+	}
+	slices.SortFunc(neighbors, func(a, b Neighbor) int {
+		return netip.MustParseAddr(a.IP).Compare(netip.MustParseAddr(b.IP))
+	})
+	return neighbors, nil
+}
@@ -0,0 +1,150 @@
+//go:build linux
+
+package portscan
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"net/netip"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	etherTypeARP = 0x0806
+	arpRequest   = 1
+	arpReply     = 2
+)
+
+// arpScan broadcasts a request for each of targets from source over ifi,
+// reading the replies off the same packet socket as they come.
+func (s *Scanner) arpScan(ctx context.Context, ifi *net.Interface, source netip.Addr, targets []netip.Addr) ([]Neighbor, error) {
+	proto := int(htons(etherTypeARP))
+	fd, err := syscall.Socket(syscall.AF_PACKET, syscall.SOCK_RAW, proto)
+	if err != nil {
+		return nil, fmt.Errorf("opening packet socket (needs root or CAP_NET_RAW): %w", err)
+	}
+	defer syscall.Close(fd)
+	link := &syscall.SockaddrLinklayer{Protocol: htons(etherTypeARP), Ifindex: ifi.Index}
+	if err := syscall.Bind(fd, link); err != nil {
+		return nil, fmt.Errorf("binding packet socket to %s: %w", ifi.Name, err)
+	}
+	// wake the reader up now and then to see if it's done
+	tv := syscall.NsecToTimeval((100 * time.Millisecond).Nanoseconds())
+	if err := syscall.SetsockoptTimeval(fd, syscall.SOL_SOCKET, syscall.SO_RCVTIMEO, &tv); err != nil {
+		return nil, err
+	}
+
+	var mu sync.Mutex
+	sent := map[netip.Addr]time.Time{}
+	found := map[netip.Addr]Neighbor{}
+	done := make(chan struct{})
+	read := make(chan struct{})
+	go func() {
+		defer close(read)
+		buf := make([]byte, 1500)
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			n, _, err := syscall.Recvfrom(fd, buf, 0)
+			if err != nil || n < 42 {
+				continue
+			}
+			ip, mac, ok := parseARPReply(buf[:n])
+			if !ok {
+				continue
+			}
+			mu.Lock()
+			if t, asked := sent[ip]; asked {
+				if _, dup := found[ip]; !dup {
+					found[ip] = Neighbor{
+						IP:        ip.String(),
+						MAC:       mac.String(),
+						Interface: ifi.Name,
+						LatencyMS: float64(time.Since(t).Microseconds()) / 1000,
+					}
+				}
+			}
+			mu.Unlock()
+		}
+	}()
+
+	link.Addr = [8]byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
+	link.Halen = 6
+	frame := arpRequestFrame(ifi.HardwareAddr, source)
+	for attempt := 0; attempt <= s.opts.Retries && ctx.Err() == nil; attempt++ {
+		for _, ip := range targets {
+			mu.Lock()
+			_, answered := found[ip]
+			mu.Unlock()
+			if answered {
+				continue
+			}
+			if s.limiter != nil {
+				s.limiter.take(ctx)
+			}
+			if ctx.Err() != nil {
+				break
+			}
+			copy(frame[38:42], ip.AsSlice())
+			mu.Lock()
+			sent[ip] = time.Now()
+			mu.Unlock()
+			if err := syscall.Sendto(fd, frame, 0, link); err != nil {
+				close(done)
+				<-read
+				return nil, fmt.Errorf("sending ARP request on %s: %w", ifi.Name, err)
+			}
+		}
+		select {
+		case <-time.After(s.opts.Timeout):
+		case <-ctx.Done():
+		}
+	}
+	close(done)
+	<-read
+
+	neighbors := []Neighbor{}
+	for _, n := range found {
+		neighbors = append(neighbors, n)
+	}
+	return neighbors, nil
+}
+
+// arpRequestFrame is a broadcast "who has" from mac and source, the target
+// address at bytes 38 to 42 left to fill in. It's padded to the 60 bytes
+// of a minimum Ethernet frame.
+func arpRequestFrame(mac net.HardwareAddr, source netip.Addr) []byte {
+	f := make([]byte, 60)
+	copy(f[0:6], []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff})
+	copy(f[6:12], mac)
+	binary.BigEndian.PutUint16(f[12:14], etherTypeARP)
+	binary.BigEndian.PutUint16(f[14:16], 1) // Ethernet
+	binary.BigEndian.PutUint16(f[16:18], 0x0800)
+	f[18], f[19] = 6, 4
+	binary.BigEndian.PutUint16(f[20:22], arpRequest)
+	copy(f[22:28], mac)
+	copy(f[28:32], source.AsSlice())
+	return f
+}
+
+// parseARPReply reads the sender of an ARP reply for IPv4 over Ethernet.
+func parseARPReply(f []byte) (netip.Addr, net.HardwareAddr, bool) {
+	if binary.BigEndian.Uint16(f[12:14]) != etherTypeARP ||
+		binary.BigEndian.Uint16(f[16:18]) != 0x0800 || f[18] != 6 || f[19] != 4 ||
+		binary.BigEndian.Uint16(f[20:22]) != arpReply {
+		return netip.Addr{}, nil, false
+	}
+	ip, _ := netip.AddrFromSlice(f[28:32])
+	return ip, net.HardwareAddr(append([]byte(nil), f[22:28]...)), true
+}
+
+func htons(v uint16) uint16 {
+	return v<<8 | v>>8
+}
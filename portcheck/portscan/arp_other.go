@@ -0,0 +1,14 @@
+//go:build !linux
+
+package portscan
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/netip"
+)
+
+func (s *Scanner) arpScan(context.Context, *net.Interface, netip.Addr, []netip.Addr) ([]Neighbor, error) {
+	return nil, errors.New("ARP scanning is only supported on Linux")
+}
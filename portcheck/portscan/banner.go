@@ -0,0 +1,43 @@
+package portscan
+
+import (
+	"net"
+	"strings"
+	"time"
+)
+
+// bannerWait is how long to wait for a service to speak first. Services that
+// greet (SSH, SMTP, FTP) do so immediately; the rest never will.
+const bannerWait = 2 * time.Second
+
+// wantsBanner reports whether open ports get a banner read, which the
+// options that look at what a port sends first need.
+func (s *Scanner) wantsBanner() bool {
+	return s.opts.Banners || s.opts.DetectVersions || s.opts.VerifyOpen || s.opts.SSHInfo
+}
+
+// readBanner reads whatever the service sends first, up to BannerBytes.
+func (s *Scanner) readBanner(conn net.Conn) []byte {
+	_ = conn.SetReadDeadline(time.Now().Add(min(bannerWait, s.opts.Timeout)))
+	buf := make([]byte, s.opts.BannerBytes)
+	n := 0
+	for n < len(buf) {
+		m, err := conn.Read(buf[n:])
+		n += m
+		if err != nil {
+			break
+		}
+	}
+	return buf[:n]
+}
+
+// cleanBanner trims the banner and replaces control bytes, so binary
+// protocols don't garble the terminal.
+func cleanBanner(b []byte) string {
+	return strings.TrimSpace(strings.Map(func(r rune) rune {
+		if r == '\n' || r == '\r' || r == '\t' || (r >= ' ' && r != 0x7f && r != '�') {
+			return r
+		}
+		return '.'
+	}, string(b)))
+}
@@ -0,0 +1,40 @@
+package portscan
+
+import (
+	"errors"
+	"net"
+	"syscall"
+)
+
+// classify maps a failed dial to a port state and a short reason. A refusal
+// or reset means something on the host answered, so the port is closed;
+// silence or an unreachable network means a firewall or routing problem is in
+// the way and the port is filtered. Failures that say nothing about the port,
+// such as a name that does not resolve, are reported as errors.
+func classify(err error) (state string, reason string) {
+	var dnsErr *net.DNSError
+	var netErr net.Error
+	var proxyErr *ProxyError
+	switch {
+	case errors.As(err, &proxyErr):
+		return "error", "proxy"
+	case errors.As(err, &dnsErr):
+		return "error", "dns-failure"
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return "closed", "refused"
+	case errors.Is(err, syscall.ECONNRESET):
+		return "closed", "reset"
+	case errors.As(err, &netErr) && netErr.Timeout(), errors.Is(err, syscall.ETIMEDOUT):
+		return "filtered", "timeout"
+	case errors.Is(err, syscall.EHOSTUNREACH), errors.Is(err, syscall.ENETUNREACH):
+		return "filtered", "no-route"
+	case errors.Is(err, syscall.EACCES), errors.Is(err, syscall.EPERM):
+		// local firewall rules reject with EPERM
+		return "filtered", "prohibited"
+	case errors.Is(err, syscall.EMFILE), errors.Is(err, syscall.ENFILE),
+		errors.Is(err, syscall.ENOBUFS), errors.Is(err, syscall.EADDRNOTAVAIL):
+		// out of descriptors, buffers or ephemeral ports: too many at once
+		return "error", "resources"
+	}
+	return "error", "other"
+}
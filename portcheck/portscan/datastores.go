@@ -0,0 +1,368 @@
+package portscan
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"strings"
+	"time"
+)
+
+// Result.Auth values.
+const (
+	AuthNone     = "none"
+	AuthRequired = "required"
+)
+
+// mysqlAuth logs in to the MySQL server on address as root with an empty
+// password, the one way to learn whether it wants credentials: AuthNone if
+// that works, else AuthRequired, or "" if the handshake goes wrong.
+func (s *Scanner) mysqlAuth(ctx context.Context, address string) string {
+	conn, err := s.dial(ctx, "tcp", address)
+	if err != nil {
+		return ""
+	}
+	defer func() { _ = conn.Close() }()
+	_ = conn.SetDeadline(time.Now().Add(s.opts.Timeout))
+	r := bufio.NewReader(conn)
+	greeting, err := readMySQLPacket(r)
+	if err != nil || len(greeting) == 0 {
+		return ""
+	}
+	if greeting[0] == 0xff {
+		return AuthRequired // our host isn't allowed at all
+	}
+	plugin, ok := mysqlAuthPlugin(greeting)
+	if !ok {
+		return ""
+	}
+	// CLIENT_LONG_PASSWORD | CLIENT_PROTOCOL_41 | CLIENT_SECURE_CONNECTION
+	// | CLIENT_PLUGIN_AUTH
+	login := binary.LittleEndian.AppendUint32(nil, 0x1|0x200|0x8000|0x80000)
+	login = binary.LittleEndian.AppendUint32(login, 1<<24) // max packet size
+	login = append(login, 0x21)                            // utf8_general_ci
+	login = append(login, make([]byte, 23)...)
+	login = append(login, "root\x00"...)
+	login = append(login, 0) // empty auth response
+	login = append(login, plugin+"\x00"...)
+	packet := append([]byte{byte(len(login)), byte(len(login) >> 8), byte(len(login) >> 16), 1}, login...)
+	if _, err := conn.Write(packet); err != nil {
+		return ""
+	}
+	reply, err := readMySQLPacket(r)
+	if err != nil || len(reply) == 0 {
+		return ""
+	}
+	if reply[0] == 0x00 { // OK
+		return AuthNone
+	}
+	// an error, or an auth switch or more data for a password we don't have
+	return AuthRequired
+}
+
+// readMySQLPacket reads one MySQL packet and returns its payload.
+func readMySQLPacket(r io.Reader) ([]byte, error) {
+	var header [4]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+	payload := make([]byte, int(header[0])|int(header[1])<<8|int(header[2])<<16)
+	_, err := io.ReadFull(r, payload)
+	return payload, err
+}
+
+// mysqlAuthPlugin is the authentication plugin a protocol 10 greeting names,
+// mysql_native_password from servers too old to name one.
+func mysqlAuthPlugin(greeting []byte) (string, bool) {
+	if greeting[0] != 0x0a {
+		return "", false
+	}
+	end := bytes.IndexByte(greeting[1:], 0)
+	if end < 0 {
+		return "", false
+	}
+	// connection ID, scramble part 1 and filler, capabilities, character
+	// set, status, upper capabilities, scramble length and 10 reserved
+	b := greeting[1+end+1:]
+	if len(b) < 4+9+2+1+2+2+1+10 {
+		return "mysql_native_password", true
+	}
+	scramble := max(13, int(b[4+9+2+1+2+2])-8)
+	b = b[4+9+2+1+2+2+1+10:]
+	if len(b) <= scramble {
+		return "mysql_native_password", true
+	}
+	plugin, _, _ := bytes.Cut(b[scramble:], []byte{0})
+	return string(plugin), true
+}
+
+// probePostgres starts a session as user postgres without a password. The
+// server asks for one, refuses the user outright or, trusting us, lets us
+// in and reports its version.
+func probePostgres(conn net.Conn, _ string) (string, string, string, bool) {
+	params := "user\x00postgres\x00database\x00postgres\x00application_name\x00portcheck\x00\x00"
+	startup := binary.BigEndian.AppendUint32(nil, uint32(8+len(params)))
+	startup = binary.BigEndian.AppendUint32(startup, 3<<16) // protocol 3.0
+	startup = append(startup, params...)
+	if _, err := conn.Write(startup); err != nil {
+		return "", "", "", false
+	}
+	r := bufio.NewReader(conn)
+	kind, msg, err := readPostgresMessage(r)
+	if err != nil {
+		return "", "", "", false
+	}
+	switch kind {
+	case 'E':
+		// an ErrorResponse is fields of a type byte and a string, with
+		// severity S and SQLSTATE code C in every one
+		fields := map[byte]string{}
+		for len(msg) > 1 {
+			value, rest, _ := bytes.Cut(msg[1:], []byte{0})
+			fields[msg[0]] = string(value)
+			msg = rest
+		}
+		if fields['S'] == "" || len(fields['C']) != 5 {
+			return "", "", "", false
+		}
+		// class 28 is invalid authorization, pg_hba.conf rejecting us
+		// included; anything else still leaves us outside
+		return "postgresql", "", AuthRequired, true
+	case 'R':
+		if len(msg) < 4 {
+			return "", "", "", false
+		}
+		if code := binary.BigEndian.Uint32(msg); code != 0 {
+			// cleartext, MD5, SASL and the rest all want a password
+			return "postgresql", "", AuthRequired, true
+		}
+	default:
+		return "", "", "", false
+	}
+	// AuthenticationOk, then parameters until ReadyForQuery
+	version := ""
+	for kind != 'Z' {
+		if kind, msg, err = readPostgresMessage(r); err != nil {
+			break
+		}
+		if name, value, _ := bytes.Cut(msg, []byte{0}); kind == 'S' && string(name) == "server_version" {
+			version, _, _ = strings.Cut(string(value), "\x00")
+		}
+	}
+	_, _ = conn.Write([]byte{'X', 0, 0, 0, 4}) // Terminate
+	return "postgresql", version, AuthNone, true
+}
+
+// probePostgresSSL identifies PostgreSQL without logging in, by asking to
+// switch to TLS: the server answers S or N, a single byte, before any
+// startup message. Neither the version nor access is learned this way.
+func probePostgresSSL(conn net.Conn, _ string) (string, string, string, bool) {
+	request := binary.BigEndian.AppendUint32(nil, 8)
+	request = binary.BigEndian.AppendUint32(request, 80877103)
+	if _, err := conn.Write(request); err != nil {
+		return "", "", "", false
+	}
+	var answer [2]byte
+	n, _ := io.ReadAtLeast(conn, answer[:], 1)
+	if n != 1 || (answer[0] != 'S' && answer[0] != 'N') {
+		return "", "", "", false
+	}
+	return "postgresql", "", "", true
+}
+
+// readPostgresMessage reads one backend message, its type and its body.
+func readPostgresMessage(r io.Reader) (byte, []byte, error) {
+	var header [5]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return 0, nil, err
+	}
+	length := binary.BigEndian.Uint32(header[1:])
+	if length < 4 || length > 1<<16 {
+		return 0, nil, fmt.Errorf("bad message length %d", length)
+	}
+	body := make([]byte, length-4)
+	_, err := io.ReadFull(r, body)
+	return header[0], body, err
+}
+
+// probeMongoDB runs buildInfo, which MongoDB answers without login, for the
+// version, then listDatabases, which it refuses without one when access
+// control is on. It speaks OP_MSG, so MongoDB 3.6 and later.
+func probeMongoDB(conn net.Conn, _ string) (string, string, string, bool) {
+	info, err := mongoCommand(conn, 1, "buildInfo")
+	if err != nil {
+		return "", "", "", false
+	}
+	version, _ := info["version"].(string)
+	if _, ok := info["ok"]; !ok {
+		return "", "", "", false
+	}
+	dbs, err := mongoCommand(conn, 2, "listDatabases")
+	if err != nil {
+		return "mongodb", version, "", true
+	}
+	if ok, _ := dbs["ok"].(float64); ok == 1 {
+		return "mongodb", version, AuthNone, true
+	}
+	return "mongodb", version, AuthRequired, true
+}
+
+// mongoCommand sends the admin command name with value 1 as OP_MSG request
+// id and returns the top-level fields of the reply.
+func mongoCommand(conn net.Conn, id uint32, name string) (map[string]any, error) {
+	doc := append([]byte{0x10}, name+"\x00"...)
+	doc = binary.LittleEndian.AppendUint32(doc, 1)
+	doc = append(doc, 0x02)
+	doc = append(doc, "$db\x00"...)
+	doc = binary.LittleEndian.AppendUint32(doc, uint32(len("admin\x00")))
+	doc = append(doc, "admin\x00"...)
+	doc = append(binary.LittleEndian.AppendUint32(nil, uint32(4+len(doc)+1)), append(doc, 0)...)
+
+	msg := binary.LittleEndian.AppendUint32(nil, uint32(16+4+1+len(doc)))
+	msg = binary.LittleEndian.AppendUint32(msg, id)
+	msg = binary.LittleEndian.AppendUint32(msg, 0)    // responseTo
+	msg = binary.LittleEndian.AppendUint32(msg, 2013) // OP_MSG
+	msg = binary.LittleEndian.AppendUint32(msg, 0)    // flags
+	msg = append(msg, 0)                              // body section
+	msg = append(msg, doc...)
+	if _, err := conn.Write(msg); err != nil {
+		return nil, err
+	}
+
+	var header [16]byte
+	if _, err := io.ReadFull(conn, header[:]); err != nil {
+		return nil, err
+	}
+	length := binary.LittleEndian.Uint32(header[:])
+	if length < 16+4+1+5 || length > 1<<20 || binary.LittleEndian.Uint32(header[12:]) != 2013 {
+		return nil, errors.New("not an OP_MSG reply")
+	}
+	body := make([]byte, length-16)
+	if _, err := io.ReadFull(conn, body); err != nil {
+		return nil, err
+	}
+	if body[4] != 0 {
+		return nil, errors.New("no body section")
+	}
+	return bsonFields(body[5:])
+}
+
+// bsonFields decodes the top-level fields of a BSON document. Numbers come
+// back as float64 and strings and booleans as themselves; fields of other
+// types are skipped.
+func bsonFields(doc []byte) (map[string]any, error) {
+	errShort := errors.New("short BSON document")
+	if len(doc) < 5 {
+		return nil, errShort
+	}
+	end := binary.LittleEndian.Uint32(doc)
+	if end < 5 || uint64(end) > uint64(len(doc)) {
+		return nil, errShort
+	}
+	doc = doc[4:end]
+	fields := map[string]any{}
+	for len(doc) > 1 {
+		kind := doc[0]
+		name, rest, found := bytes.Cut(doc[1:], []byte{0})
+		if !found {
+			return nil, errShort
+		}
+		size := 0
+		switch kind {
+		case 0x01: // double
+			size = 8
+			if len(rest) >= size {
+				fields[string(name)] = math.Float64frombits(binary.LittleEndian.Uint64(rest))
+			}
+		case 0x02: // string
+			if len(rest) < 4 {
+				return nil, errShort
+			}
+			// the length counts the terminating NUL
+			n := binary.LittleEndian.Uint32(rest)
+			if n < 1 || uint64(n) > uint64(len(rest)-4) {
+				return nil, errShort
+			}
+			size = 4 + int(n)
+			fields[string(name)] = string(rest[4 : size-1])
+		case 0x03, 0x04: // document, array
+			if len(rest) < 4 {
+				return nil, errShort
+			}
+			n := binary.LittleEndian.Uint32(rest)
+			if n < 5 || uint64(n) > uint64(len(rest)) {
+				return nil, errShort
+			}
+			size = int(n)
+		case 0x05: // binary
+			if len(rest) < 5 {
+				return nil, errShort
+			}
+			n := binary.LittleEndian.Uint32(rest)
+			if uint64(n) > uint64(len(rest)-5) {
+				return nil, errShort
+			}
+			size = 4 + 1 + int(n)
+		case 0x07: // ObjectId
+			size = 12
+		case 0x08: // boolean
+			size = 1
+			if len(rest) >= size {
+				fields[string(name)] = rest[0] == 1
+			}
+		case 0x09, 0x11: // UTC datetime, timestamp
+			size = 8
+		case 0x0a, 0x7f, 0xff: // null, max key, min key
+		case 0x10: // int32
+			size = 4
+			if len(rest) >= size {
+				fields[string(name)] = float64(int32(binary.LittleEndian.Uint32(rest)))
+			}
+		case 0x12: // int64
+			size = 8
+			if len(rest) >= size {
+				fields[string(name)] = float64(int64(binary.LittleEndian.Uint64(rest)))
+			}
+		case 0x13: // decimal128
+			size = 16
+		default:
+			// regular expressions and the deprecated types; stop here
+			// rather than guess their size
+			return fields, nil
+		}
+		if size < 0 || len(rest) < size {
+			return nil, errShort
+		}
+		doc = rest[size:]
+	}
+	return fields, nil
+}
+
+// probeMemcached asks for the version over the text protocol. A server with
+// text protocol authentication answers every command before the login with
+// an error, so getting the version means anyone can read and write items.
+// Servers with only SASL, over the binary protocol, close the connection
+// and go undetected.
+func probeMemcached(conn net.Conn, _ string) (string, string, string, bool) {
+	if _, err := io.WriteString(conn, "version\r\n"); err != nil {
+		return "", "", "", false
+	}
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return "", "", "", false
+	}
+	line = strings.TrimRight(line, "\r\n")
+	switch {
+	case strings.HasPrefix(line, "VERSION "):
+		return "memcached", strings.TrimPrefix(line, "VERSION "), AuthNone, true
+	case line == "CLIENT_ERROR unauthenticated":
+		return "memcached", "", AuthRequired, true
+	}
+	return "", "", "", false
+}
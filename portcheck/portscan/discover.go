@@ -0,0 +1,283 @@
+package portscan
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/netip"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+// HostStatus is what host discovery found out about one host.
+type HostStatus struct {
+	Host string
+	Up   bool
+	// Reason is what gave the host away: "echo-reply", "syn-ack" or "reset".
+	Reason    string
+	LatencyMS float64
+}
+
+// Discover checks which hosts are up before their ports are scanned, so a
+// sweep of a sparse network doesn't wait out the timeout on every port of
+// every empty address. Each host is sent an ICMP echo and a TCP probe to
+// each of ports at once, and is up as soon as any of them is answered:
+// an echo reply, or a SYN-ACK or reset from a port. Hosts that stay silent
+// for Timeout are down. Up to Workers hosts are checked at a time, and the
+// statuses come back in the order of hosts.
+//
+// ICMP needs a raw socket (root or CAP_NET_RAW) or, on Linux, a group
+// allowed by net.ipv4.ping_group_range; without either, and through a
+// proxy, only the TCP probes are sent.
+func (s *Scanner) Discover(ctx context.Context, hosts []string, ports []int) []HostStatus {
+	var p4, p6 *pinger
+	if s.proxy == nil {
+		var err error
+		if s.opts.Family != "6" {
+			if p4, err = listenICMP(false, s.source); err != nil {
+				slog.Warn("ICMP echo unavailable, discovering hosts over TCP only", "err", err)
+			}
+		}
+		if s.opts.Family != "4" {
+			// many hosts have no IPv6 at all; TCP covers them
+			p6, _ = listenICMP(true, s.source)
+		}
+	}
+	defer func() {
+		for _, p := range []*pinger{p4, p6} {
+			if p != nil {
+				p.close()
+			}
+		}
+	}()
+
+	statuses := make([]HostStatus, len(hosts))
+	slots := make(chan struct{}, s.opts.Workers)
+	var wg sync.WaitGroup
+	for i, host := range hosts {
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			statuses[i] = HostStatus{Host: host}
+			continue
+		}
+		wg.Go(func() {
+			defer func() { <-slots }()
+			statuses[i] = s.discover(ctx, host, ports, p4, p6)
+		})
+	}
+	wg.Wait()
+	return statuses
+}
+
+func (s *Scanner) discover(ctx context.Context, host string, ports []int, p4, p6 *pinger) HostStatus {
+	ctx, cancel := context.WithTimeout(ctx, s.opts.Timeout)
+	defer cancel()
+	start := time.Now()
+	found := make(chan string, len(ports)+1)
+	var wg sync.WaitGroup
+	if p4 != nil || p6 != nil {
+		wg.Go(func() {
+			// the resolver drops the zone of a link-local literal
+			ip, err := netip.ParseAddr(host)
+			if err != nil {
+				ips, err := s.opts.Resolver.LookupNetIP(ctx, s.network("ip"), host)
+				if err != nil || len(ips) == 0 {
+					return
+				}
+				ip = ips[0]
+			}
+			ip = ip.Unmap()
+			p := p4
+			if ip.Is6() {
+				p = p6
+			}
+			if p != nil && p.ping(ctx, ip) {
+				found <- "echo-reply"
+			}
+		})
+	}
+	for _, port := range ports {
+		wg.Go(func() {
+			if reason := s.knock(ctx, net.JoinHostPort(host, strconv.Itoa(port))); reason != "" {
+				found <- reason
+			}
+		})
+	}
+	go func() {
+		wg.Wait()
+		close(found)
+	}()
+	st := HostStatus{Host: host}
+	if reason, ok := <-found; ok {
+		st.Up, st.Reason = true, reason
+		st.LatencyMS = milliseconds(time.Since(start))
+	}
+	return st
+}
+
+// knock probes one TCP port and says how the host answered, or "" if it
+// didn't. A refusal proves the host is there just as well as an accept.
+func (s *Scanner) knock(ctx context.Context, address string) string {
+	var state string
+	if s.syn != nil {
+		state = s.syn.probe(ctx, address, s.opts.Timeout, uint16(s.sourcePort())).State
+	} else {
+		conn, err := s.dial(ctx, "tcp", address)
+		if err == nil {
+			_ = conn.Close()
+			state = "open"
+		} else {
+			state, _ = classify(err)
+		}
+	}
+	switch state {
+	case "open":
+		return "syn-ack"
+	case "closed":
+		return "reset"
+	}
+	return ""
+}
+
+// pinger sends ICMP echo requests from one socket and hands each reply to
+// whoever is waiting on its sequence number.
+type pinger struct {
+	conn *icmp.PacketConn
+	v6   bool
+	// raw sockets see every ICMP packet on the host, so replies are matched
+	// by id; datagram sockets only get their own, with the id rewritten
+	raw bool
+	id  int
+	seq atomic.Uint32
+
+	mu      sync.Mutex
+	waiting map[int]echoWait
+}
+
+// echoWait is a ping waiting for its reply.
+type echoWait struct {
+	to    netip.Addr
+	reply chan struct{}
+}
+
+// listenICMP opens an unprivileged ICMP datagram socket if the system
+// allows one, or else a raw socket.
+func listenICMP(v6 bool, source netip.Addr) (*pinger, error) {
+	udp, raw, address := "udp4", "ip4:icmp", "0.0.0.0"
+	if v6 {
+		udp, raw, address = "udp6", "ip6:ipv6-icmp", "::"
+	}
+	if source.IsValid() {
+		if source.Is6() != v6 {
+			return nil, fmt.Errorf("source IP %s is of the other family", source)
+		}
+		address = source.String()
+	}
+	p := &pinger{v6: v6, id: os.Getpid() & 0xffff, waiting: map[int]echoWait{}}
+	var err error
+	if p.conn, err = icmp.ListenPacket(udp, address); err != nil {
+		if p.conn, err = icmp.ListenPacket(raw, address); err != nil {
+			return nil, err
+		}
+		p.raw = true
+	}
+	go p.receive()
+	return p, nil
+}
+
+func (p *pinger) close() {
+	_ = p.conn.Close()
+}
+
+func (p *pinger) receive() {
+	proto := 1
+	if p.v6 {
+		proto = 58
+	}
+	buf := make([]byte, 1500)
+	for {
+		n, from, err := p.conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		msg, err := icmp.ParseMessage(proto, buf[:n])
+		if err != nil || (msg.Type != ipv4.ICMPTypeEchoReply && msg.Type != ipv6.ICMPTypeEchoReply) {
+			continue
+		}
+		echo, ok := msg.Body.(*icmp.Echo)
+		if !ok || (p.raw && echo.ID != p.id) {
+			continue
+		}
+		var ip net.IP
+		switch a := from.(type) {
+		case *net.UDPAddr:
+			ip = a.IP
+		case *net.IPAddr:
+			ip = a.IP
+		}
+		addr, ok := netip.AddrFromSlice(ip)
+		if !ok {
+			continue
+		}
+		p.mu.Lock()
+		w, ok := p.waiting[echo.Seq]
+		if ok && w.to.WithZone("") == addr.Unmap() {
+			delete(p.waiting, echo.Seq)
+			close(w.reply)
+		}
+		p.mu.Unlock()
+	}
+}
+
+// ping sends an echo request to ip and reports whether a reply came back
+// before ctx ended.
+func (p *pinger) ping(ctx context.Context, ip netip.Addr) bool {
+	seq := int(p.seq.Add(1) & 0xffff)
+	w := echoWait{ip, make(chan struct{})}
+	p.mu.Lock()
+	p.waiting[seq] = w
+	p.mu.Unlock()
+	defer func() {
+		p.mu.Lock()
+		if p.waiting[seq].reply == w.reply {
+			delete(p.waiting, seq)
+		}
+		p.mu.Unlock()
+	}()
+
+	var typ icmp.Type = ipv4.ICMPTypeEcho
+	if p.v6 {
+		typ = ipv6.ICMPTypeEchoRequest
+	}
+	msg := icmp.Message{Type: typ, Body: &icmp.Echo{
+		ID:   p.id,
+		Seq:  seq,
+		Data: []byte("portcheck"),
+	}}
+	b, err := msg.Marshal(nil)
+	if err != nil {
+		return false
+	}
+	var to net.Addr = &net.IPAddr{IP: ip.AsSlice(), Zone: ip.Zone()}
+	if !p.raw {
+		to = &net.UDPAddr{IP: ip.AsSlice(), Zone: ip.Zone()}
+	}
+	if _, err := p.conn.WriteTo(b, to); err != nil {
+		return false
+	}
+	select {
+	case <-w.reply:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,188 @@
+package portscan
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"sync"
+	"time"
+)
+
+// dualStackDelay is how long IPv4 waits for IPv6 before racing it, the
+// connection attempt delay of RFC 8305 as Go's dialer uses it.
+const dualStackDelay = 300 * time.Millisecond
+
+// DualStack is how one port of a host with both A and AAAA records answered
+// over each family, with DualStack.
+type DualStack struct {
+	// First is the family that connected first, "ipv6" or "ipv4", or ""
+	// if neither did.
+	First string `json:"first,omitempty"`
+	// IPv4 and IPv6 are the states of the port over each family, and the
+	// addresses they were probed at.
+	IPv4     string `json:"ipv4"`
+	IPv6     string `json:"ipv6"`
+	IPv4Addr string `json:"ipv4_addr"`
+	IPv6Addr string `json:"ipv6_addr"`
+}
+
+// Mismatch reports whether the port answers differently over IPv4 and IPv6.
+func (d *DualStack) Mismatch() bool {
+	return d.IPv4 != d.IPv6
+}
+
+func (d *DualStack) String() string {
+	s := fmt.Sprintf("ipv4 %s, ipv6 %s", d.IPv4, d.IPv6)
+	if d.First != "" {
+		s += ", " + d.First + " first"
+	}
+	if d.Mismatch() {
+		s += ", MISMATCH"
+	}
+	return s
+}
+
+// familyAttempt is one family's leg of a dual-stack probe.
+type familyAttempt struct {
+	family  string
+	conn    net.Conn
+	err     error
+	latency time.Duration
+}
+
+// probeDualStack races IPv6 and IPv4 connects to a hostname the way Happy
+// Eyeballs does, IPv6 first and IPv4 after dualStackDelay or as soon as
+// IPv6 fails, but lets the slower family finish too so both states are
+// known. The port is open if either family connected, and is inspected
+// over the one that did first. Literal addresses and names with records
+// of one family only get an ordinary probe.
+func (s *Scanner) probeDualStack(ctx context.Context, address string) Result {
+	host, port, _ := net.SplitHostPort(address)
+	if _, err := netip.ParseAddr(host); err == nil {
+		return s.probeTCP(ctx, address)
+	}
+	v4, v6, err := s.dualStack.lookup(ctx, s.opts.Resolver, host, s.probeTimeout(host))
+	if err != nil {
+		r := newResult(address, "tcp")
+		r.setError(&net.OpError{Op: "dial", Net: "tcp", Err: err})
+		return r
+	}
+	if !v4.IsValid() || !v6.IsValid() {
+		return s.probeTCP(ctx, address)
+	}
+
+	r := newResult(address, "tcp")
+	timeout := s.probeTimeout(host)
+	attempts := make(chan familyAttempt, 2)
+	v6Failed := make(chan struct{})
+	start := time.Now()
+	dial := func(family string, ip netip.Addr) {
+		dialCtx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		conn, err := s.netDialer("tcp").DialContext(dialCtx, "tcp", net.JoinHostPort(ip.String(), port))
+		attempts <- familyAttempt{family, conn, err, time.Since(start)}
+	}
+	go func() {
+		dial("ipv6", v6)
+	}()
+	go func() {
+		select {
+		case <-time.After(dualStackDelay):
+		case <-v6Failed:
+		case <-ctx.Done():
+		}
+		dial("ipv4", v4)
+	}()
+
+	ds := &DualStack{IPv4Addr: v4.String(), IPv6Addr: v6.String()}
+	var first familyAttempt
+	var failed []familyAttempt
+	for range 2 {
+		a := <-attempts
+		state := "open"
+		if a.err != nil {
+			state, _ = classify(a.err)
+			failed = append(failed, a)
+			if a.family == "ipv6" {
+				close(v6Failed)
+			}
+		} else if first.conn == nil {
+			first = a
+		} else {
+			_ = a.conn.Close()
+		}
+		if a.family == "ipv6" {
+			ds.IPv6 = state
+		} else {
+			ds.IPv4 = state
+		}
+	}
+	r.DualStack = ds
+	if first.conn == nil {
+		// neither connected: report the IPv6 failure, the one Happy
+		// Eyeballs would have waited on
+		a := failed[0]
+		if failed[1].family == "ipv6" {
+			a = failed[1]
+		}
+		r.LatencyMS = milliseconds(a.latency)
+		r.setError(a.err)
+		return r
+	}
+	ds.First = first.family
+	r.State = "open"
+	r.LatencyMS = milliseconds(first.latency)
+	var banner []byte
+	if s.wantsBanner() {
+		banner = s.readBanner(first.conn)
+		if s.opts.Banners {
+			r.Banner = cleanBanner(banner)
+		}
+	}
+	_ = first.conn.Close()
+	s.inspect(ctx, &r, address, banner)
+	return r
+}
+
+// dualStackNames caches the first IPv4 and IPv6 address of each hostname,
+// so every port of a host is raced between the same two addresses and the
+// name is only looked up once.
+type dualStackNames struct {
+	mu    sync.Mutex
+	names map[string]*dualStackName
+}
+
+type dualStackName struct {
+	once   sync.Once
+	v4, v6 netip.Addr
+	err    error
+}
+
+func (d *dualStackNames) lookup(ctx context.Context, resolver *net.Resolver, host string, timeout time.Duration) (v4, v6 netip.Addr, err error) {
+	d.mu.Lock()
+	n, ok := d.names[host]
+	if !ok {
+		n = &dualStackName{}
+		d.names[host] = n
+	}
+	d.mu.Unlock()
+	n.once.Do(func() {
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		var ips []netip.Addr
+		if ips, n.err = resolver.LookupNetIP(ctx, "ip", host); n.err != nil {
+			return
+		}
+		for _, ip := range ips {
+			ip = ip.Unmap()
+			switch {
+			case ip.Is4() && !n.v4.IsValid():
+				n.v4 = ip
+			case ip.Is6() && !n.v6.IsValid():
+				n.v6 = ip
+			}
+		}
+	})
+	return n.v4, n.v6, n.err
+}
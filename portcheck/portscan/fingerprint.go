@@ -0,0 +1,177 @@
+package portscan
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// serviceProbe is one active check for DetectVersions. run gets a fresh
+// connection and returns the service and version it found, and for
+// datastores whether it wants credentials (see Result.Auth), or ok=false if
+// the port doesn't speak that protocol.
+type serviceProbe struct {
+	name  string
+	ports []int // tried first on these ports
+	run   func(conn net.Conn, host string) (service, version, auth string, ok bool)
+}
+
+var serviceProbes = []serviceProbe{
+	{name: "http", ports: []int{80, 8000, 8008, 8080, 8081, 8888, 9000, 9090}, run: probeHTTP},
+	{name: "tls", ports: []int{443, 465, 636, 853, 993, 995, 2376, 6443, 8443, 9443}, run: probeTLS},
+	{name: "redis", ports: []int{6379}, run: probeRedis},
+	{name: "postgresql", ports: []int{5432}, run: probePostgres},
+	{name: "mongodb", ports: []int{27017, 27018, 27019}, run: probeMongoDB},
+	{name: "memcached", ports: []int{11211}, run: probeMemcached},
+}
+
+// bannerPatterns identify services that speak first. The first capture
+// group, if any, is the version.
+var bannerPatterns = []struct {
+	service string
+	re      *regexp.Regexp
+}{
+	{"ssh", regexp.MustCompile(`^SSH-[\d.]+-(\S+)`)},
+	{"ftp", regexp.MustCompile(`(?i)^220[ -](?:.*?\b((?:vsFTPd|ProFTPD|Pure-FTPd|FileZilla Server)[ \w.]*)|.*\bFTP\b)`)},
+	{"smtp", regexp.MustCompile(`(?i)^220[ -](?:\S+ )?(?:ESMTP|SMTP)\b ?(\S*)`)},
+	{"pop3", regexp.MustCompile(`^\+OK ?(.*)`)},
+	{"imap", regexp.MustCompile(`^\* OK (?:\[[^\]]*\] )?(.*)`)},
+	{"vnc", regexp.MustCompile(`^RFB (\d+\.\d+)`)},
+	{"mysql", regexp.MustCompile(`^(?s).{4}\x0a([0-9][\w.\-]*)\x00`)},
+	// error 1130, the client's host isn't allowed to connect
+	{"mysql", regexp.MustCompile(`^(?s).{4}\xff\x6a\x04`)},
+}
+
+// fingerprint identifies the service on an open port. banner is whatever the
+// service sent unprompted, or nil if nobody has listened for one yet. If it
+// sent nothing the active probes are tried on new connections, most likely
+// first.
+func (s *Scanner) fingerprint(ctx context.Context, address string, port int, banner []byte) (service, version, auth string) {
+	if s.opts.ServiceProbes != nil {
+		service, version = s.fingerprintProbes(ctx, address, port, banner)
+		return service, version, ""
+	}
+	if banner == nil {
+		conn, err := s.dial(ctx, "tcp", address)
+		if err != nil {
+			return "", "", ""
+		}
+		banner = s.readBanner(conn)
+		_ = conn.Close()
+	}
+	for _, p := range bannerPatterns {
+		if m := p.re.FindSubmatch(banner); m != nil {
+			if len(m) > 1 {
+				version = strings.TrimSpace(string(m[1]))
+			}
+			if p.service == "mysql" && s.opts.LoginChecks {
+				auth = s.mysqlAuth(ctx, address)
+			}
+			return p.service, cleanBanner([]byte(version)), auth
+		}
+	}
+	if len(banner) > 0 {
+		// it talks, but nothing we know; active probes would only confuse it
+		return "", "", ""
+	}
+	host, _, _ := net.SplitHostPort(address)
+	probes := slices.Clone(serviceProbes)
+	slices.SortStableFunc(probes, func(a, b serviceProbe) int {
+		return boolRank(slices.Contains(b.ports, port)) - boolRank(slices.Contains(a.ports, port))
+	})
+	for _, p := range probes {
+		conn, err := s.dial(ctx, "tcp", address)
+		if err != nil {
+			return "", "", ""
+		}
+		_ = conn.SetDeadline(time.Now().Add(s.opts.Timeout))
+		run := p.run
+		if p.name == "postgresql" && !s.opts.LoginChecks {
+			run = probePostgresSSL
+		}
+		service, version, auth, ok := run(conn, host)
+		_ = conn.Close()
+		if ok {
+			return service, version, auth
+		}
+	}
+	return "", "", ""
+}
+
+func boolRank(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func probeHTTP(conn net.Conn, host string) (string, string, string, bool) {
+	service, version, ok := httpExchange(conn, host, "http")
+	return service, version, "", ok
+}
+
+func httpExchange(conn net.Conn, host, service string) (string, string, bool) {
+	_, err := fmt.Fprintf(conn, "GET / HTTP/1.0\r\nHost: %s\r\nUser-Agent: portcheck\r\n\r\n", host)
+	if err != nil {
+		return "", "", false
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		return "", "", false
+	}
+	_ = resp.Body.Close()
+	return service, resp.Header.Get("Server"), true
+}
+
+func probeTLS(conn net.Conn, host string) (string, string, string, bool) {
+	tlsConn := tls.Client(conn, &tls.Config{
+		ServerName:         tlsServerName(host),
+		InsecureSkipVerify: true, // identifying, not trusting
+	})
+	if err := tlsConn.Handshake(); err != nil {
+		return "", "", "", false
+	}
+	if service, version, ok := httpExchange(tlsConn, host, "https"); ok {
+		return service, version, "", true
+	}
+	return "ssl", tls.VersionName(tlsConn.ConnectionState().Version), "", true
+}
+
+var redisVersion = regexp.MustCompile(`redis_version:(\S+)`)
+
+func probeRedis(conn net.Conn, _ string) (string, string, string, bool) {
+	if _, err := conn.Write([]byte("*1\r\n$4\r\nPING\r\n")); err != nil {
+		return "", "", "", false
+	}
+	reader := bufio.NewReader(conn)
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return "", "", "", false
+	}
+	switch {
+	case strings.HasPrefix(line, "+PONG"):
+	case strings.HasPrefix(line, "-NOAUTH"), strings.HasPrefix(line, "-DENIED"):
+		// DENIED is protected mode, which wants a password from anyone
+		// but localhost
+		return "redis", "", AuthRequired, true
+	default:
+		return "", "", "", false
+	}
+	if _, err := conn.Write([]byte("*2\r\n$4\r\nINFO\r\n$6\r\nserver\r\n")); err != nil {
+		return "redis", "", AuthNone, true
+	}
+	buf := make([]byte, 4096)
+	n, _ := reader.Read(buf)
+	if m := redisVersion.FindSubmatch(buf[:n]); m != nil {
+		return "redis", string(bytes.TrimSpace(m[1])), AuthNone, true
+	}
+	return "redis", "", AuthNone, true
+}
@@ -0,0 +1,55 @@
+package portscan
+
+import (
+	"context"
+	"sync"
+)
+
+// hostLimiter caps how many probes run against one host at a time, for
+// HostParallelism. A host's slots exist only while probes of it are running
+// or waiting, so a sweep of many hosts doesn't keep one per address.
+type hostLimiter struct {
+	per int
+
+	mu    sync.Mutex
+	hosts map[string]*hostSlots
+}
+
+type hostSlots struct {
+	slots chan struct{}
+	users int
+}
+
+func newHostLimiter(per int) *hostLimiter {
+	return &hostLimiter{per: per, hosts: map[string]*hostSlots{}}
+}
+
+// acquire waits for a free slot of host and returns the function that frees
+// it, or false if ctx ended first.
+func (l *hostLimiter) acquire(ctx context.Context, host string) (func(), bool) {
+	l.mu.Lock()
+	h := l.hosts[host]
+	if h == nil {
+		h = &hostSlots{slots: make(chan struct{}, l.per)}
+		l.hosts[host] = h
+	}
+	h.users++
+	l.mu.Unlock()
+	done := func() {
+		l.mu.Lock()
+		if h.users--; h.users == 0 {
+			delete(l.hosts, host)
+		}
+		l.mu.Unlock()
+	}
+	select {
+	case h.slots <- struct{}{}:
+		return func() {
+			<-h.slots
+			done()
+		}, true
+	case <-ctx.Done():
+		done()
+		return nil, false
+	}
+}
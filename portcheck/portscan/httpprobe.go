@@ -0,0 +1,99 @@
+package portscan
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"html"
+	"io"
+	"net"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// HTTPInfo is what an open port answered to a request for /.
+type HTTPInfo struct {
+	URL    string `json:"url"`
+	Status int    `json:"status"`
+	Server string `json:"server,omitempty"`
+	Title  string `json:"title,omitempty"`
+}
+
+var titlePattern = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+
+// tlsPorts are tried over HTTPS first by probeWeb.
+var tlsPorts = []int{443, 4443, 6443, 8443, 9443}
+
+func (s *Scanner) newWebClient() *http.Client {
+	return &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, addr string) (net.Conn, error) {
+				return s.dial(ctx, "tcp", addr)
+			},
+			TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
+			DisableKeepAlives: true,
+		},
+		// report redirects rather than chase them off the scanned host
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+}
+
+// probeWeb requests / from address over HTTP and HTTPS, in the order the port
+// suggests, and returns what the first one that answers says.
+func (s *Scanner) probeWeb(ctx context.Context, address string, port int, speaksTLS bool) *HTTPInfo {
+	schemes := []string{"http", "https"}
+	if speaksTLS || slices.Contains(tlsPorts, port) {
+		slices.Reverse(schemes)
+	}
+	for _, scheme := range schemes {
+		// the % of a link-local zone has to be escaped in a URL
+		host := strings.Replace(address, "%", "%25", 1)
+		if info := s.fetchWeb(ctx, scheme+"://"+host+"/"); info != nil {
+			return info
+		}
+	}
+	return nil
+}
+
+func (s *Scanner) fetchWeb(ctx context.Context, url string) *HTTPInfo {
+	ctx, cancel := context.WithTimeout(ctx, s.opts.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil
+	}
+	req.Header.Set("User-Agent", "portcheck")
+	resp, err := s.web.Do(req)
+	if err != nil {
+		return nil
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	_ = resp.Body.Close()
+	// plain HTTP to a TLS port; nginx and friends answer 400 for this
+	if req.URL.Scheme == "http" && resp.StatusCode == http.StatusBadRequest &&
+		strings.Contains(strings.ToLower(string(body)), "https") {
+		return nil
+	}
+	info := &HTTPInfo{
+		URL:    url,
+		Status: resp.StatusCode,
+		Server: resp.Header.Get("Server"),
+	}
+	if m := titlePattern.FindSubmatch(body); m != nil {
+		info.Title = strings.Join(strings.Fields(html.UnescapeString(string(m[1]))), " ")
+	}
+	return info
+}
+
+func (h *HTTPInfo) String() string {
+	s := fmt.Sprintf("%s %d", h.URL, h.Status)
+	if h.Server != "" {
+		s += " server=" + h.Server
+	}
+	if h.Title != "" {
+		s += fmt.Sprintf(" title=%q", h.Title)
+	}
+	return s
+}
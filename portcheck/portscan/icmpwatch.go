@@ -0,0 +1,283 @@
+package portscan
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"net/netip"
+	"sync"
+	"syscall"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+// icmpWait is how long a probe that failed the way an ICMP error makes
+// one fail waits for the watcher to read that error off its socket.
+const icmpWait = 50 * time.Millisecond
+
+// icmpKey identifies a probe by what ICMP errors quote of it: the
+// protocol and the destination it was sent to.
+type icmpKey struct {
+	proto string
+	addr  netip.AddrPort
+}
+
+// icmpReport is an ICMP destination unreachable quoting one of our probes.
+type icmpReport struct {
+	typ, code int
+	v6        bool
+	from      netip.Addr
+	at        time.Time
+}
+
+// icmpWatcher reads every ICMP destination unreachable the host receives,
+// over raw sockets, and keeps the ones that quote a TCP, UDP or SCTP packet until
+// the probe they answer asks for them. Errno alone can't tell a firewall's
+// administrative prohibition from a router that has no route, or say
+// which hop sent it.
+type icmpWatcher struct {
+	conns    []*icmp.PacketConn
+	resolver *net.Resolver
+
+	mu      sync.Mutex
+	reports map[icmpKey]icmpReport
+	names   map[string][]netip.Addr
+}
+
+// newICMPWatcher opens a raw ICMP socket for each family of family ("",
+// "4" or "6"); one of them is enough.
+func newICMPWatcher(family string, resolver *net.Resolver) (*icmpWatcher, error) {
+	w := &icmpWatcher{resolver: resolver, reports: map[icmpKey]icmpReport{}, names: map[string][]netip.Addr{}}
+	var firstErr error
+	listen := func(network, address string, v6 bool) {
+		conn, err := icmp.ListenPacket(network, address)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			return
+		}
+		w.conns = append(w.conns, conn)
+		go w.receive(conn, v6)
+	}
+	if family != "6" {
+		listen("ip4:icmp", "0.0.0.0", false)
+	}
+	if family != "4" {
+		listen("ip6:ipv6-icmp", "::", true)
+	}
+	if len(w.conns) == 0 {
+		return nil, fmt.Errorf("listening for ICMP errors (needs root or CAP_NET_RAW): %w", firstErr)
+	}
+	return w, nil
+}
+
+func (w *icmpWatcher) close() {
+	for _, c := range w.conns {
+		_ = c.Close()
+	}
+}
+
+func (w *icmpWatcher) receive(conn *icmp.PacketConn, v6 bool) {
+	proto := 1
+	if v6 {
+		proto = 58
+	}
+	buf := make([]byte, 1500)
+	for {
+		n, from, err := conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		msg, err := icmp.ParseMessage(proto, buf[:n])
+		if err != nil || (msg.Type != ipv4.ICMPTypeDestinationUnreachable && msg.Type != ipv6.ICMPTypeDestinationUnreachable) {
+			continue
+		}
+		body, ok := msg.Body.(*icmp.DstUnreach)
+		if !ok {
+			continue
+		}
+		key, ok := quotedProbe(body.Data, v6)
+		if !ok {
+			continue
+		}
+		r := icmpReport{typ: icmpTypeNumber(msg.Type), code: msg.Code, v6: v6, at: time.Now()}
+		if a, ok := from.(*net.IPAddr); ok {
+			r.from, _ = netip.AddrFromSlice(a.IP)
+			r.from = r.from.Unmap()
+		}
+		w.mu.Lock()
+		if len(w.reports) >= 1<<16 {
+			// nobody asked for these; unreachables for other programs' traffic
+			for k, old := range w.reports {
+				if time.Since(old.at) > time.Minute {
+					delete(w.reports, k)
+				}
+			}
+		}
+		w.reports[key] = r
+		w.mu.Unlock()
+	}
+}
+
+func icmpTypeNumber(t icmp.Type) int {
+	switch t := t.(type) {
+	case ipv4.ICMPType:
+		return int(t)
+	case ipv6.ICMPType:
+		return int(t)
+	}
+	return 0
+}
+
+// quotedProbe reads the protocol and destination out of the packet an ICMP
+// error quotes: its IP header and at least the first 8 bytes after it,
+// which hold the TCP, UDP or SCTP ports.
+func quotedProbe(data []byte, v6 bool) (icmpKey, bool) {
+	var next byte
+	var dst netip.Addr
+	var rest []byte
+	if v6 {
+		if len(data) < 40+4 {
+			return icmpKey{}, false
+		}
+		next = data[6]
+		dst = netip.AddrFrom16([16]byte(data[24:40]))
+		rest = data[40:]
+	} else {
+		if len(data) < 20 {
+			return icmpKey{}, false
+		}
+		ihl := int(data[0]&0x0f) * 4
+		if len(data) < ihl+4 {
+			return icmpKey{}, false
+		}
+		next = data[9]
+		dst = netip.AddrFrom4([4]byte(data[16:20]))
+		rest = data[ihl:]
+	}
+	var proto string
+	switch next {
+	case syscall.IPPROTO_TCP:
+		proto = "tcp"
+	case syscall.IPPROTO_UDP:
+		proto = "udp"
+	case 132: // SCTP, which Windows has no constant for
+		proto = "sctp"
+	default:
+		return icmpKey{}, false
+	}
+	port := binary.BigEndian.Uint16(rest[2:4])
+	return icmpKey{proto, netip.AddrPortFrom(dst, port)}, true
+}
+
+// refine replaces the state and reason of a probe that failed or went
+// unanswered with what an ICMP error about it says, if one came after
+// start. For UDP a port unreachable means the port is closed; anything else
+// means the packet was stopped on the way, and is filtered.
+func (w *icmpWatcher) refine(ctx context.Context, r *Result, start time.Time) {
+	if r.State == "open" {
+		return
+	}
+	addrs := w.addresses(ctx, r.Host)
+	wait := time.Duration(0)
+	if r.Reason == "no-route" || r.Reason == "refused" || r.Reason == "prohibited" {
+		// the kernel saw the error first; the watcher is a read behind
+		wait = icmpWait
+	}
+	deadline := time.Now().Add(wait)
+	for {
+		w.mu.Lock()
+		for _, addr := range addrs {
+			key := icmpKey{r.Proto, netip.AddrPortFrom(addr, uint16(r.Port))}
+			if rep, ok := w.reports[key]; ok && !rep.at.Before(start) {
+				delete(w.reports, key)
+				w.mu.Unlock()
+				r.State, r.Reason = rep.outcome(r.Proto)
+				r.ICMP = rep.String()
+				return
+			}
+		}
+		w.mu.Unlock()
+		if !time.Now().Before(deadline) || ctx.Err() != nil {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// addresses resolves host, once, to the addresses ICMP errors about it
+// would quote.
+func (w *icmpWatcher) addresses(ctx context.Context, host string) []netip.Addr {
+	if ip, err := netip.ParseAddr(host); err == nil {
+		return []netip.Addr{ip.WithZone("").Unmap()}
+	}
+	w.mu.Lock()
+	addrs, ok := w.names[host]
+	w.mu.Unlock()
+	if ok {
+		return addrs
+	}
+	ips, _ := w.resolver.LookupNetIP(ctx, "ip", host)
+	for _, ip := range ips {
+		addrs = append(addrs, ip.Unmap())
+	}
+	w.mu.Lock()
+	w.names[host] = addrs
+	w.mu.Unlock()
+	return addrs
+}
+
+// outcome maps the ICMP error to a state and reason, as nmap does: only a
+// UDP port unreachable is closed.
+func (r icmpReport) outcome(proto string) (state, reason string) {
+	code := r.code
+	if r.v6 {
+		switch code {
+		case 0:
+			return "filtered", "no-route"
+		case 1, 5, 6:
+			return "filtered", "admin-prohibited"
+		case 3:
+			return "filtered", "host-unreachable"
+		case 4:
+			if proto == "udp" {
+				return "closed", "port-unreachable"
+			}
+			return "filtered", "port-unreachable"
+		}
+		return "filtered", "unreachable"
+	}
+	switch code {
+	case 0, 6, 11:
+		return "filtered", "net-unreachable"
+	case 1, 7, 12:
+		return "filtered", "host-unreachable"
+	case 2:
+		return "filtered", "proto-unreachable"
+	case 3:
+		if proto == "udp" {
+			return "closed", "port-unreachable"
+		}
+		return "filtered", "port-unreachable"
+	case 9, 10, 13:
+		return "filtered", "admin-prohibited"
+	}
+	return "filtered", "unreachable"
+}
+
+func (r icmpReport) String() string {
+	family := "icmp"
+	if r.v6 {
+		family = "icmpv6"
+	}
+	s := fmt.Sprintf("%s type %d code %d", family, r.typ, r.code)
+	if r.from.IsValid() {
+		s += " from " + r.from.String()
+	}
+	return s
+}
@@ -0,0 +1,471 @@
+//go:build linux
+
+package portscan
+
+import (
+	"container/heap"
+	"context"
+	"net"
+	"net/netip"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// pollTick is the longest the poller sleeps, and so how late a timeout
+// may be noticed.
+const pollTick = 10 * time.Millisecond
+
+// poller runs the TCP connects of one Scan as non-blocking sockets on an
+// epoll instance, for Engine "epoll". A probe in flight is a socket and a
+// few words of bookkeeping rather than a goroutine, so hundreds of
+// thousands of them fit where the net dialer would need gigabytes of
+// stacks. Only the follow-up work on open ports (banners, detection, TLS,
+// HTTP) and reverse DNS run on goroutines of their own.
+type poller struct {
+	s       *Scanner
+	ctx     context.Context
+	epfd    int
+	results chan Result
+	release func(Result)
+
+	namesMu sync.Mutex
+	names   map[string][]netip.Addr
+
+	mu       sync.Mutex
+	inflight map[int]*pollProbe
+	timeouts probeHeap
+	// outstanding counts the probes launched and not yet emitted
+	outstanding int
+	// broken is why epoll_wait failed, if it did; the probes in flight and
+	// any still to start fail with it, which ends the scan
+	broken error
+	// followups counts the goroutines doing work off the poller
+	followups sync.WaitGroup
+}
+
+// pollProbe is one connect in flight.
+type pollProbe struct {
+	fd       int
+	address  string
+	r        Result
+	attempt  int
+	start    time.Time
+	deadline time.Time
+	index    int
+	ptr      *ptrLookup
+	free     func()
+}
+
+func canPoll() error {
+	return nil
+}
+
+// pollScan is Scan on the epoll engine.
+func (s *Scanner) pollScan(launch, ctx context.Context, addresses <-chan string, slots chan struct{}, release func(Result)) <-chan Result {
+	p := &poller{
+		s:        s,
+		ctx:      ctx,
+		results:  make(chan Result),
+		release:  release,
+		names:    map[string][]netip.Addr{},
+		inflight: map[int]*pollProbe{},
+	}
+	var err error
+	if p.epfd, err = syscall.EpollCreate1(syscall.EPOLL_CLOEXEC); err != nil {
+		// without epoll every probe fails the same way; say so through them
+		go func() {
+			defer close(p.results)
+			for address := range addresses {
+				r := newResult(address, "tcp")
+				r.setError(os.NewSyscallError("epoll_create1", err))
+				p.results <- r
+			}
+		}()
+		return p.results
+	}
+	dispatched := make(chan struct{})
+	go func() {
+		defer close(dispatched)
+	loop:
+		for address := range addresses {
+			select {
+			case slots <- struct{}{}:
+			case <-launch.Done():
+				break loop
+			case <-ctx.Done():
+				break loop
+			}
+			p.launch(address)
+		}
+	}()
+	go func() {
+		defer close(p.results)
+		defer syscall.Close(p.epfd)
+		p.run(dispatched)
+		p.followups.Wait()
+	}()
+	return p.results
+}
+
+// launch starts the first attempt at address, once its host has a free
+// slot.
+func (p *poller) launch(address string) {
+	p.mu.Lock()
+	p.outstanding++
+	p.mu.Unlock()
+	r := newResult(address, "tcp")
+	probe := &pollProbe{address: address, r: r, free: func() {}}
+	if p.s.hosts != nil {
+		free, ok := p.s.hosts.acquire(p.ctx, r.Host)
+		if !ok {
+			probe.r.setError(p.ctx.Err())
+			p.emit(probe)
+			return
+		}
+		probe.free = free
+	}
+	if p.s.rdns != nil {
+		probe.ptr = p.s.rdns.start(r.Host)
+	}
+	p.attempt(probe)
+}
+
+// attempt opens a socket and starts connecting it; answers that come back
+// at once are handled right away.
+func (p *poller) attempt(probe *pollProbe) {
+	if p.s.limiter != nil {
+		p.s.limiter.take(p.ctx)
+	}
+	probe.attempt++
+	probe.r = newResult(probe.address, "tcp")
+	probe.start = time.Now()
+	sa, err := p.sockaddr(probe.r.Host, probe.r.Port)
+	if err != nil {
+		probe.r.setError(err)
+		p.finish(probe)
+		return
+	}
+	family := syscall.AF_INET
+	if _, ok := sa.(*syscall.SockaddrInet6); ok {
+		family = syscall.AF_INET6
+	}
+	fd, err := syscall.Socket(family, syscall.SOCK_STREAM|syscall.SOCK_NONBLOCK|syscall.SOCK_CLOEXEC, 0)
+	if err != nil {
+		probe.r.setError(p.dialError(probe, os.NewSyscallError("socket", err)))
+		p.finish(probe)
+		return
+	}
+	probe.fd = fd
+	if err := p.prepare(fd, family, probe.address); err != nil {
+		_ = syscall.Close(fd)
+		probe.r.setError(p.dialError(probe, err))
+		p.finish(probe)
+		return
+	}
+	err = syscall.Connect(fd, sa)
+	if err != nil && err != syscall.EINPROGRESS {
+		p.answered(probe, err)
+		return
+	}
+	// register before the connect can finish unseen; EPOLLONESHOT makes the
+	// first event the only one. p.mu is held until epoll has the socket, so
+	// expire can't close it in between.
+	probe.deadline = probe.start.Add(p.s.probeTimeout(probe.r.Host))
+	p.mu.Lock()
+	if broken := p.broken; broken != nil {
+		p.mu.Unlock()
+		p.answered(probe, broken)
+		return
+	}
+	p.inflight[fd] = probe
+	heap.Push(&p.timeouts, probe)
+	ev := syscall.EpollEvent{Events: syscall.EPOLLOUT | syscall.EPOLLONESHOT, Fd: int32(fd)}
+	err = syscall.EpollCtl(p.epfd, syscall.EPOLL_CTL_ADD, fd, &ev)
+	if err != nil && p.inflight[fd] == probe {
+		delete(p.inflight, fd)
+		heap.Remove(&p.timeouts, probe.index)
+		p.mu.Unlock()
+		p.answered(probe, os.NewSyscallError("epoll_ctl", err))
+		return
+	}
+	p.mu.Unlock()
+}
+
+// prepare binds the socket to the source address, port and interface, as
+// netDialer does for the net dialer.
+func (p *poller) prepare(fd, family int, address string) error {
+	s := p.s
+	if s.control != nil {
+		if err := s.control("tcp", address, rawFD(fd)); err != nil {
+			return err
+		}
+	}
+	port := s.sourcePort()
+	if !s.source.IsValid() && port == 0 {
+		return nil
+	}
+	var local syscall.Sockaddr
+	if family == syscall.AF_INET6 {
+		a := &syscall.SockaddrInet6{Port: port}
+		if s.source.IsValid() {
+			a.Addr = s.source.As16()
+			a.ZoneId = zoneIndex(s.source.Zone())
+		}
+		local = a
+	} else {
+		a := &syscall.SockaddrInet4{Port: port}
+		if s.source.IsValid() {
+			a.Addr = s.source.As4()
+		}
+		local = a
+	}
+	return os.NewSyscallError("bind", syscall.Bind(fd, local))
+}
+
+// sockaddr resolves host, once per scan, to the address to connect to.
+func (p *poller) sockaddr(host string, port int) (syscall.Sockaddr, error) {
+	p.namesMu.Lock()
+	defer p.namesMu.Unlock()
+	ips, ok := p.names[host]
+	if !ok {
+		if ip, err := netip.ParseAddr(host); err == nil {
+			ips = []netip.Addr{ip}
+		} else if ips, err = p.s.opts.Resolver.LookupNetIP(p.ctx, p.s.network("ip"), host); err != nil {
+			return nil, &net.OpError{Op: "dial", Net: "tcp", Err: err}
+		}
+		p.names[host] = ips
+	}
+	if len(ips) == 0 {
+		return nil, &net.OpError{Op: "dial", Net: "tcp", Err: &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}}
+	}
+	ip := ips[0].Unmap()
+	if s := p.s.source; s.IsValid() && s.Is4() != ip.Is4() {
+		return nil, &net.OpError{Op: "dial", Net: "tcp", Err: &net.AddrError{Err: "no address of the source IP's family", Addr: host}}
+	}
+	if ip.Is4() {
+		return &syscall.SockaddrInet4{Port: port, Addr: ip.As4()}, nil
+	}
+	sa := &syscall.SockaddrInet6{Port: port, Addr: ip.As16()}
+	if zone := ip.Zone(); zone != "" {
+		sa.ZoneId = zoneIndex(zone)
+	}
+	return sa, nil
+}
+
+// run waits for connects to finish or time out until every address has
+// been dispatched and every probe emitted.
+func (p *poller) run(dispatched <-chan struct{}) {
+	events := make([]syscall.EpollEvent, 1024)
+	for {
+		n, err := syscall.EpollWait(p.epfd, events, int(pollTick/time.Millisecond))
+		if err != nil && err != syscall.EINTR {
+			// waiting again would fail again, at once: fail the probes
+			// instead, pacing the loop while the rest are dispatched
+			p.mu.Lock()
+			if p.broken == nil {
+				p.broken = os.NewSyscallError("epoll_wait", err)
+			}
+			p.mu.Unlock()
+			n = 0
+			time.Sleep(pollTick)
+		}
+		for _, ev := range events[:max(n, 0)] {
+			p.mu.Lock()
+			probe := p.inflight[int(ev.Fd)]
+			if probe != nil {
+				delete(p.inflight, int(ev.Fd))
+				heap.Remove(&p.timeouts, probe.index)
+			}
+			p.mu.Unlock()
+			if probe == nil {
+				continue
+			}
+			_ = syscall.EpollCtl(p.epfd, syscall.EPOLL_CTL_DEL, probe.fd, nil)
+			errno, err := syscall.GetsockoptInt(probe.fd, syscall.SOL_SOCKET, syscall.SO_ERROR)
+			if err == nil && errno != 0 {
+				err = syscall.Errno(errno)
+			}
+			if err != nil {
+				err = os.NewSyscallError("connect", err)
+			}
+			p.answered(probe, err)
+		}
+		p.expire()
+		select {
+		case <-dispatched:
+			p.mu.Lock()
+			idle := p.outstanding == 0
+			p.mu.Unlock()
+			if idle {
+				return
+			}
+		default:
+		}
+	}
+}
+
+// expire fails the probes whose deadline has passed, or all of them once
+// ctx has ended or epoll has broken.
+func (p *poller) expire() {
+	now := time.Now()
+	ended := p.ctx.Err()
+	if ended == nil {
+		p.mu.Lock()
+		ended = p.broken
+		p.mu.Unlock()
+	}
+	for {
+		p.mu.Lock()
+		if len(p.timeouts) == 0 || (ended == nil && p.timeouts[0].deadline.After(now)) {
+			p.mu.Unlock()
+			return
+		}
+		probe := heap.Pop(&p.timeouts).(*pollProbe)
+		delete(p.inflight, probe.fd)
+		p.mu.Unlock()
+		_ = syscall.EpollCtl(p.epfd, syscall.EPOLL_CTL_DEL, probe.fd, nil)
+		_ = syscall.Close(probe.fd)
+		probe.r.LatencyMS = milliseconds(time.Since(probe.start))
+		if ended != nil {
+			probe.r.setError(p.dialError(probe, ended))
+		} else {
+			probe.r.setError(p.dialError(probe, os.ErrDeadlineExceeded))
+		}
+		p.finish(probe)
+	}
+}
+
+// answered records how the connect of probe ended: err is nil for an
+// accepted connection.
+func (p *poller) answered(probe *pollProbe, err error) {
+	probe.r.LatencyMS = milliseconds(time.Since(probe.start))
+	if err != nil {
+		_ = syscall.Close(probe.fd)
+		probe.r.setError(p.dialError(probe, err))
+		p.finish(probe)
+		return
+	}
+	probe.r.State = "open"
+	s := p.s
+	if !s.wantsBanner() && !s.opts.TLSInfo && !s.opts.TLSAudit && !s.opts.HTTPProbe {
+		_ = syscall.Close(probe.fd)
+		p.finish(probe)
+		return
+	}
+	// hand the socket to the Go runtime for the follow-up checks
+	f := os.NewFile(uintptr(probe.fd), probe.address)
+	conn, errF := net.FileConn(f)
+	_ = f.Close()
+	p.followups.Go(func() {
+		if errF == nil {
+			var banner []byte
+			if s.wantsBanner() {
+				banner = s.readBanner(conn)
+				if s.opts.Banners {
+					probe.r.Banner = cleanBanner(banner)
+				}
+			}
+			_ = conn.Close()
+			s.inspect(p.ctx, &probe.r, probe.address, banner)
+		}
+		p.finish(probe)
+	})
+}
+
+func (p *poller) dialError(probe *pollProbe, err error) error {
+	if _, ok := err.(*net.OpError); ok {
+		return err
+	}
+	return &net.OpError{Op: "dial", Net: "tcp", Addr: addrOf(probe.address), Err: err}
+}
+
+// finish is Probe's bookkeeping after an attempt: retries of unanswered
+// ports, the RTT estimate and service names.
+func (p *poller) finish(probe *pollProbe) {
+	s := p.s
+	s.attempted(probe.address, probe.attempt, probe.r)
+	s.observeRTT(probe.r)
+	if retryable(probe.r) && probe.attempt <= s.opts.Retries && p.ctx.Err() == nil {
+		if s.limiter != nil {
+			// the limiter may make the retry wait; not on the poller
+			p.followups.Go(func() { p.attempt(probe) })
+		} else {
+			p.attempt(probe)
+		}
+		return
+	}
+	if probe.attempt > 1 {
+		probe.r.Attempts = probe.attempt
+	}
+	if s.opts.ServiceNames && probe.r.Service == "" {
+		probe.r.Service = ServiceName(probe.r.Proto, probe.r.Port)
+	}
+	if probe.ptr != nil {
+		p.followups.Go(func() {
+			probe.r.Hostname = probe.ptr.wait(p.ctx)
+			p.emit(probe)
+		})
+		return
+	}
+	p.emit(probe)
+}
+
+func (p *poller) emit(probe *pollProbe) {
+	probe.free()
+	p.results <- probe.r
+	p.release(probe.r)
+	p.mu.Lock()
+	p.outstanding--
+	p.mu.Unlock()
+}
+
+// addrOf is address as the net.Addr of a dial error.
+func addrOf(address string) net.Addr {
+	if ap, err := netip.ParseAddrPort(address); err == nil {
+		return net.TCPAddrFromAddrPort(ap)
+	}
+	return nil
+}
+
+// rawFD lets the dialer hooks work on a socket opened by hand.
+type rawFD int
+
+func (fd rawFD) Control(f func(fd uintptr)) error {
+	f(uintptr(fd))
+	return nil
+}
+
+func (fd rawFD) Read(f func(fd uintptr) bool) error {
+	f(uintptr(fd))
+	return nil
+}
+
+func (fd rawFD) Write(f func(fd uintptr) bool) error {
+	f(uintptr(fd))
+	return nil
+}
+
+// probeHeap orders probes in flight by deadline.
+type probeHeap []*pollProbe
+
+func (h probeHeap) Len() int           { return len(h) }
+func (h probeHeap) Less(i, j int) bool { return h[i].deadline.Before(h[j].deadline) }
+func (h probeHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index, h[j].index = i, j
+}
+
+func (h *probeHeap) Push(x any) {
+	probe := x.(*pollProbe)
+	probe.index = len(*h)
+	*h = append(*h, probe)
+}
+
+func (h *probeHeap) Pop() any {
+	old := *h
+	probe := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return probe
+}
@@ -0,0 +1,16 @@
+//go:build !linux
+
+package portscan
+
+import (
+	"context"
+	"errors"
+)
+
+func canPoll() error {
+	return errors.New("the epoll engine is Linux only")
+}
+
+func (s *Scanner) pollScan(context.Context, context.Context, <-chan string, chan struct{}, func(Result)) <-chan Result {
+	panic("unreachable: New refuses the epoll engine here")
+}
@@ -0,0 +1,661 @@
+// Package portscan is the scanning engine behind portcheck: TCP connect,
+// half-open SYN and UDP probes run on a bounded worker pool, with optional
+// banner grabbing, service and version detection, TLS certificate and HTTP
+// inspection of open ports.
+//
+//	s, err := portscan.New(portscan.Options{Timeout: time.Second, Banners: true})
+//	if err != nil {
+//		return err
+//	}
+//	defer s.Close()
+//	for r := range s.ScanAll(ctx, []string{"10.0.0.1:22", "10.0.0.1:443"}) {
+//		fmt.Println(r.Host, r.Port, r.State)
+//	}
+package portscan
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"iter"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"runtime"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Options configures a Scanner. The zero value is a TCP connect scan with a
+// 3 second timeout and ten workers per CPU.
+type Options struct {
+	// Timeout bounds each connection attempt; 3s if zero.
+	Timeout time.Duration
+	// AdaptiveTimeout shortens Timeout for each host to what its measured
+	// round-trip time calls for: the smoothed RTT of the probes it answered
+	// plus four times their variation, and no less than 100ms. Hosts wait
+	// the full Timeout until they first answer.
+	AdaptiveTimeout bool
+	// Workers is how many probes run at once; CPU cores × 10 if zero.
+	Workers int
+	// AdaptiveWorkers starts with fewer probes at once and grows the pool
+	// up to Workers while probes go well, shrinking it again when timeouts
+	// and resets become more common or the system runs out of sockets.
+	AdaptiveWorkers bool
+	// Engine picks how TCP connect probes run: "" dials each one from a
+	// goroutine of its own; "epoll" (Linux) drives them all as non-blocking
+	// sockets from one epoll instance, which lets Workers go into the
+	// hundreds of thousands. Not with UDP, SYN or Proxy.
+	Engine string
+	// HostParallelism caps how many probes run against any one host at a
+	// time, retries included, for small devices and per-source connection
+	// limits; 0 is an even share of Workers. Scan holds a host's probes
+	// back while it's at the cap and probes other hosts meanwhile; Probe
+	// waits for a free slot.
+	HostParallelism int
+	// UDP sends datagrams instead of connecting over TCP.
+	UDP bool
+	// SYN sends half-open SYN probes over a raw socket (Linux, IPv4, root
+	// or CAP_NET_RAW). Open ports are still inspected over a full connect.
+	SYN bool
+	// SCTP sends SCTP INIT chunks over a raw socket instead of connecting
+	// over TCP (Linux, IPv4, root or CAP_NET_RAW): an INIT-ACK is open, an
+	// ABORT closed. Open ports are not inspected, and VerifyOpen can't be
+	// used. Not with UDP, SYN, Proxy, DualStack or the epoll engine.
+	SCTP bool
+	// Family restricts resolution and dials to "4" or "6"; "" allows both.
+	Family string
+	// DualStack races IPv6 and IPv4 for every TCP port of a hostname with
+	// both A and AAAA records, and records how the port answered over each
+	// in Result.DualStack. Not with Family, SourceIP, UDP, SYN, Proxy or
+	// the epoll engine.
+	DualStack bool
+	// Retries is how many extra attempts a port that gave no answer gets.
+	Retries int
+	// Rate caps probes per second across all workers; 0 is unlimited.
+	Rate float64
+	// Delay spaces probe launches, retries included, across all workers;
+	// each gap is Delay give or take a random amount up to Jitter, which
+	// must not exceed it.
+	Delay  time.Duration
+	Jitter time.Duration
+	// Banners records what open ports send after connecting.
+	Banners bool
+	// BannerBytes caps how much of a banner is read; 256 if zero.
+	BannerBytes int
+	// DetectVersions probes open TCP ports to identify service and version.
+	DetectVersions bool
+	// ServiceProbes, if set, replaces the built-in fingerprints of
+	// DetectVersions with the probes and patterns of an nmap-service-probes
+	// database; see LoadServiceProbes.
+	ServiceProbes *ServiceProbes
+	// LoginChecks lets DetectVersions learn whether MySQL and PostgreSQL
+	// servers want credentials by logging in, as root and postgres with no
+	// password. The attempts show up as failed logins and can set off
+	// intrusion detection or lock accounts, so without it those servers
+	// are only identified.
+	LoginChecks bool
+	// TLSInfo records the certificate of open ports that speak TLS.
+	TLSInfo bool
+	// TLSAudit enumerates the protocol versions and cipher suites open
+	// ports that speak TLS accept, flagging deprecated versions and weak
+	// suites in Result.TLSAudit. It takes a handshake per version and per
+	// accepted suite.
+	TLSAudit bool
+	// SSHInfo records the identification string and offered algorithms of
+	// open ports that speak SSH, whatever the port, in Result.SSH.
+	SSHInfo bool
+	// HTTPProbe requests / from open ports and records the response.
+	HTTPProbe bool
+	// VerifyOpen only reports a TCP port open once it sends data or
+	// answers a TLS or HTTP exchange; ports that merely accept the
+	// connection are filtered, with reason "unverified". This costs up to
+	// three more connections and one or two banner waits per quiet port.
+	VerifyOpen bool
+	// Resolver looks up the host names of addresses; net.DefaultResolver if
+	// nil. A proxy resolves names itself, so it can't be combined with
+	// Proxy.
+	Resolver *net.Resolver
+	// Proxy sends every TCP connection through a SOCKS5 or HTTP CONNECT
+	// proxy: socks5://, http:// or https://[user:password@]host[:port].
+	// Host names are resolved by the proxy. UDP and SYN scans can't be
+	// proxied.
+	Proxy string
+	// SourceIP is the local address probes are sent from, for multi-homed
+	// hosts and source-specific firewall rules; the kernel picks if empty.
+	SourceIP string
+	// SourcePort pins the local port probes are sent from, for firewall
+	// rules that only let certain source ports through (Linux). If
+	// SourcePortEnd is set too, probes take the ports of the range in
+	// turn. Not with Proxy, whose connections come from the proxy.
+	SourcePort, SourcePortEnd int
+	// ICMPReasons listens for ICMP destination unreachables on raw sockets
+	// (root or CAP_NET_RAW) and uses the ones quoting a probe to tell an
+	// administrative prohibition from a missing route, and, for UDP, a
+	// closed port from a filtered one; Result.ICMP says which message it
+	// was. Ports with an ICMP answer are not retried. Not with the epoll
+	// engine.
+	ICMPReasons bool
+	// Interface sends probes out of the named network interface only
+	// (Linux, root or CAP_NET_RAW).
+	Interface string
+	// ReverseDNS fills Result.Hostname with the PTR name of IP targets. Each
+	// address is looked up once, alongside its first probe, with at most 16
+	// lookups at a time.
+	ReverseDNS bool
+	// ServiceNames fills Result.Service from the port's registered name when
+	// nothing better was found.
+	ServiceNames bool
+	// OnAttempt, if set, is called after every attempt at an address,
+	// retries included, from the worker that made it.
+	OnAttempt func(address string, attempt int, r Result)
+}
+
+// Result is the outcome of probing one host:port.
+type Result struct {
+	// Type is always "probe"; it tells results from summaries in JSON streams.
+	Type      string    `json:"type"`
+	Host      string    `json:"host"`
+	Port      int       `json:"port"`
+	Proto     string    `json:"proto"`
+	Service   string    `json:"service,omitempty"`
+	Version   string    `json:"version,omitempty"`
+	State     string    `json:"state"`
+	LatencyMS float64   `json:"latency_ms"`
+	Reason    string    `json:"reason,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	Attempts  int       `json:"attempts,omitempty"`
+	Banner    string    `json:"banner,omitempty"`
+	TLS       *TLSInfo  `json:"tls,omitempty"`
+	HTTP      *HTTPInfo `json:"http,omitempty"`
+	// Auth is whether the datastore DetectVersions found lets anyone in,
+	// AuthNone, or wants credentials, AuthRequired; "" for other services
+	// and datastores that didn't say.
+	Auth string `json:"auth,omitempty"`
+	// TLSAudit is what TLS versions and suites the port accepts, with
+	// Options.TLSAudit.
+	TLSAudit *TLSAudit `json:"tls_audit,omitempty"`
+	// SSH is how an SSH server identified itself, with Options.SSHInfo.
+	SSH *SSHInfo `json:"ssh,omitempty"`
+	// ICMP describes the ICMP error that decided State and Reason, with
+	// Options.ICMPReasons.
+	ICMP string `json:"icmp,omitempty"`
+	// DualStack is how a hostname's port answered over each family, with
+	// Options.DualStack.
+	DualStack *DualStack `json:"dual_stack,omitempty"`
+	// Hostname is the PTR name of Host, with ReverseDNS.
+	Hostname string `json:"hostname,omitempty"`
+	// Names are all the target names that resolved to Host, when the
+	// caller resolved them itself and there was more than one.
+	Names []string `json:"names,omitempty"`
+	// ASN, ASOrg and Country are the autonomous system announcing Host, its
+	// name and the country of Host, when the caller looked them up.
+	ASN     uint32 `json:"asn,omitempty"`
+	ASOrg   string `json:"as_org,omitempty"`
+	Country string `json:"country,omitempty"`
+
+	// Fingerprinted is set when Service and Version came from
+	// DetectVersions rather than the port table.
+	Fingerprinted bool `json:"-"`
+}
+
+// setError classifies a failed probe and records why it failed.
+func (r *Result) setError(err error) {
+	r.State, r.Reason = classify(err)
+	r.Error = err.Error()
+}
+
+// Scanner probes addresses according to its Options. It is safe for
+// concurrent use.
+type Scanner struct {
+	opts    Options
+	limiter throttle
+	syn     *synScanner
+	sctp    *sctpScanner
+	proxy   *proxyDialer
+	rdns    *reverseDNS
+	rtt     *rttTracker
+	icmp    *icmpWatcher
+	hosts   *hostLimiter
+	// dualStack caches the addresses dual-stack probes race between
+	dualStack *dualStackNames
+	source    netip.Addr
+	control   control
+	// nextPort counts handed out source ports
+	nextPort atomic.Uint64
+	web      *http.Client
+}
+
+// New validates opts, fills in defaults and, for SYN and SCTP scans, opens
+// the raw socket.
+func New(opts Options) (*Scanner, error) {
+	if opts.Timeout == 0 {
+		opts.Timeout = 3 * time.Second
+	}
+	if opts.Workers == 0 {
+		opts.Workers = runtime.NumCPU() * 10
+	}
+	if opts.BannerBytes == 0 {
+		opts.BannerBytes = 256
+	}
+	switch {
+	case opts.Timeout < 0:
+		return nil, errors.New("timeout must be positive")
+	case opts.Workers < 0:
+		return nil, errors.New("workers must be positive")
+	case opts.Retries < 0:
+		return nil, errors.New("retries must not be negative")
+	case opts.Rate < 0:
+		return nil, errors.New("rate must not be negative")
+	case opts.Delay < 0 || opts.Jitter < 0:
+		return nil, errors.New("delay and jitter must not be negative")
+	case opts.Jitter > opts.Delay:
+		return nil, errors.New("jitter must not exceed delay")
+	case opts.HostParallelism < 0:
+		return nil, errors.New("host parallelism must not be negative")
+	case opts.BannerBytes < 0:
+		return nil, errors.New("banner-bytes must be positive")
+	case opts.UDP && opts.SYN:
+		return nil, errors.New("UDP and SYN scans are mutually exclusive")
+	case opts.SYN && opts.Family == "6":
+		return nil, errors.New("SYN scan supports IPv4 targets only")
+	case opts.SCTP && (opts.UDP || opts.SYN):
+		return nil, errors.New("SCTP, UDP and SYN scans are mutually exclusive")
+	case opts.SCTP && opts.Family == "6":
+		return nil, errors.New("SCTP scan supports IPv4 targets only")
+	case opts.SCTP && (opts.Proxy != "" || opts.Engine != "" || opts.DualStack):
+		return nil, errors.New("SCTP scans can't go through a proxy, the epoll engine or dual-stack probing")
+	case opts.SCTP && opts.VerifyOpen:
+		return nil, errors.New("verifying open ports needs TCP")
+	case opts.Family != "" && opts.Family != "4" && opts.Family != "6":
+		return nil, fmt.Errorf("family must be 4 or 6, got %q", opts.Family)
+	case opts.Proxy != "" && (opts.UDP || opts.SYN):
+		return nil, errors.New("only TCP connect scans can go through a proxy")
+	case opts.SourcePort < 0 || opts.SourcePort > 65535 || opts.SourcePortEnd > 65535:
+		return nil, errors.New("source port must be between 1 and 65535")
+	case opts.SourcePortEnd != 0 && opts.SourcePortEnd < opts.SourcePort:
+		return nil, errors.New("source port range runs backwards")
+	case opts.SourcePortEnd != 0 && opts.SourcePort == 0:
+		return nil, errors.New("source port range needs a start")
+	case opts.Engine != "" && opts.Engine != "epoll":
+		return nil, fmt.Errorf("engine must be epoll or empty, got %q", opts.Engine)
+	case opts.Engine == "epoll" && (opts.UDP || opts.SYN || opts.Proxy != ""):
+		return nil, errors.New("the epoll engine runs TCP connect scans only, without a proxy")
+	case opts.ICMPReasons && opts.Engine != "":
+		return nil, errors.New("ICMP reasons aren't available with the epoll engine")
+	case opts.VerifyOpen && opts.UDP:
+		return nil, errors.New("verifying open ports needs TCP")
+	case opts.DualStack && (opts.UDP || opts.SYN || opts.Proxy != "" || opts.Engine != ""):
+		return nil, errors.New("dual-stack probing runs TCP connect scans only, without a proxy or the epoll engine")
+	case opts.DualStack && (opts.Family != "" || opts.SourceIP != ""):
+		return nil, errors.New("dual-stack probing needs both families, so it can't be pinned to one or to a source IP")
+	case opts.Resolver != nil && opts.Proxy != "":
+		return nil, errors.New("a proxy resolves host names itself, so it can't be given a resolver")
+	case opts.SourcePort != 0 && opts.Proxy != "":
+		return nil, errors.New("proxied connections come from the proxy, so their source port can't be pinned")
+	}
+	if opts.SourcePortEnd == 0 {
+		opts.SourcePortEnd = opts.SourcePort
+	}
+	if opts.Resolver == nil {
+		opts.Resolver = net.DefaultResolver
+	}
+	s := &Scanner{opts: opts}
+	if opts.DualStack {
+		s.dualStack = &dualStackNames{names: map[string]*dualStackName{}}
+	}
+	var err error
+	if opts.SourceIP != "" {
+		if s.source, err = netip.ParseAddr(opts.SourceIP); err != nil {
+			return nil, fmt.Errorf("bad source IP %q", opts.SourceIP)
+		}
+		s.source = s.source.Unmap()
+		switch {
+		case opts.Family == "4" && !s.source.Is4(), opts.Family == "6" && !s.source.Is6():
+			return nil, fmt.Errorf("source IP %s is not IPv%s", s.source, opts.Family)
+		case opts.SYN && !s.source.Is4():
+			return nil, errors.New("SYN scan needs an IPv4 source IP")
+		case opts.SCTP && !s.source.Is4():
+			return nil, errors.New("SCTP scan needs an IPv4 source IP")
+		}
+		if err := checkSourceIP(s.source); err != nil {
+			return nil, err
+		}
+	}
+	if opts.Interface != "" {
+		if s.control, err = bindToDevice(opts.Interface); err != nil {
+			return nil, err
+		}
+	}
+	if opts.Engine == "epoll" {
+		if err := canPoll(); err != nil {
+			return nil, err
+		}
+	}
+	if opts.SourcePort != 0 {
+		if err := canPinPort(); err != nil {
+			return nil, err
+		}
+		s.control = chain(s.control, pinPort)
+	}
+	if opts.Proxy != "" {
+		if s.proxy, err = newProxyDialer(opts.Proxy); err != nil {
+			return nil, err
+		}
+	}
+	if opts.ReverseDNS {
+		s.rdns = newReverseDNS(opts.Resolver, opts.Timeout)
+	}
+	if opts.HostParallelism > 0 {
+		s.hosts = newHostLimiter(opts.HostParallelism)
+	}
+	if opts.AdaptiveTimeout {
+		s.rtt = newRTTTracker(opts.Timeout)
+	}
+	s.web = s.newWebClient()
+	var limits throttles
+	if opts.Rate > 0 {
+		limits = append(limits, newTokenBucket(opts.Rate))
+	}
+	if opts.Delay > 0 {
+		limits = append(limits, newPacer(opts.Delay, opts.Jitter))
+	}
+	if len(limits) > 0 {
+		s.limiter = limits
+	}
+	if opts.ICMPReasons {
+		if s.icmp, err = newICMPWatcher(opts.Family, opts.Resolver); err != nil {
+			return nil, err
+		}
+	}
+	if opts.SYN {
+		if s.syn, err = newSYNScanner(opts, s.source); err != nil {
+			if s.icmp != nil {
+				s.icmp.close()
+			}
+			return nil, err
+		}
+	}
+	if opts.SCTP {
+		if s.sctp, err = newSCTPScanner(opts, s.source); err != nil {
+			if s.icmp != nil {
+				s.icmp.close()
+			}
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// Close releases the raw sockets of a SYN or SCTP scanner and the ICMP
+// watcher.
+func (s *Scanner) Close() error {
+	if s.icmp != nil {
+		s.icmp.close()
+	}
+	if s.syn != nil {
+		return s.syn.close()
+	}
+	if s.sctp != nil {
+		return s.sctp.close()
+	}
+	return nil
+}
+
+// Scan probes every host:port received from addresses on the worker pool and
+// streams the results, closing the channel once addresses is closed and every
+// probe has finished. Hosts share the workers, as scheduler describes, so
+// results come back in a different order than the addresses went in. When
+// ctx ends no new probes start and those in flight are cancelled.
+func (s *Scanner) Scan(ctx context.Context, addresses <-chan string) <-chan Result {
+	return s.ScanUntil(ctx, ctx, addresses)
+}
+
+// ScanUntil is Scan with a context of its own for starting probes: once
+// launch ends no new probes start and the addresses read ahead are dropped,
+// while the probes in flight run on until they finish or ctx ends. An
+// interrupted scan can so still collect its last answers.
+func (s *Scanner) ScanUntil(launch, ctx context.Context, addresses <-chan string) <-chan Result {
+	slots := make(chan struct{}, s.opts.Workers)
+	free := func(Result) { <-slots }
+	if s.opts.AdaptiveWorkers {
+		free = newWorkerTuner(slots).release
+	}
+	addresses, finished := s.schedule(launch, ctx, addresses)
+	release := func(r Result) {
+		free(r)
+		finished(r.Host)
+	}
+	if s.opts.Engine == "epoll" {
+		return s.pollScan(launch, ctx, addresses, slots, release)
+	}
+	results := make(chan Result)
+	go func() {
+		wg := sync.WaitGroup{}
+	loop:
+		for address := range addresses {
+			select {
+			case slots <- struct{}{}:
+			case <-launch.Done():
+				break loop
+			case <-ctx.Done():
+				break loop
+			}
+			wg.Go(func() {
+				r := s.Probe(ctx, address)
+				results <- r
+				release(r)
+			})
+		}
+		wg.Wait()
+		close(results)
+	}()
+	return results
+}
+
+// ScanAll is Scan over a fixed list of addresses.
+func (s *Scanner) ScanAll(ctx context.Context, addresses []string) <-chan Result {
+	return s.ScanSeq(ctx, slices.Values(addresses))
+}
+
+// ScanSeq is Scan over the addresses of a sequence, which are taken from it
+// only as workers free up, so a scan too large to list in memory can be
+// generated on the fly.
+func (s *Scanner) ScanSeq(ctx context.Context, addresses iter.Seq[string]) <-chan Result {
+	feed := make(chan string)
+	go func() {
+		defer close(feed)
+		for address := range addresses {
+			select {
+			case feed <- address:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return s.Scan(ctx, feed)
+}
+
+// Run scans addresses and calls fn with each result as it arrives, from a
+// single goroutine. It returns once the scan is done or ctx ends.
+func (s *Scanner) Run(ctx context.Context, addresses []string, fn func(Result)) error {
+	for r := range s.ScanAll(ctx, addresses) {
+		fn(r)
+	}
+	return ctx.Err()
+}
+
+// Probe probes one host:port, trying again up to Retries times while the
+// port gives no answer at all. Lossy links drop SYNs and datagrams; a refusal
+// or an accept is definite and is never retried. Retries run in the caller's
+// worker slot, so they count against Workers like any other probe.
+func (s *Scanner) Probe(ctx context.Context, address string) Result {
+	if s.hosts != nil {
+		host, _, _ := net.SplitHostPort(address)
+		free, ok := s.hosts.acquire(ctx, host)
+		if !ok {
+			r := newResult(address, s.proto())
+			r.setError(ctx.Err())
+			return r
+		}
+		defer free()
+	}
+	var ptr *ptrLookup
+	if s.rdns != nil {
+		host, _, _ := net.SplitHostPort(address)
+		ptr = s.rdns.start(host)
+	}
+	r := s.probe(ctx, address)
+	s.attempted(address, 1, r)
+	attempts := 1
+	for ; attempts <= s.opts.Retries && retryable(r); attempts++ {
+		r = s.probe(ctx, address)
+		s.attempted(address, attempts+1, r)
+	}
+	if attempts > 1 {
+		r.Attempts = attempts
+	}
+	if s.opts.ServiceNames && r.Service == "" {
+		r.Service = ServiceName(r.Proto, r.Port)
+	}
+	r.Hostname = ptr.wait(ctx)
+	return r
+}
+
+// retryable reports whether r is worth another attempt: the port gave no
+// answer, rather than a connection nothing spoke on or an ICMP error.
+func retryable(r Result) bool {
+	return (r.State == "filtered" || r.State == "open|filtered") && r.Reason != "unverified" && r.ICMP == ""
+}
+
+func (s *Scanner) attempted(address string, attempt int, r Result) {
+	if s.opts.OnAttempt != nil {
+		s.opts.OnAttempt(address, attempt, r)
+	}
+}
+
+func (s *Scanner) probe(ctx context.Context, address string) Result {
+	if s.limiter != nil {
+		s.limiter.take(ctx)
+	}
+	start := time.Now()
+	var r Result
+	switch {
+	case s.opts.UDP:
+		r = s.probeUDP(ctx, address)
+	case s.syn != nil:
+		host, _, _ := net.SplitHostPort(address)
+		r = s.syn.probe(ctx, address, s.probeTimeout(host), uint16(s.sourcePort()))
+		if r.State == "open" {
+			s.inspect(ctx, &r, address, nil)
+		}
+	case s.sctp != nil:
+		host, _, _ := net.SplitHostPort(address)
+		r = s.sctp.probe(ctx, address, s.probeTimeout(host), uint16(s.sourcePort()))
+	case s.dualStack != nil:
+		r = s.probeDualStack(ctx, address)
+	default:
+		r = s.probeTCP(ctx, address)
+	}
+	if s.icmp != nil {
+		s.icmp.refine(ctx, &r, start)
+	}
+	s.observeRTT(r)
+	return r
+}
+
+// proto is the protocol ports are probed over: "tcp", "udp" or "sctp".
+func (s *Scanner) proto() string {
+	switch {
+	case s.opts.UDP:
+		return "udp"
+	case s.opts.SCTP:
+		return "sctp"
+	}
+	return "tcp"
+}
+
+// network narrows proto ("tcp", "udp" or "ip") to the chosen family, which
+// makes the resolver return only A or AAAA records.
+func (s *Scanner) network(proto string) string {
+	return proto + s.opts.Family
+}
+
+// dial connects over proto, restricted to the chosen family or through the
+// proxy, giving up after Timeout or when ctx ends, whichever comes first.
+func (s *Scanner) dial(ctx context.Context, proto, address string) (net.Conn, error) {
+	if s.proxy != nil && proto == "tcp" {
+		return s.proxy.dial(ctx, s.netDialer("tcp"), address)
+	}
+	return s.netDialer(proto).DialContext(ctx, s.network(proto), address)
+}
+
+func (s *Scanner) probeTCP(ctx context.Context, address string) Result {
+	r := newResult(address, "tcp")
+	start := time.Now()
+	dialCtx, cancel := context.WithTimeout(ctx, s.probeTimeout(r.Host))
+	conn, err := s.dial(dialCtx, "tcp", address)
+	cancel()
+	r.LatencyMS = milliseconds(time.Since(start))
+	if err != nil {
+		r.setError(err)
+		return r
+	}
+	r.State = "open"
+	var banner []byte
+	if s.wantsBanner() {
+		banner = s.readBanner(conn)
+		if s.opts.Banners {
+			r.Banner = cleanBanner(banner)
+		}
+	}
+	if errE := conn.Close(); errE != nil {
+		slog.Warn("closing connection failed", "err", errE)
+	}
+	s.inspect(ctx, &r, address, banner)
+	return r
+}
+
+// inspect runs the optional follow-up checks on an open TCP port. banner is
+// what the port sent on connect, or nil if it wasn't read.
+func (s *Scanner) inspect(ctx context.Context, r *Result, address string, banner []byte) {
+	if s.opts.DetectVersions {
+		if service, version, auth := s.fingerprint(ctx, address, r.Port, banner); service != "" {
+			r.Service, r.Version, r.Auth, r.Fingerprinted = service, version, auth, true
+		}
+	}
+	if s.opts.VerifyOpen && !r.Fingerprinted && !s.verifyOpen(ctx, address, r.Port, banner) {
+		r.State, r.Reason, r.Error = "filtered", "unverified", errUnverified
+		return
+	}
+	if s.opts.SSHInfo && (banner == nil || bytes.HasPrefix(banner, []byte("SSH-")) || bytes.Contains(banner, []byte("\nSSH-"))) {
+		r.SSH = s.inspectSSH(ctx, address)
+	}
+	starttls := starttlsProtocol(r.Port, r.Service)
+	if s.opts.TLSInfo {
+		r.TLS = s.inspectTLS(ctx, address, starttls)
+	}
+	if s.opts.TLSAudit {
+		r.TLSAudit = s.auditTLS(ctx, address, starttls)
+	}
+	if s.opts.HTTPProbe {
+		implicitTLS := starttls == "" && (r.TLS != nil || r.TLSAudit != nil)
+		r.HTTP = s.probeWeb(ctx, address, r.Port, implicitTLS || r.Service == "https")
+	}
+}
+
+// newResult is the result of probing address over proto, before the probe.
+func newResult(address, proto string) Result {
+	host, port, _ := net.SplitHostPort(address)
+	p, _ := strconv.Atoi(port)
+	return Result{Type: "probe", Host: host, Port: p, Proto: proto}
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
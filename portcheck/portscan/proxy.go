@@ -0,0 +1,285 @@
+package portscan
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// proxyDialer opens TCP connections through a SOCKS5 proxy (RFC 1928) or
+// an HTTP proxy's CONNECT tunnels, logging in with the user and password of
+// the proxy URL if it has them. Host names are passed to the proxy as they
+// are, so they resolve on its side of the network.
+type proxyDialer struct {
+	scheme         string
+	host, address  string
+	user, password string
+}
+
+// proxyPorts are the ports of proxy URLs that don't name one.
+var proxyPorts = map[string]string{"socks5": "1080", "socks5h": "1080", "http": "80", "https": "443"}
+
+// ProxyError is a failure to reach or talk to the proxy, as opposed to an
+// answer about the scanned port.
+type ProxyError struct {
+	Proxy string
+	Err   error
+}
+
+func (e *ProxyError) Error() string {
+	return fmt.Sprintf("proxy %s: %s", e.Proxy, e.Err)
+}
+
+func newProxyDialer(raw string) (*proxyDialer, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("bad proxy URL %q: %w", raw, err)
+	}
+	defaultPort, ok := proxyPorts[u.Scheme]
+	if !ok {
+		return nil, fmt.Errorf("bad proxy URL %q: want socks5://, http:// or https://[user:password@]host[:port]", raw)
+	}
+	if u.Hostname() == "" {
+		return nil, fmt.Errorf("bad proxy URL %q: no host", raw)
+	}
+	p := &proxyDialer{scheme: u.Scheme, host: u.Hostname(), address: u.Host}
+	if u.Port() == "" {
+		p.address = net.JoinHostPort(u.Hostname(), defaultPort)
+	}
+	if u.User != nil {
+		p.user = u.User.Username()
+		p.password, _ = u.User.Password()
+		if strings.HasPrefix(p.scheme, "socks5") && (len(p.user) > 255 || len(p.password) > 255) {
+			return nil, errors.New("proxy user and password must be at most 255 bytes each")
+		}
+	}
+	return p, nil
+}
+
+// socksReplies maps the proxy's CONNECT failures onto the errors a direct
+// dial would have returned, so classify reads them the same way.
+var socksReplies = map[byte]error{
+	0x02: syscall.EACCES,
+	0x03: syscall.ENETUNREACH,
+	0x04: syscall.EHOSTUNREACH,
+	0x05: syscall.ECONNREFUSED,
+	0x06: syscall.ETIMEDOUT,
+}
+
+// dial asks the proxy to connect to address, reaching the proxy with d and
+// giving up after its timeout or when ctx ends, whichever comes first.
+func (p *proxyDialer) dial(ctx context.Context, d *net.Dialer, address string) (net.Conn, error) {
+	host, portText, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	port, err := strconv.Atoi(portText)
+	if err != nil {
+		return nil, fmt.Errorf("bad port in %q", address)
+	}
+	raw, err := d.DialContext(ctx, "tcp", p.address)
+	if err != nil {
+		return nil, &ProxyError{p.address, err}
+	}
+	_ = raw.SetDeadline(time.Now().Add(d.Timeout))
+	// unblock the handshake when ctx ends
+	stop := context.AfterFunc(ctx, func() { _ = raw.SetDeadline(time.Unix(1, 0)) })
+	conn, err := p.handshake(raw, host, port)
+	if err != nil {
+		stop()
+		_ = raw.Close()
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+	if !stop() {
+		_ = conn.Close()
+		return nil, ctx.Err()
+	}
+	_ = conn.SetDeadline(time.Time{})
+	return conn, nil
+}
+
+// handshake asks the proxy on conn for a connection to host:port.
+func (p *proxyDialer) handshake(conn net.Conn, host string, port int) (net.Conn, error) {
+	switch p.scheme {
+	case "https":
+		tc := tls.Client(conn, &tls.Config{ServerName: p.host})
+		if err := tc.Handshake(); err != nil {
+			return nil, &ProxyError{p.address, err}
+		}
+		return p.connect(tc, net.JoinHostPort(host, strconv.Itoa(port)))
+	case "http":
+		return p.connect(conn, net.JoinHostPort(host, strconv.Itoa(port)))
+	}
+	return conn, p.socks5(conn, host, port)
+}
+
+func (p *proxyDialer) socks5(conn net.Conn, host string, port int) error {
+	if len(host) > 255 {
+		return fmt.Errorf("host name %q is too long for SOCKS", host)
+	}
+	methods := []byte{0x00}
+	if p.user != "" {
+		methods = []byte{0x02}
+	}
+	greeting := append([]byte{0x05, byte(len(methods))}, methods...)
+	reply := make([]byte, 2)
+	if _, err := conn.Write(greeting); err != nil {
+		return &ProxyError{p.address, err}
+	}
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return &ProxyError{p.address, err}
+	}
+	switch {
+	case reply[0] != 0x05:
+		return &ProxyError{p.address, errors.New("not a SOCKS5 proxy")}
+	case reply[1] == 0x02 && p.user != "":
+		if err := p.authenticate(conn); err != nil {
+			return err
+		}
+	case reply[1] != 0x00:
+		return &ProxyError{p.address, errors.New("proxy accepts none of our authentication methods")}
+	}
+
+	req := []byte{0x05, 0x01, 0x00}
+	if ip, err := netip.ParseAddr(host); err != nil {
+		req = append(append(req, 0x03, byte(len(host))), host...)
+	} else if ip.Is4() {
+		req = append(append(req, 0x01), ip.AsSlice()...)
+	} else {
+		req = append(append(req, 0x04), ip.AsSlice()...)
+	}
+	req = binary.BigEndian.AppendUint16(req, uint16(port))
+	if _, err := conn.Write(req); err != nil {
+		return &ProxyError{p.address, err}
+	}
+	// the reply comes once the proxy has tried the port, so a deadline
+	// hit here is the port's silence and not the proxy's
+	head := make([]byte, 4)
+	if _, err := io.ReadFull(conn, head); err != nil {
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			return err
+		}
+		return &ProxyError{p.address, err}
+	}
+	if head[1] != 0x00 {
+		if errno, ok := socksReplies[head[1]]; ok {
+			return fmt.Errorf("socks connect %s: %w", net.JoinHostPort(host, strconv.Itoa(port)), errno)
+		}
+		return &ProxyError{p.address, fmt.Errorf("connect failed with reply %d", head[1])}
+	}
+	// skip the address the proxy bound, which scanning has no use for
+	var skip int
+	switch head[3] {
+	case 0x01:
+		skip = net.IPv4len
+	case 0x04:
+		skip = net.IPv6len
+	case 0x03:
+		n := make([]byte, 1)
+		if _, err := io.ReadFull(conn, n); err != nil {
+			return &ProxyError{p.address, err}
+		}
+		skip = int(n[0])
+	default:
+		return &ProxyError{p.address, fmt.Errorf("bad address type %d in reply", head[3])}
+	}
+	if _, err := io.ReadFull(conn, make([]byte, skip+2)); err != nil {
+		return &ProxyError{p.address, err}
+	}
+	return nil
+}
+
+func (p *proxyDialer) authenticate(conn net.Conn) error {
+	req := append([]byte{0x01, byte(len(p.user))}, p.user...)
+	req = append(append(req, byte(len(p.password))), p.password...)
+	if _, err := conn.Write(req); err != nil {
+		return &ProxyError{p.address, err}
+	}
+	reply := make([]byte, 2)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return &ProxyError{p.address, err}
+	}
+	if reply[1] != 0x00 {
+		return &ProxyError{p.address, errors.New("proxy rejected the user and password")}
+	}
+	return nil
+}
+
+// connectStatuses maps what an HTTP proxy answers a failed CONNECT onto the
+// errors a direct dial would have returned. Proxies don't say whether a bad
+// gateway was refused or unreachable; refused is the usual cause.
+var connectStatuses = map[int]error{
+	http.StatusForbidden:          syscall.EACCES,
+	http.StatusMethodNotAllowed:   syscall.EACCES,
+	http.StatusBadGateway:         syscall.ECONNREFUSED,
+	http.StatusServiceUnavailable: syscall.ECONNREFUSED,
+	http.StatusGatewayTimeout:     syscall.ETIMEDOUT,
+}
+
+// connect opens a CONNECT tunnel to address. The returned connection starts
+// with whatever the proxy sent past the end of its answer, which is the
+// start of a banner for services that speak first.
+func (p *proxyDialer) connect(conn net.Conn, address string) (net.Conn, error) {
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: address},
+		Host:   address,
+		Header: http.Header{"User-Agent": {"portcheck"}},
+	}
+	if p.user != "" {
+		req.Header.Set("Proxy-Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(p.user+":"+p.password)))
+	}
+	if err := req.Write(conn); err != nil {
+		return nil, &ProxyError{p.address, err}
+	}
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		// as with SOCKS, the proxy answers once it has tried the port
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			return nil, err
+		}
+		return nil, &ProxyError{p.address, err}
+	}
+	_ = resp.Body.Close()
+	switch {
+	case resp.StatusCode/100 == 2:
+		return &bufferedConn{conn, br}, nil
+	case resp.StatusCode == http.StatusProxyAuthRequired && p.user == "":
+		return nil, &ProxyError{p.address, errors.New("proxy wants a user and password")}
+	case resp.StatusCode == http.StatusProxyAuthRequired:
+		return nil, &ProxyError{p.address, errors.New("proxy rejected the user and password")}
+	}
+	if errno, ok := connectStatuses[resp.StatusCode]; ok {
+		return nil, fmt.Errorf("CONNECT %s: %s: %w", address, resp.Status, errno)
+	}
+	return nil, &ProxyError{p.address, fmt.Errorf("CONNECT answered %s", resp.Status)}
+}
+
+// bufferedConn is a connection whose first bytes were already read into r.
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
@@ -0,0 +1,99 @@
+package portscan
+
+import (
+	"context"
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+// throttle holds back probe launches; take blocks until the next may start
+// or ctx ends.
+type throttle interface {
+	take(ctx context.Context)
+}
+
+// throttles applies several throttles in turn, for Rate together with Delay.
+type throttles []throttle
+
+func (t throttles) take(ctx context.Context) {
+	for _, th := range t {
+		th.take(ctx)
+	}
+}
+
+// tokenBucket limits how often take returns. It holds up to burst tokens and
+// refills at rate per second; take blocks until a token is available.
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// newTokenBucket allows rate events per second with up to a tenth of a
+// second's worth in a burst, which keeps the rate smooth at any scale.
+func newTokenBucket(rate float64) *tokenBucket {
+	burst := max(1, rate/10)
+	return &tokenBucket{rate: rate, burst: burst, tokens: burst, last: time.Now()}
+}
+
+// take returns early if ctx ends first; the probe that follows then fails
+// straight away on the cancelled context.
+func (b *tokenBucket) take(ctx context.Context) {
+	for {
+		b.mu.Lock()
+		now := time.Now()
+		b.tokens = min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+		b.last = now
+		if b.tokens >= 1 {
+			b.tokens--
+			b.mu.Unlock()
+			return
+		}
+		wait := time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+		b.mu.Unlock()
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// pacer spaces take returns delay apart, give or take up to jitter chosen
+// at random each time, however many callers wait at once.
+type pacer struct {
+	mu     sync.Mutex
+	delay  time.Duration
+	jitter time.Duration
+	next   time.Time
+}
+
+func newPacer(delay, jitter time.Duration) *pacer {
+	return &pacer{delay: delay, jitter: jitter}
+}
+
+// take returns early if ctx ends first, like tokenBucket.take.
+func (p *pacer) take(ctx context.Context) {
+	p.mu.Lock()
+	slot := time.Now()
+	if slot.Before(p.next) {
+		slot = p.next
+	}
+	gap := p.delay
+	if p.jitter > 0 {
+		gap += rand.N(2*p.jitter+1) - p.jitter
+	}
+	p.next = slot.Add(gap)
+	p.mu.Unlock()
+	wait := time.Until(slot)
+	if wait <= 0 {
+		return
+	}
+	select {
+	case <-time.After(wait):
+	case <-ctx.Done():
+	}
+}
@@ -0,0 +1,86 @@
+package portscan
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rdnsWorkers caps how many PTR lookups run at once, so a sweep of a large
+// network doesn't flood the nameserver.
+const rdnsWorkers = 16
+
+// reverseDNS looks up the PTR name of every IP address once, in the
+// background, and remembers it for the other ports of the same host.
+type reverseDNS struct {
+	resolver *net.Resolver
+	timeout  time.Duration
+	slots    chan struct{}
+	mu       sync.Mutex
+	names    map[netip.Addr]*ptrLookup
+}
+
+// ptrLookup is a lookup in flight or done; name is set before done closes
+// and is empty if the address has no PTR record.
+type ptrLookup struct {
+	done chan struct{}
+	name string
+}
+
+// lookupTimeout bounds a PTR lookup; slow reverse zones are common and the
+// name is only decoration.
+const lookupTimeout = 2 * time.Second
+
+func newReverseDNS(resolver *net.Resolver, timeout time.Duration) *reverseDNS {
+	return &reverseDNS{
+		resolver: resolver,
+		timeout:  min(timeout, lookupTimeout),
+		slots:    make(chan struct{}, rdnsWorkers),
+		names:    map[netip.Addr]*ptrLookup{},
+	}
+}
+
+// start begins the lookup for host unless one was already started, and
+// returns it. Host names need no lookup and get nil.
+func (d *reverseDNS) start(host string) *ptrLookup {
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return nil
+	}
+	ip = ip.WithZone("")
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if l := d.names[ip]; l != nil {
+		return l
+	}
+	l := &ptrLookup{done: make(chan struct{})}
+	d.names[ip] = l
+	go func() {
+		defer close(l.done)
+		d.slots <- struct{}{}
+		defer func() { <-d.slots }()
+		// not the probe's context: the name is shared by every port
+		ctx, cancel := context.WithTimeout(context.Background(), d.timeout)
+		defer cancel()
+		if names, err := d.resolver.LookupAddr(ctx, ip.String()); err == nil && len(names) > 0 {
+			l.name = strings.TrimSuffix(names[0], ".")
+		}
+	}()
+	return l
+}
+
+// wait returns the name once the lookup is done, or "" if ctx ends first.
+func (l *ptrLookup) wait(ctx context.Context) string {
+	if l == nil {
+		return ""
+	}
+	select {
+	case <-l.done:
+		return l.name
+	case <-ctx.Done():
+		return ""
+	}
+}
@@ -0,0 +1,78 @@
+package portscan
+
+import (
+	"sync"
+	"time"
+)
+
+// minAdaptiveTimeout is as low as an adaptive timeout goes, so a host whose
+// first answers came back quickly still has room for a slower one.
+const minAdaptiveTimeout = 100 * time.Millisecond
+
+// rttTracker keeps a smoothed round-trip time and its variation for every
+// host that has answered, the way TCP does for its retransmission timer
+// (RFC 6298), and turns them into the time a probe of that host waits.
+type rttTracker struct {
+	ceiling time.Duration
+
+	mu    sync.Mutex
+	hosts map[string]*rttEstimate
+}
+
+type rttEstimate struct {
+	srtt, rttvar time.Duration
+}
+
+func newRTTTracker(ceiling time.Duration) *rttTracker {
+	return &rttTracker{ceiling: ceiling, hosts: map[string]*rttEstimate{}}
+}
+
+// timeout is the smoothed RTT of host plus four times its variation, kept
+// between minAdaptiveTimeout and the ceiling. Hosts that haven't answered
+// yet get the ceiling.
+func (t *rttTracker) timeout(host string) time.Duration {
+	t.mu.Lock()
+	e := t.hosts[host]
+	t.mu.Unlock()
+	if e == nil {
+		return t.ceiling
+	}
+	return min(max(e.srtt+4*e.rttvar, minAdaptiveTimeout), t.ceiling)
+}
+
+// observe folds one measured round trip to host into its estimate.
+func (t *rttTracker) observe(host string, rtt time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	e := t.hosts[host]
+	if e == nil {
+		t.hosts[host] = &rttEstimate{srtt: rtt, rttvar: rtt / 2}
+		return
+	}
+	e.rttvar += (abs(e.srtt-rtt) - e.rttvar) / 4
+	e.srtt += (rtt - e.srtt) / 8
+}
+
+func abs(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
+
+// probeTimeout is how long a probe of host waits for an answer.
+func (s *Scanner) probeTimeout(host string) time.Duration {
+	if s.rtt == nil {
+		return s.opts.Timeout
+	}
+	return s.rtt.timeout(host)
+}
+
+// observeRTT feeds the latency of a definite answer to the RTT estimate of
+// its host. Silence says nothing about the round trip and is left out.
+func (s *Scanner) observeRTT(r Result) {
+	if s.rtt == nil || (r.State != "open" && r.State != "closed") {
+		return
+	}
+	s.rtt.observe(r.Host, time.Duration(r.LatencyMS*float64(time.Millisecond)))
+}
@@ -0,0 +1,148 @@
+package portscan
+
+import (
+	"context"
+	"net"
+)
+
+// scheduler hands the workers addresses so that every host gets its share
+// of them: a host may have at most its share of the workers probing it,
+// Workers split evenly over the hosts with probes running or waiting, or
+// HostParallelism if set. Addresses of a host at its share wait while the
+// workers go on to other hosts', so a host that answers slowly, or not at
+// all, can't take up the whole pool and hold up the rest of the scan. Once
+// the other hosts are done the share grows back to all of Workers.
+type scheduler struct {
+	workers, fixed int
+	// limit bounds how many addresses are read ahead of the workers
+	limit int
+
+	inflight map[string]int
+	waiting  map[string][]string
+	// ring holds the hosts with addresses waiting, taken in turn from next
+	ring    []string
+	next    int
+	queued  int
+	running int
+}
+
+// schedule reorders addresses for the workers as scheduler describes and
+// returns the function to call with the host of each finished probe. Once
+// launch or ctx ends the addresses still waiting are dropped.
+func (s *Scanner) schedule(launch, ctx context.Context, addresses <-chan string) (<-chan string, func(host string)) {
+	sc := &scheduler{
+		workers:  s.opts.Workers,
+		fixed:    s.opts.HostParallelism,
+		limit:    max(4*s.opts.Workers, 64),
+		inflight: map[string]int{},
+		waiting:  map[string][]string{},
+	}
+	out := make(chan string)
+	done := make(chan string, s.opts.Workers)
+	quit := make(chan struct{})
+	go func() {
+		defer close(quit)
+		defer close(out)
+		in := addresses
+		for in != nil || sc.queued > 0 {
+			address, host := sc.pick()
+			var send chan<- string
+			if address != "" {
+				send = out
+			}
+			var recv <-chan string
+			if sc.queued < sc.limit {
+				recv = in
+			}
+			select {
+			case send <- address:
+				sc.dispatched(host)
+			case a, ok := <-recv:
+				if !ok {
+					in = nil
+					continue
+				}
+				sc.add(a)
+			case h := <-done:
+				sc.finished(h)
+			case <-launch.Done():
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	finished := func(host string) {
+		select {
+		case done <- host:
+		case <-quit:
+		}
+	}
+	return out, finished
+}
+
+// share is how many probes of one host may run at once.
+func (sc *scheduler) share() int {
+	if sc.fixed > 0 {
+		return sc.fixed
+	}
+	active := len(sc.inflight)
+	for host := range sc.waiting {
+		if sc.inflight[host] == 0 {
+			active++
+		}
+	}
+	return max((sc.workers+active-1)/max(active, 1), 1)
+}
+
+func (sc *scheduler) add(address string) {
+	// as newResult splits it, for finished to match
+	host, _, _ := net.SplitHostPort(address)
+	if len(sc.waiting[host]) == 0 {
+		sc.ring = append(sc.ring, host)
+	}
+	sc.waiting[host] = append(sc.waiting[host], address)
+	sc.queued++
+}
+
+// pick finds the next address whose host is below its share, taking the
+// hosts in turn, or "" if there's none.
+func (sc *scheduler) pick() (address, host string) {
+	// with every worker busy nothing could be handed out anyway
+	if len(sc.ring) == 0 || (sc.fixed == 0 && sc.running >= sc.workers) {
+		return "", ""
+	}
+	share := sc.share()
+	for range len(sc.ring) {
+		if sc.next >= len(sc.ring) {
+			sc.next = 0
+		}
+		host := sc.ring[sc.next]
+		if sc.inflight[host] < share {
+			return sc.waiting[host][0], host
+		}
+		sc.next++
+	}
+	return "", ""
+}
+
+func (sc *scheduler) dispatched(host string) {
+	sc.inflight[host]++
+	sc.running++
+	sc.queued--
+	if rest := sc.waiting[host][1:]; len(rest) > 0 {
+		sc.waiting[host] = rest
+		// the next host gets the next turn
+		sc.next++
+	} else {
+		delete(sc.waiting, host)
+		sc.ring = append(sc.ring[:sc.next], sc.ring[sc.next+1:]...)
+	}
+}
+
+func (sc *scheduler) finished(host string) {
+	sc.running--
+	if sc.inflight[host]--; sc.inflight[host] <= 0 {
+		delete(sc.inflight, host)
+	}
+}
@@ -0,0 +1,211 @@
+//go:build linux
+
+package portscan
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"math/rand/v2"
+	"net"
+	"net/netip"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	sctpChunkInit    = 1
+	sctpChunkInitAck = 2
+	sctpChunkAbort   = 6
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+type sctpKey struct {
+	ip   [4]byte
+	port uint16
+}
+
+// sctpScanner sends SCTP INIT chunks over a raw socket and matches the
+// replies read back from it: an INIT-ACK means something listens on the
+// port, an ABORT that nothing does. Like a SYN scan the association is
+// never completed; every INIT-ACK is answered with an ABORT so the peer
+// drops the state it set up.
+type sctpScanner struct {
+	fd int
+	// replies are matched by the source ports probes are sent from: one
+	// random port, or the pinned range
+	srcLo, srcHi uint16
+	source       net.IP
+	device       control
+	resolver     *net.Resolver
+	mu           sync.Mutex
+	pending      map[sctpKey]chan string
+}
+
+// newSCTPScanner opens the raw socket, sending from source and the source
+// ports and interface of opts, if set.
+func newSCTPScanner(opts Options, source netip.Addr) (*sctpScanner, error) {
+	fd, err := syscall.Socket(syscall.AF_INET, syscall.SOCK_RAW, syscall.IPPROTO_SCTP)
+	if err != nil {
+		return nil, fmt.Errorf("opening raw SCTP socket (needs root or CAP_NET_RAW): %w", err)
+	}
+	s := &sctpScanner{
+		fd:       fd,
+		srcLo:    uint16(opts.SourcePort),
+		srcHi:    uint16(opts.SourcePortEnd),
+		resolver: opts.Resolver,
+		pending:  map[sctpKey]chan string{},
+	}
+	if opts.SourcePort == 0 {
+		s.srcLo = uint16(32768 + rand.IntN(28000))
+		s.srcHi = s.srcLo
+	}
+	if source.IsValid() {
+		s.source = source.AsSlice()
+		if err := syscall.Bind(fd, &syscall.SockaddrInet4{Addr: source.As4()}); err != nil {
+			_ = syscall.Close(fd)
+			return nil, fmt.Errorf("binding raw socket to %s: %w", source, err)
+		}
+	}
+	if iface := opts.Interface; iface != "" {
+		if err := syscall.BindToDevice(fd, iface); err != nil {
+			_ = syscall.Close(fd)
+			return nil, fmt.Errorf("binding raw socket to interface %s: %w", iface, err)
+		}
+		if s.device, err = bindToDevice(iface); err != nil {
+			_ = syscall.Close(fd)
+			return nil, err
+		}
+	}
+	go s.receive()
+	return s, nil
+}
+
+func (s *sctpScanner) close() error {
+	return syscall.Close(s.fd)
+}
+
+func (s *sctpScanner) receive() {
+	buf := make([]byte, 65535)
+	for {
+		n, _, err := syscall.Recvfrom(s.fd, buf, 0)
+		if err != nil {
+			if err == syscall.EINTR {
+				continue
+			}
+			return
+		}
+		pkt := buf[:n]
+		if len(pkt) < 20 {
+			continue
+		}
+		ihl := int(pkt[0]&0x0f) * 4
+		// the common header and the first chunk's header
+		if len(pkt) < ihl+16 {
+			continue
+		}
+		sctp := pkt[ihl:]
+		srcPort := binary.BigEndian.Uint16(sctp[2:4])
+		if srcPort < s.srcLo || srcPort > s.srcHi {
+			continue
+		}
+		key := sctpKey{port: binary.BigEndian.Uint16(sctp[0:2])}
+		copy(key.ip[:], pkt[12:16])
+		state := ""
+		switch sctp[12] {
+		case sctpChunkInitAck:
+			if len(sctp) < 12+8 {
+				continue
+			}
+			state = "open"
+			// tear down what the peer set up, tagged with the tag it chose
+			abort := sctpPacket(srcPort, key.port, binary.BigEndian.Uint32(sctp[16:20]), []byte{sctpChunkAbort, 0, 0, 4})
+			_ = syscall.Sendto(s.fd, abort, 0, &syscall.SockaddrInet4{Addr: key.ip})
+		case sctpChunkAbort:
+			state = "closed"
+		default:
+			continue
+		}
+		s.mu.Lock()
+		ch, ok := s.pending[key]
+		delete(s.pending, key)
+		s.mu.Unlock()
+		if ok {
+			ch <- state
+		}
+	}
+}
+
+// probe sends an INIT to address from srcPort, or from the scanner's own
+// random port if srcPort is 0.
+func (s *sctpScanner) probe(ctx context.Context, address string, timeout time.Duration, srcPort uint16) Result {
+	r := newResult(address, "sctp")
+	dst, _, err := routeIPv4(s.resolver, s.source, s.device, r.Host, r.Port, "SCTP scan")
+	if err != nil {
+		r.setError(err)
+		return r
+	}
+	key := sctpKey{ip: [4]byte(dst), port: uint16(r.Port)}
+	ch := make(chan string, 1)
+	s.mu.Lock()
+	s.pending[key] = ch
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.pending, key)
+		s.mu.Unlock()
+	}()
+
+	if srcPort == 0 {
+		srcPort = s.srcLo
+	}
+	pkt := sctpPacket(srcPort, uint16(r.Port), 0, sctpInit())
+	start := time.Now()
+	if err := syscall.Sendto(s.fd, pkt, 0, &syscall.SockaddrInet4{Addr: [4]byte(dst)}); err != nil {
+		r.LatencyMS = milliseconds(time.Since(start))
+		r.setError(err)
+		return r
+	}
+	select {
+	case state := <-ch:
+		r.State = state
+		if state == "closed" {
+			r.Reason = "abort"
+		}
+	case <-time.After(timeout):
+		r.State, r.Reason = "filtered", "timeout"
+	case <-ctx.Done():
+		r.setError(ctx.Err())
+	}
+	r.LatencyMS = milliseconds(time.Since(start))
+	return r
+}
+
+// sctpInit is an INIT chunk asking for the stream counts Linux asks for,
+// with a random initiate tag and initial TSN.
+func sctpInit() []byte {
+	chunk := make([]byte, 20)
+	chunk[0] = sctpChunkInit
+	binary.BigEndian.PutUint16(chunk[2:4], uint16(len(chunk)))
+	binary.BigEndian.PutUint32(chunk[4:8], rand.Uint32()|1) // initiate tag, never 0
+	binary.BigEndian.PutUint32(chunk[8:12], 65535)          // receiver window
+	binary.BigEndian.PutUint16(chunk[12:14], 10)            // outbound streams
+	binary.BigEndian.PutUint16(chunk[14:16], 65535)         // inbound streams
+	binary.BigEndian.PutUint32(chunk[16:20], rand.Uint32()) // initial TSN
+	return chunk
+}
+
+// sctpPacket puts chunk behind an SCTP common header, with its CRC32c
+// checksum, which unlike the IP one is stored little-endian.
+func sctpPacket(srcPort, dstPort uint16, tag uint32, chunk []byte) []byte {
+	pkt := make([]byte, 12, 12+len(chunk))
+	binary.BigEndian.PutUint16(pkt[0:2], srcPort)
+	binary.BigEndian.PutUint16(pkt[2:4], dstPort)
+	binary.BigEndian.PutUint32(pkt[4:8], tag)
+	pkt = append(pkt, chunk...)
+	binary.LittleEndian.PutUint32(pkt[8:12], crc32.Checksum(pkt, castagnoli))
+	return pkt
+}
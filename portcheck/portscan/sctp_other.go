@@ -0,0 +1,24 @@
+//go:build !linux
+
+package portscan
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"time"
+)
+
+type sctpScanner struct{}
+
+func newSCTPScanner(Options, netip.Addr) (*sctpScanner, error) {
+	return nil, errors.New("SCTP scan is only supported on Linux")
+}
+
+func (s *sctpScanner) probe(context.Context, string, time.Duration, uint16) Result {
+	return Result{}
+}
+
+func (s *sctpScanner) close() error {
+	return nil
+}
@@ -0,0 +1,460 @@
+package portscan
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// probeIntensity is the highest rarity of the probes tried on ports they
+// don't list, nmap's default --version-intensity.
+const probeIntensity = 7
+
+// ServiceProbes is a parsed nmap-service-probes database, for
+// Options.ServiceProbes. Only its TCP probes are used.
+type ServiceProbes struct {
+	probes []*nmapProbe
+	byName map[string]*nmapProbe
+	// exclude are the TCP port ranges never probed, like printer ports
+	// that print whatever they are sent
+	exclude [][2]int
+	// Matches is how many match and softmatch lines were loaded; Skipped
+	// is how many were left out because their pattern uses Perl regular
+	// expression features Go doesn't have, like lookaheads and
+	// backreferences.
+	Matches, Skipped int
+}
+
+type nmapProbe struct {
+	name     string
+	payload  []byte
+	rarity   int
+	ports    [][2]int
+	fallback []string
+	matches  []nmapMatch
+}
+
+type nmapMatch struct {
+	service string
+	soft    bool
+	re      *regexp.Regexp
+	// product, version and info are the p//, v// and i// templates, with
+	// $1-style references to the pattern's groups
+	product, version, info string
+}
+
+// LoadServiceProbes reads an nmap-service-probes file.
+func LoadServiceProbes(path string) (*ServiceProbes, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+	db := &ServiceProbes{byName: map[string]*nmapProbe{}}
+	// probe is the TCP probe the lines belong to, nil under a UDP one
+	var probe *nmapProbe
+	seenProbe := false
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		directive, rest, _ := strings.Cut(line, " ")
+		if directive != "Probe" && directive != "Exclude" && !seenProbe {
+			return nil, fmt.Errorf("%s:%d: %s before the first Probe", path, n, directive)
+		}
+		switch directive {
+		case "Exclude":
+			db.exclude = append(db.exclude, parseProbePorts(rest, true)...)
+		case "Probe":
+			p, err := parseProbe(rest)
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: %w", path, n, err)
+			}
+			probe, seenProbe = p, true
+			if p == nil {
+				continue // a UDP probe; its directives are skipped
+			}
+			db.probes = append(db.probes, p)
+			db.byName[p.name] = p
+		case "match", "softmatch":
+			if probe == nil {
+				continue
+			}
+			m, err := parseMatch(rest, directive == "softmatch")
+			if err != nil {
+				if errors.Is(err, errUnsupportedPattern) {
+					db.Skipped++
+					continue
+				}
+				return nil, fmt.Errorf("%s:%d: %w", path, n, err)
+			}
+			probe.matches = append(probe.matches, m)
+			db.Matches++
+		case "ports":
+			if probe != nil {
+				probe.ports = parseProbePorts(rest, false)
+			}
+		case "rarity":
+			if probe != nil {
+				if probe.rarity, err = strconv.Atoi(rest); err != nil {
+					return nil, fmt.Errorf("%s:%d: bad rarity %q", path, n, rest)
+				}
+			}
+		case "fallback":
+			if probe != nil {
+				probe.fallback = strings.Split(rest, ",")
+			}
+		}
+		// sslports, totalwaitms, tcpwrappedms: TLS tunnelling and nmap's
+		// own timing aren't used
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if len(db.probes) == 0 {
+		return nil, fmt.Errorf("%s: no TCP probes", path)
+	}
+	return db, nil
+}
+
+// parseProbe reads "TCP name q|payload|", returning nil for UDP probes.
+func parseProbe(s string) (*nmapProbe, error) {
+	fields := strings.SplitN(s, " ", 3)
+	if len(fields) < 3 || len(fields[2]) < 3 || fields[2][0] != 'q' {
+		return nil, fmt.Errorf("bad Probe %q", s)
+	}
+	if fields[0] != "TCP" {
+		return nil, nil
+	}
+	delim := fields[2][1]
+	end := strings.IndexByte(fields[2][2:], delim)
+	if end < 0 {
+		return nil, fmt.Errorf("unterminated probe string in %q", s)
+	}
+	payload, err := unescapeProbe(fields[2][2 : 2+end])
+	if err != nil {
+		return nil, err
+	}
+	return &nmapProbe{name: fields[1], payload: payload, rarity: 1}, nil
+}
+
+// unescapeProbe decodes the C-style escapes of a probe string.
+func unescapeProbe(s string) ([]byte, error) {
+	b := []byte{}
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			b = append(b, s[i])
+			continue
+		}
+		i++
+		switch c := s[i]; c {
+		case 'r':
+			b = append(b, '\r')
+		case 'n':
+			b = append(b, '\n')
+		case 't':
+			b = append(b, '\t')
+		case '0':
+			b = append(b, 0)
+		case 'a':
+			b = append(b, 7)
+		case 'f':
+			b = append(b, '\f')
+		case 'v':
+			b = append(b, '\v')
+		case 'x':
+			if i+3 > len(s) {
+				return nil, fmt.Errorf("short \\x escape in %q", s)
+			}
+			v, err := strconv.ParseUint(s[i+1:i+3], 16, 8)
+			if err != nil {
+				return nil, fmt.Errorf("bad \\x escape in %q", s)
+			}
+			b = append(b, byte(v))
+			i += 2
+		default:
+			b = append(b, c)
+		}
+	}
+	return b, nil
+}
+
+// parseProbePorts reads a ports or Exclude list such as "21-25,80,T:9100",
+// keeping the TCP ones. Exclude lists may mark ranges T: or U:.
+func parseProbePorts(s string, marked bool) [][2]int {
+	ranges := [][2]int{}
+	udp := false
+	for entry := range strings.SplitSeq(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if marked {
+			switch {
+			case strings.HasPrefix(entry, "T:"):
+				udp, entry = false, entry[2:]
+			case strings.HasPrefix(entry, "U:"):
+				udp, entry = true, entry[2:]
+			}
+		}
+		if udp {
+			continue
+		}
+		loStr, hiStr, isRange := strings.Cut(entry, "-")
+		lo, err := strconv.Atoi(loStr)
+		if err != nil {
+			continue
+		}
+		hi := lo
+		if isRange {
+			if hi, err = strconv.Atoi(hiStr); err != nil {
+				continue
+			}
+		}
+		ranges = append(ranges, [2]int{lo, hi})
+	}
+	return ranges
+}
+
+func inRanges(ranges [][2]int, port int) bool {
+	return slices.ContainsFunc(ranges, func(r [2]int) bool { return r[0] <= port && port <= r[1] })
+}
+
+var errUnsupportedPattern = errors.New("pattern not supported by Go's regexp")
+
+// parseMatch reads "service m|pattern|flags p/product/ v/version/ ...".
+func parseMatch(s string, soft bool) (nmapMatch, error) {
+	service, rest, ok := strings.Cut(s, " ")
+	if !ok || len(rest) < 3 || rest[0] != 'm' {
+		return nmapMatch{}, fmt.Errorf("bad match %q", s)
+	}
+	m := nmapMatch{service: service, soft: soft}
+	pattern, flags, rest, ok := cutDelimited(rest[1:])
+	if !ok {
+		return nmapMatch{}, fmt.Errorf("unterminated pattern in %q", s)
+	}
+	prefix := ""
+	if strings.Contains(flags, "i") {
+		prefix += "i"
+	}
+	if strings.Contains(flags, "s") {
+		prefix += "s"
+	}
+	if prefix != "" {
+		prefix = "(?" + prefix + ")"
+	}
+	// \Z is Perl's end of text before an optional final newline
+	re, err := regexp.Compile(prefix + strings.ReplaceAll(pattern, `\Z`, `\n?\z`))
+	if err != nil {
+		return nmapMatch{}, errUnsupportedPattern
+	}
+	m.re = re
+	for rest = strings.TrimSpace(rest); rest != ""; rest = strings.TrimSpace(rest) {
+		// a field name, p v i h o d or cpe:, then its delimited value
+		nameEnd := strings.IndexFunc(rest, func(r rune) bool { return !('a' <= r && r <= 'z' || r == ':') })
+		if nameEnd <= 0 {
+			break
+		}
+		name := rest[:nameEnd]
+		var value string
+		if value, _, rest, ok = cutDelimited(rest[nameEnd:]); !ok {
+			break
+		}
+		switch name {
+		case "p":
+			m.product = value
+		case "v":
+			m.version = value
+		case "i":
+			m.info = value
+		}
+	}
+	return m, nil
+}
+
+// cutDelimited splits "|value|flags rest" at the delimiters that open it.
+func cutDelimited(s string) (value, flags, rest string, ok bool) {
+	if s == "" {
+		return "", "", "", false
+	}
+	delim := s[0]
+	end := strings.IndexByte(s[1:], delim)
+	if end < 0 {
+		return "", "", "", false
+	}
+	value, rest = s[1:1+end], s[2+end:]
+	flags, rest, _ = strings.Cut(rest, " ")
+	return value, flags, rest, true
+}
+
+// excluded reports whether port is one the database says never to probe.
+func (db *ServiceProbes) excluded(port int) bool {
+	return inRanges(db.exclude, port)
+}
+
+// match looks for the service in a response to probe: its own match lines
+// first, then those of its fallbacks and of the NULL probe, as nmap does.
+func (db *ServiceProbes) match(probe *nmapProbe, response []byte) (m *nmapMatch, groups []string) {
+	text := latin1(response)
+	probes := []*nmapProbe{probe}
+	for _, name := range probe.fallback {
+		if p := db.byName[name]; p != nil {
+			probes = append(probes, p)
+		}
+	}
+	if null := db.byName["NULL"]; null != nil && null != probe {
+		probes = append(probes, null)
+	}
+	var soft *nmapMatch
+	var softGroups []string
+	for _, p := range probes {
+		for i := range p.matches {
+			candidate := &p.matches[i]
+			g := candidate.re.FindStringSubmatch(text)
+			if g == nil {
+				continue
+			}
+			if !candidate.soft {
+				return candidate, g
+			}
+			if soft == nil {
+				soft, softGroups = candidate, g
+			}
+		}
+	}
+	return soft, softGroups
+}
+
+// latin1 maps every byte to the rune of the same value, so the \xHH escapes
+// of nmap's byte-oriented patterns match binary responses.
+func latin1(b []byte) string {
+	runes := make([]rune, len(b))
+	for i, c := range b {
+		runes[i] = rune(c)
+	}
+	return string(runes)
+}
+
+var templateRef = regexp.MustCompile(`\$(?:(\d)|P\((\d)\)|SUBST\((\d),"([^"]*)","([^"]*)"\)|I\((\d),"[<>]"\))`)
+
+// versionString fills in the product, version and info templates of m with
+// the groups its pattern matched: "OpenSSH 9.6p1 (Ubuntu Linux; protocol 2.0)".
+func (m *nmapMatch) versionString(groups []string) string {
+	fill := func(tmpl string) string {
+		return templateRef.ReplaceAllStringFunc(tmpl, func(ref string) string {
+			sub := templateRef.FindStringSubmatch(ref)
+			group := func(n string) string {
+				i, _ := strconv.Atoi(n)
+				if i < len(groups) {
+					return groups[i]
+				}
+				return ""
+			}
+			switch {
+			case sub[1] != "":
+				return group(sub[1])
+			case sub[2] != "":
+				return cleanBanner([]byte(group(sub[2])))
+			case sub[3] != "":
+				return strings.ReplaceAll(group(sub[3]), sub[4], sub[5])
+			}
+			return "" // $I, a binary integer, isn't worth decoding
+		})
+	}
+	version := strings.TrimSpace(fill(m.product) + " " + fill(m.version))
+	if info := fill(m.info); info != "" {
+		version = strings.TrimSpace(version + " (" + info + ")")
+	}
+	return version
+}
+
+// fingerprintProbes is fingerprint with an nmap-service-probes database:
+// the banner is matched against the NULL probe, then the probes that list
+// the port and those rare enough are sent on new connections, until one
+// hard match. A softmatch names the service without a version if nothing
+// better turns up.
+func (s *Scanner) fingerprintProbes(ctx context.Context, address string, port int, banner []byte) (service, version string) {
+	db := s.opts.ServiceProbes
+	if db.excluded(port) {
+		return "", ""
+	}
+	if banner == nil {
+		conn, err := s.dial(ctx, "tcp", address)
+		if err != nil {
+			return "", ""
+		}
+		banner = s.readBanner(conn)
+		_ = conn.Close()
+	}
+	softService := ""
+	if null := db.byName["NULL"]; null != nil && len(banner) > 0 {
+		if m, groups := db.match(null, banner); m != nil {
+			if !m.soft {
+				return m.service, m.versionString(groups)
+			}
+			softService = m.service
+		}
+	}
+	probes := []*nmapProbe{}
+	for _, p := range db.probes {
+		if p.name != "NULL" && (inRanges(p.ports, port) || p.rarity <= probeIntensity) {
+			probes = append(probes, p)
+		}
+	}
+	slices.SortStableFunc(probes, func(a, b *nmapProbe) int {
+		return boolRank(inRanges(b.ports, port)) - boolRank(inRanges(a.ports, port))
+	})
+	for _, p := range probes {
+		if ctx.Err() != nil {
+			break
+		}
+		conn, err := s.dial(ctx, "tcp", address)
+		if err != nil {
+			break
+		}
+		response := s.exchange(conn, p.payload)
+		_ = conn.Close()
+		if len(response) == 0 {
+			continue
+		}
+		if m, groups := db.match(p, response); m != nil {
+			if !m.soft {
+				return m.service, m.versionString(groups)
+			}
+			if softService == "" {
+				softService = m.service
+			}
+		}
+	}
+	return softService, ""
+}
+
+// exchange sends payload and reads the response: whatever arrives within
+// the banner wait, and once something has, until the line goes quiet for a
+// moment.
+func (s *Scanner) exchange(conn net.Conn, payload []byte) []byte {
+	wait := min(bannerWait, s.opts.Timeout)
+	_ = conn.SetDeadline(time.Now().Add(wait))
+	if _, err := conn.Write(payload); err != nil {
+		return nil
+	}
+	buf := make([]byte, 0, 4096)
+	chunk := make([]byte, 4096)
+	for len(buf) < 64*1024 {
+		n, err := conn.Read(chunk)
+		buf = append(buf, chunk[:n]...)
+		if err != nil {
+			break
+		}
+		_ = conn.SetReadDeadline(time.Now().Add(min(100*time.Millisecond, wait)))
+	}
+	return buf
+}
@@ -0,0 +1,126 @@
+package portscan
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// wellKnownServices is used when /etc/services is missing (scratch
+// containers, Windows) and fills in ports it doesn't list.
+var wellKnownServices = map[string]map[int]string{
+	"tcp": {
+		20: "ftp-data", 21: "ftp", 22: "ssh", 23: "telnet", 25: "smtp",
+		53: "domain", 80: "http", 88: "kerberos", 110: "pop3", 111: "sunrpc",
+		119: "nntp", 135: "msrpc", 139: "netbios-ssn", 143: "imap", 179: "bgp",
+		389: "ldap", 443: "https", 445: "microsoft-ds", 465: "submissions",
+		514: "shell", 515: "printer", 587: "submission", 631: "ipp",
+		636: "ldaps", 873: "rsync", 993: "imaps", 995: "pop3s",
+		1080: "socks", 1433: "ms-sql-s", 1521: "oracle", 1723: "pptp",
+		1883: "mqtt", 2049: "nfs", 2181: "zookeeper", 2375: "docker",
+		2376: "docker-s", 2379: "etcd-client", 2380: "etcd-server",
+		3000: "ppp", 3306: "mysql", 3389: "ms-wbt-server", 3690: "svn",
+		4222: "nats", 5000: "upnp", 5432: "postgresql", 5601: "kibana",
+		5672: "amqp", 5900: "vnc", 5984: "couchdb", 6379: "redis",
+		6443: "sun-sr-https", 6667: "irc", 8000: "http-alt", 8080: "http-proxy",
+		8443: "https-alt", 8888: "sun-answerbook", 9000: "cslistener",
+		9042: "cassandra", 9090: "zeus-admin", 9092: "kafka", 9100: "jetdirect",
+		9200: "elasticsearch", 9418: "git", 10250: "kubelet", 11211: "memcache",
+		15672: "rabbitmq-mgmt", 27017: "mongodb",
+	},
+	"udp": {
+		53: "domain", 67: "bootps", 68: "bootpc", 69: "tftp", 123: "ntp",
+		137: "netbios-ns", 138: "netbios-dgm", 161: "snmp", 162: "snmptrap",
+		500: "isakmp", 514: "syslog", 520: "route", 1194: "openvpn",
+		1900: "ssdp", 4500: "ipsec-nat-t", 5353: "mdns", 11211: "memcache",
+		51820: "wireguard",
+	},
+	"sctp": {
+		22: "ssh", 80: "http", 179: "bgp", 443: "https", 2904: "m2ua",
+		2905: "m3ua", 2944: "megaco-h248", 2945: "h248-binary", 3565: "m2pa",
+		3868: "diameter", 5060: "sip", 5061: "sip-tls", 5672: "amqp",
+		9900: "iua", 14001: "sua", 29118: "sgsap", 29168: "sbcap",
+		36412: "s1ap", 36422: "x2ap", 38412: "ngap", 38472: "f1ap",
+	},
+}
+
+// serviceAliases are the names people type for services whose registered
+// name is something else, for ServicePort.
+var serviceAliases = map[string]int{
+	"dns": 53, "smb": 445, "mssql": 1433, "oracle": 1521, "mysql": 3306,
+	"rdp": 3389, "postgres": 5432, "vnc": 5900, "winrm": 5985, "winrm-https": 5986,
+	"kube-apiserver": 6443, "elastic": 9200, "memcached": 11211,
+	"rabbitmq": 5672, "mongo": 27017,
+}
+
+var (
+	servicesOnce sync.Once
+	services     map[string]map[int]string
+	// servicePorts maps names and aliases back to ports, by proto
+	servicePorts map[string]map[string]int
+)
+
+// ServiceName returns the registered name for port/proto, from /etc/services
+// or a built-in table of common ports, or "".
+func ServiceName(proto string, port int) string {
+	servicesOnce.Do(loadServices)
+	return services[proto][port]
+}
+
+// ServicePort returns the port of the service named name over proto, from
+// /etc/services, the built-in table or common aliases such as postgres and
+// rdp, ignoring case.
+func ServicePort(proto, name string) (int, bool) {
+	servicesOnce.Do(loadServices)
+	name = strings.ToLower(name)
+	if port, ok := servicePorts[proto][name]; ok {
+		return port, true
+	}
+	port, ok := serviceAliases[name]
+	return port, ok
+}
+
+func loadServices() {
+	services = map[string]map[int]string{"tcp": {}, "udp": {}, "sctp": {}}
+	servicePorts = map[string]map[string]int{"tcp": {}, "udp": {}, "sctp": {}}
+	name := func(proto, name string, port int) {
+		name = strings.ToLower(name)
+		if _, ok := servicePorts[proto][name]; !ok {
+			servicePorts[proto][name] = port
+		}
+	}
+	for proto, table := range wellKnownServices {
+		for port, n := range table {
+			services[proto][port] = n
+			name(proto, n, port)
+		}
+	}
+	f, err := os.Open("/etc/services")
+	if err != nil {
+		return
+	}
+	defer func() { _ = f.Close() }()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		portStr, proto, ok := strings.Cut(fields[1], "/")
+		if !ok || services[proto] == nil {
+			continue
+		}
+		port, err := strconv.Atoi(portStr)
+		if err != nil {
+			continue
+		}
+		services[proto][port] = fields[0]
+		name(proto, fields[0], port)
+		for _, alias := range fields[2:] {
+			name(proto, alias, port)
+		}
+	}
+}
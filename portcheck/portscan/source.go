@@ -0,0 +1,102 @@
+package portscan
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"strconv"
+	"syscall"
+)
+
+// checkSourceIP makes sure ip is one of this host's addresses, so a typo
+// fails before the scan instead of as an error on every probe. A link-local
+// IPv6 address needs its zone, and must be an address of that interface.
+func checkSourceIP(ip netip.Addr) error {
+	addrs, err := net.InterfaceAddrs()
+	if zone := ip.Zone(); zone != "" {
+		index := zoneIndex(zone)
+		if index == 0 {
+			return fmt.Errorf("source IP %s: no interface %q on this host", ip, zone)
+		}
+		var ifi *net.Interface
+		if ifi, err = net.InterfaceByIndex(int(index)); err == nil {
+			addrs, err = ifi.Addrs()
+		}
+	} else if ip.Is6() && ip.IsLinkLocalUnicast() {
+		return fmt.Errorf("link-local source IP %s needs a zone naming its interface, e.g. %s%%eth0", ip, ip)
+	}
+	if err != nil {
+		return err
+	}
+	for _, a := range addrs {
+		if n, ok := a.(*net.IPNet); ok {
+			if local, ok := netip.AddrFromSlice(n.IP); ok && local.Unmap() == ip.WithZone("") {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("source IP %s is not an address of this host", ip)
+}
+
+// zoneIndex returns the index of the interface an IPv6 zone names, by name
+// or by number, or 0 if there is no such interface.
+func zoneIndex(zone string) uint32 {
+	if ifi, err := net.InterfaceByName(zone); err == nil {
+		return uint32(ifi.Index)
+	}
+	if n, err := strconv.Atoi(zone); err == nil {
+		if ifi, err := net.InterfaceByIndex(n); err == nil {
+			return uint32(ifi.Index)
+		}
+	}
+	return 0
+}
+
+// netDialer is the dialer every probe connection starts from: bounded by
+// Timeout, and sent from the source address, port and interface, if any.
+func (s *Scanner) netDialer(proto string) *net.Dialer {
+	d := &net.Dialer{Timeout: s.opts.Timeout, Control: s.control, Resolver: s.opts.Resolver}
+	var ip net.IP
+	if s.source.IsValid() {
+		ip = s.source.AsSlice()
+	}
+	port := s.sourcePort()
+	if ip == nil && port == 0 {
+		return d
+	}
+	if proto == "udp" {
+		d.LocalAddr = &net.UDPAddr{IP: ip, Port: port, Zone: s.source.Zone()}
+	} else {
+		d.LocalAddr = &net.TCPAddr{IP: ip, Port: port, Zone: s.source.Zone()}
+	}
+	return d
+}
+
+// sourcePort hands out the ports of SourcePort-SourcePortEnd in turn, or 0
+// to let the kernel pick.
+func (s *Scanner) sourcePort() int {
+	lo, hi := s.opts.SourcePort, s.opts.SourcePortEnd
+	if lo == 0 {
+		return 0
+	}
+	n := s.nextPort.Add(1) - 1
+	return lo + int(n%uint64(hi-lo+1))
+}
+
+// chain runs the dialer hooks in order, skipping nil ones.
+func chain(hooks ...control) control {
+	return func(network, address string, c syscall.RawConn) error {
+		for _, h := range hooks {
+			if h == nil {
+				continue
+			}
+			if err := h(network, address, c); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// control is the type of net.Dialer.Control.
+type control = func(network, address string, c syscall.RawConn) error
@@ -0,0 +1,64 @@
+//go:build linux
+
+package portscan
+
+import (
+	"fmt"
+	"net"
+	"syscall"
+)
+
+// bindToDevice returns a dialer hook that pins sockets to the named
+// interface with SO_BINDTODEVICE, which needs root or CAP_NET_RAW.
+func bindToDevice(name string) (control, error) {
+	if _, err := net.InterfaceByName(name); err != nil {
+		return nil, fmt.Errorf("interface %s: %w", name, err)
+	}
+	// try once up front, so missing privileges fail the scan and not
+	// every probe
+	fd, err := syscall.Socket(syscall.AF_INET, syscall.SOCK_DGRAM, 0)
+	if err != nil {
+		return nil, err
+	}
+	err = syscall.BindToDevice(fd, name)
+	_ = syscall.Close(fd)
+	if err != nil {
+		return nil, fmt.Errorf("binding to interface %s (needs root or CAP_NET_RAW): %w", name, err)
+	}
+	return func(_, _ string, c syscall.RawConn) error {
+		var err error
+		if errC := c.Control(func(fd uintptr) {
+			err = syscall.BindToDevice(int(fd), name)
+		}); errC != nil {
+			return errC
+		}
+		if err != nil {
+			// not %w: a refused bind says nothing about the port
+			return fmt.Errorf("binding to interface %s: %v", name, err)
+		}
+		return nil
+	}, nil
+}
+
+// pinPort lets many probe sockets share a source port. Closing with a
+// reset rather than a FIN leaves no TIME_WAIT behind, which would block the
+// next connection from the same port to the same host and port.
+func pinPort(_, _ string, c syscall.RawConn) error {
+	var err error
+	if errC := c.Control(func(fd uintptr) {
+		if err = syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_REUSEADDR, 1); err != nil {
+			return
+		}
+		err = syscall.SetsockoptLinger(int(fd), syscall.SOL_SOCKET, syscall.SO_LINGER, &syscall.Linger{Onoff: 1, Linger: 0})
+	}); errC != nil {
+		return errC
+	}
+	if err != nil {
+		return fmt.Errorf("sharing the source port: %v", err)
+	}
+	return nil
+}
+
+func canPinPort() error {
+	return nil
+}
@@ -0,0 +1,20 @@
+//go:build !linux
+
+package portscan
+
+import (
+	"errors"
+	"syscall"
+)
+
+func bindToDevice(string) (control, error) {
+	return nil, errors.New("binding to an interface is only supported on Linux; use a source IP instead")
+}
+
+func pinPort(string, string, syscall.RawConn) error {
+	return nil
+}
+
+func canPinPort() error {
+	return errors.New("pinning the source port is only supported on Linux")
+}
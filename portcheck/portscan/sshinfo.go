@@ -0,0 +1,179 @@
+package portscan
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// weakSSH are the algorithms OpenSSH has disabled or deprecated: SHA-1 key
+// exchanges and signatures, DSA keys, CBC and RC4 ciphers, and MD5 and
+// truncated MACs.
+var weakSSH = map[string]bool{
+	"diffie-hellman-group1-sha1":         true,
+	"diffie-hellman-group14-sha1":        true,
+	"diffie-hellman-group-exchange-sha1": true,
+	"ssh-dss":                            true,
+	"ssh-rsa":                            true,
+	"ssh-dss-cert-v01@openssh.com":       true,
+	"ssh-rsa-cert-v01@openssh.com":       true,
+	"3des-cbc":                           true,
+	"aes128-cbc":                         true,
+	"aes192-cbc":                         true,
+	"aes256-cbc":                         true,
+	"blowfish-cbc":                       true,
+	"cast128-cbc":                        true,
+	"rijndael-cbc@lysator.liu.se":        true,
+	"arcfour":                            true,
+	"arcfour128":                         true,
+	"arcfour256":                         true,
+	"none":                               true,
+	"hmac-md5":                           true,
+	"hmac-md5-96":                        true,
+	"hmac-sha1-96":                       true,
+	"hmac-md5-etm@openssh.com":           true,
+	"hmac-md5-96-etm@openssh.com":        true,
+	"hmac-sha1-96-etm@openssh.com":       true,
+	"umac-64@openssh.com":                true,
+	"umac-64-etm@openssh.com":            true,
+	"hmac-ripemd160":                     true,
+	"hmac-ripemd160@openssh.com":         true,
+	"hmac-ripemd160-etm@openssh.com":     true,
+}
+
+// SSHInfo is how an SSH server identified itself and the algorithms it
+// offers, with SSHInfo.
+type SSHInfo struct {
+	// Banner is the identification string, such as
+	// "SSH-2.0-OpenSSH_9.6p1 Ubuntu-3ubuntu13".
+	Banner string `json:"banner"`
+	// Protocol is the protocol version: "2.0", or "1.99" for servers that
+	// also speak the broken SSH-1.
+	Protocol string `json:"protocol"`
+	// Software is the server software and version, like "OpenSSH_9.6p1".
+	Software string `json:"software"`
+	// KEX, HostKeys, Ciphers and MACs are the key exchange, host key,
+	// cipher and MAC algorithms the server offers, in its order of
+	// preference. SSH-1-only servers offer none that can be read.
+	KEX      []string `json:"kex,omitempty"`
+	HostKeys []string `json:"host_keys,omitempty"`
+	Ciphers  []string `json:"ciphers,omitempty"`
+	MACs     []string `json:"macs,omitempty"`
+	// Weak are the offered algorithms, and SSH-1 support, a current
+	// OpenSSH client refuses or warns about.
+	Weak []string `json:"weak,omitempty"`
+}
+
+func (i *SSHInfo) String() string {
+	s := fmt.Sprintf("%s (protocol %s)", i.Software, i.Protocol)
+	if len(i.KEX) > 0 {
+		s += fmt.Sprintf(" kex=%s hostkeys=%s ciphers=%s macs=%s",
+			strings.Join(i.KEX, ","), strings.Join(i.HostKeys, ","), strings.Join(i.Ciphers, ","), strings.Join(i.MACs, ","))
+	}
+	if len(i.Weak) > 0 {
+		s += "; WEAK: " + strings.Join(i.Weak, ", ")
+	}
+	return s
+}
+
+// inspectSSH reads the identification string of the SSH server on address
+// and, by sending our own, its KEXINIT, which lists the algorithms it
+// offers. It returns nil if the port doesn't speak SSH. No key exchange
+// happens, so nothing is logged beyond a dropped connection.
+func (s *Scanner) inspectSSH(ctx context.Context, address string) *SSHInfo {
+	conn, err := s.dial(ctx, "tcp", address)
+	if err != nil {
+		return nil
+	}
+	defer func() { _ = conn.Close() }()
+	_ = conn.SetDeadline(time.Now().Add(s.opts.Timeout))
+	r := bufio.NewReader(conn)
+	banner, err := readSSHIdent(r)
+	if err != nil {
+		return nil
+	}
+	proto, software, _ := strings.Cut(strings.TrimPrefix(banner, "SSH-"), "-")
+	software, _, _ = strings.Cut(software, " ")
+	info := &SSHInfo{Banner: banner, Protocol: proto, Software: software}
+	if proto != "2.0" {
+		info.Weak = append(info.Weak, "SSH-1")
+	}
+	if proto != "2.0" && proto != "1.99" {
+		return info
+	}
+	if _, err := io.WriteString(conn, "SSH-2.0-portcheck\r\n"); err != nil {
+		return info
+	}
+	lists, err := readKEXInit(r)
+	if err != nil {
+		return info
+	}
+	info.KEX, info.HostKeys, info.Ciphers, info.MACs = lists[0], lists[1], lists[2], lists[4]
+	for _, list := range [][]string{info.KEX, info.HostKeys, info.Ciphers, info.MACs} {
+		for _, name := range list {
+			if weakSSH[name] {
+				info.Weak = append(info.Weak, name)
+			}
+		}
+	}
+	return info
+}
+
+// readSSHIdent reads the identification string, skipping the lines of text
+// RFC 4253 lets a server send before it.
+func readSSHIdent(r *bufio.Reader) (string, error) {
+	for range 16 {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return "", err
+		}
+		if strings.HasPrefix(line, "SSH-") {
+			return strings.TrimRight(line, "\r\n"), nil
+		}
+	}
+	return "", errors.New("no SSH identification string")
+}
+
+// readKEXInit reads the server's first binary packet, its KEXINIT, and
+// returns the ten algorithm name-lists in it: key exchange, host key,
+// ciphers and MACs each way, compression each way and languages.
+func readKEXInit(r *bufio.Reader) ([10][]string, error) {
+	var lists [10][]string
+	var header [5]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return lists, err
+	}
+	length := binary.BigEndian.Uint32(header[:4])
+	if length < 1+16 || length > 35000 {
+		return lists, fmt.Errorf("bad packet length %d", length)
+	}
+	packet := make([]byte, length-1)
+	if _, err := io.ReadFull(r, packet); err != nil {
+		return lists, err
+	}
+	padding := min(int(header[4]), len(packet))
+	payload := packet[:len(packet)-padding]
+	if len(payload) < 1+16 || payload[0] != 20 { // SSH_MSG_KEXINIT
+		return lists, errors.New("not a KEXINIT")
+	}
+	b := payload[1+16:] // after the cookie
+	for i := range lists {
+		if len(b) < 4 {
+			return lists, errors.New("short KEXINIT")
+		}
+		n := binary.BigEndian.Uint32(b)
+		if uint32(len(b)-4) < n {
+			return lists, errors.New("short KEXINIT")
+		}
+		if n > 0 {
+			lists[i] = strings.Split(string(b[4:4+n]), ",")
+		}
+		b = b[4+n:]
+	}
+	return lists, nil
+}
@@ -0,0 +1,218 @@
+package portscan
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// starttlsServices maps the services that upgrade a plaintext connection to
+// TLS to the protocol that negotiates it, by the names fingerprinting and
+// /etc/services give them.
+var starttlsServices = map[string]string{
+	"smtp": "smtp", "submission": "smtp",
+	"imap": "imap", "imap2": "imap",
+	"pop3": "pop3",
+	"ldap": "ldap",
+	"ftp":  "ftp",
+}
+
+// starttlsUpgrades are the negotiations, each reading whatever greeting the
+// server sends and asking it to start TLS on r's connection.
+var starttlsUpgrades = map[string]func(conn net.Conn, r *bufio.Reader) error{
+	"smtp": startSMTP,
+	"imap": startIMAP,
+	"pop3": startPOP3,
+	"ldap": startLDAP,
+	"ftp":  startFTP,
+}
+
+// starttlsProtocol is the STARTTLS protocol of the service on port, named
+// service if it was fingerprinted, or "" if it has none. Port 2525 is the
+// common alternative submission port /etc/services doesn't list.
+func starttlsProtocol(port int, service string) string {
+	if service == "" {
+		service = ServiceName("tcp", port)
+	}
+	if port == 2525 && service == "" {
+		return "smtp"
+	}
+	return starttlsServices[service]
+}
+
+// dialTLS connects to address for a TLS handshake, first negotiating the
+// upgrade over protocol if it isn't "". The connection's deadline is
+// Timeout from the dial.
+func (s *Scanner) dialTLS(ctx context.Context, address, protocol string) (net.Conn, error) {
+	conn, err := s.dial(ctx, "tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	_ = conn.SetDeadline(time.Now().Add(s.opts.Timeout))
+	if protocol == "" {
+		return conn, nil
+	}
+	r := bufio.NewReader(conn)
+	if err := starttlsUpgrades[protocol](conn, r); err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("%s STARTTLS: %w", protocol, err)
+	}
+	return &bufferedConn{conn, r}, nil
+}
+
+// readReply reads an SMTP or FTP reply, the last line of a multi-line one
+// included, and returns its code.
+func readReply(r *bufio.Reader) (string, error) {
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return "", err
+		}
+		if len(line) < 4 {
+			return "", fmt.Errorf("bad reply %q", strings.TrimSpace(line))
+		}
+		if line[3] != '-' {
+			return line[:3], nil
+		}
+	}
+}
+
+// command sends line and checks the reply starts with want, reading replies
+// with read.
+func command(conn net.Conn, line, want string, read func() (string, error)) error {
+	if _, err := io.WriteString(conn, line+"\r\n"); err != nil {
+		return err
+	}
+	reply, err := read()
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(reply, want) {
+		return fmt.Errorf("refused: %s", strings.TrimSpace(reply))
+	}
+	return nil
+}
+
+func startSMTP(conn net.Conn, r *bufio.Reader) error {
+	read := func() (string, error) { return readReply(r) }
+	if code, err := read(); err != nil || code != "220" {
+		return greetingError(err)
+	}
+	if err := command(conn, "EHLO portcheck", "250", read); err != nil {
+		return err
+	}
+	return command(conn, "STARTTLS", "220", read)
+}
+
+func startFTP(conn net.Conn, r *bufio.Reader) error {
+	read := func() (string, error) { return readReply(r) }
+	if code, err := read(); err != nil || code != "220" {
+		return greetingError(err)
+	}
+	return command(conn, "AUTH TLS", "234", read)
+}
+
+func startIMAP(conn net.Conn, r *bufio.Reader) error {
+	if greeting, err := r.ReadString('\n'); err != nil || !strings.HasPrefix(greeting, "* OK") {
+		return greetingError(err)
+	}
+	return command(conn, "pc1 STARTTLS", "pc1 OK", func() (string, error) {
+		// untagged lines may come first
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil || strings.HasPrefix(line, "pc1 ") {
+				return line, err
+			}
+		}
+	})
+}
+
+func startPOP3(conn net.Conn, r *bufio.Reader) error {
+	if greeting, err := r.ReadString('\n'); err != nil || !strings.HasPrefix(greeting, "+OK") {
+		return greetingError(err)
+	}
+	return command(conn, "STLS", "+OK", func() (string, error) { return r.ReadString('\n') })
+}
+
+// ldapStartTLS is an LDAPv3 extended request, message ID 1, for the
+// StartTLS operation, 1.3.6.1.4.1.1466.20037.
+var ldapStartTLS = append([]byte{0x30, 0x1d, 0x02, 0x01, 0x01, 0x77, 0x18, 0x80, 0x16}, "1.3.6.1.4.1.1466.20037"...)
+
+func startLDAP(conn net.Conn, r *bufio.Reader) error {
+	if _, err := conn.Write(ldapStartTLS); err != nil {
+		return err
+	}
+	// LDAPMessage { messageID, ExtendedResponse { resultCode, ... } },
+	// read whole so nothing of it is left before TLS starts
+	n, err := berLength(r, 0x30)
+	if err != nil {
+		return err
+	}
+	msg := make([]byte, n)
+	if _, err := io.ReadFull(r, msg); err != nil {
+		return err
+	}
+	m := bufio.NewReader(bytes.NewReader(msg))
+	if n, err = berLength(m, 0x02); err == nil {
+		_, err = m.Discard(n)
+	}
+	if err == nil {
+		_, err = berLength(m, 0x78)
+	}
+	if err == nil {
+		_, err = berLength(m, 0x0a)
+	}
+	if err != nil {
+		return err
+	}
+	code, err := m.ReadByte()
+	if err != nil {
+		return err
+	}
+	if code != 0 {
+		return fmt.Errorf("refused with result code %d", code)
+	}
+	return nil
+}
+
+// berLength reads the tag, which must be tag, and length of a BER element.
+func berLength(r io.ByteReader, tag byte) (int, error) {
+	got, err := r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	if got != tag {
+		return 0, fmt.Errorf("not an LDAP response (tag 0x%02x)", got)
+	}
+	b, err := r.ReadByte()
+	if err != nil || b < 0x80 {
+		return int(b), err
+	}
+	n := 0
+	for range b & 0x7f {
+		c, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		n = n<<8 | int(c)
+	}
+	if n > 1<<16 {
+		return 0, errors.New("LDAP response too long")
+	}
+	return n, nil
+}
+
+// greetingError is err, or an error saying the server didn't greet the way
+// the protocol does if the read itself succeeded.
+func greetingError(err error) error {
+	if err != nil {
+		return err
+	}
+	return errors.New("no greeting")
+}
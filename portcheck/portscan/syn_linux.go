@@ -0,0 +1,251 @@
+//go:build linux
+
+package portscan
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"net/netip"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	tcpFlagSYN = 0x02
+	tcpFlagRST = 0x04
+	tcpFlagACK = 0x10
+)
+
+type synKey struct {
+	ip   [4]byte
+	port uint16
+}
+
+// synScanner sends bare SYN segments over a raw socket and matches the
+// replies read back from the same socket. The kernel has no socket for our
+// source port, so it answers any SYN-ACK with a RST on its own and the
+// handshake is never completed.
+type synScanner struct {
+	fd int
+	// replies are matched by the source ports probes are sent from: one
+	// random port, or the pinned range
+	srcLo, srcHi uint16
+	// source is the -source-ip to send from, if any; device is the
+	// interface the socket is bound to, if any
+	source   net.IP
+	device   control
+	resolver *net.Resolver
+	mu       sync.Mutex
+	pending  map[synKey]chan string
+}
+
+// newSYNScanner opens the raw socket, sending from source and the source
+// ports and interface of opts, if set.
+func newSYNScanner(opts Options, source netip.Addr) (*synScanner, error) {
+	fd, err := syscall.Socket(syscall.AF_INET, syscall.SOCK_RAW, syscall.IPPROTO_TCP)
+	if err != nil {
+		return nil, fmt.Errorf("opening raw socket (needs root or CAP_NET_RAW): %w", err)
+	}
+	s := &synScanner{
+		fd:       fd,
+		srcLo:    uint16(opts.SourcePort),
+		srcHi:    uint16(opts.SourcePortEnd),
+		resolver: opts.Resolver,
+		pending:  map[synKey]chan string{},
+	}
+	if opts.SourcePort == 0 {
+		s.srcLo = uint16(32768 + rand.IntN(28000))
+		s.srcHi = s.srcLo
+	}
+	if source.IsValid() {
+		s.source = source.AsSlice()
+		if err := syscall.Bind(fd, &syscall.SockaddrInet4{Addr: source.As4()}); err != nil {
+			_ = syscall.Close(fd)
+			return nil, fmt.Errorf("binding raw socket to %s: %w", source, err)
+		}
+	}
+	if iface := opts.Interface; iface != "" {
+		if err := syscall.BindToDevice(fd, iface); err != nil {
+			_ = syscall.Close(fd)
+			return nil, fmt.Errorf("binding raw socket to interface %s: %w", iface, err)
+		}
+		if s.device, err = bindToDevice(iface); err != nil {
+			_ = syscall.Close(fd)
+			return nil, err
+		}
+	}
+	go s.receive()
+	return s, nil
+}
+
+func (s *synScanner) close() error {
+	return syscall.Close(s.fd)
+}
+
+func (s *synScanner) receive() {
+	buf := make([]byte, 65535)
+	for {
+		n, _, err := syscall.Recvfrom(s.fd, buf, 0)
+		if err != nil {
+			if err == syscall.EINTR {
+				continue
+			}
+			return
+		}
+		pkt := buf[:n]
+		if len(pkt) < 20 {
+			continue
+		}
+		ihl := int(pkt[0]&0x0f) * 4
+		if len(pkt) < ihl+14 {
+			continue
+		}
+		seg := pkt[ihl:]
+		if port := binary.BigEndian.Uint16(seg[2:4]); port < s.srcLo || port > s.srcHi {
+			continue
+		}
+		key := synKey{port: binary.BigEndian.Uint16(seg[0:2])}
+		copy(key.ip[:], pkt[12:16])
+		flags := seg[13]
+		state := ""
+		switch {
+		case flags&(tcpFlagSYN|tcpFlagACK) == tcpFlagSYN|tcpFlagACK:
+			state = "open"
+		case flags&tcpFlagRST != 0:
+			state = "closed"
+		default:
+			continue
+		}
+		s.mu.Lock()
+		ch, ok := s.pending[key]
+		delete(s.pending, key)
+		s.mu.Unlock()
+		if ok {
+			ch <- state
+		}
+	}
+}
+
+// probe sends a SYN to address from srcPort, or from the scanner's own
+// random port if srcPort is 0.
+func (s *synScanner) probe(ctx context.Context, address string, timeout time.Duration, srcPort uint16) Result {
+	host, port, _ := net.SplitHostPort(address)
+	p, _ := strconv.Atoi(port)
+	r := Result{Type: "probe", Host: host, Port: p, Proto: "tcp"}
+
+	dst, src, err := s.route(host, p)
+	if err != nil {
+		r.setError(err)
+		return r
+	}
+	key := synKey{ip: [4]byte(dst), port: uint16(p)}
+	ch := make(chan string, 1)
+	s.mu.Lock()
+	s.pending[key] = ch
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.pending, key)
+		s.mu.Unlock()
+	}()
+
+	if srcPort == 0 {
+		srcPort = s.srcLo
+	}
+	seg := synSegment(src, dst, srcPort, uint16(p))
+	sa := &syscall.SockaddrInet4{Addr: [4]byte(dst)}
+	start := time.Now()
+	if err := syscall.Sendto(s.fd, seg, 0, sa); err != nil {
+		r.LatencyMS = milliseconds(time.Since(start))
+		r.setError(err)
+		return r
+	}
+	select {
+	case state := <-ch:
+		r.State = state
+		if state == "closed" {
+			r.Reason = "reset"
+		}
+	case <-time.After(timeout):
+		r.State, r.Reason = "filtered", "timeout"
+	case <-ctx.Done():
+		r.setError(ctx.Err())
+	}
+	r.LatencyMS = milliseconds(time.Since(start))
+	return r
+}
+
+// route resolves host to an IPv4 address and finds the local address the
+// segment goes out from, which the TCP checksum needs.
+func (s *synScanner) route(host string, port int) (dst net.IP, src net.IP, err error) {
+	return routeIPv4(s.resolver, s.source, s.device, host, port, "SYN scan")
+}
+
+// routeIPv4 resolves host to an IPv4 address for a raw socket scan and
+// finds the local address packets to it go out from: source if one was
+// given, or else whichever the kernel would pick, over device.
+func routeIPv4(resolver *net.Resolver, source net.IP, device control, host string, port int, scan string) (dst net.IP, src net.IP, err error) {
+	addrs, err := resolver.LookupIP(context.Background(), "ip4", host)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, a := range addrs {
+		if a.To4() != nil {
+			dst = a.To4()
+			break
+		}
+	}
+	if dst == nil {
+		return nil, nil, fmt.Errorf("%s: %s supports IPv4 targets only", host, scan)
+	}
+	if source != nil {
+		return dst, source, nil
+	}
+	d := net.Dialer{Control: device}
+	conn, err := d.Dial("udp4", net.JoinHostPort(dst.String(), strconv.Itoa(port)))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() { _ = conn.Close() }()
+	return dst, conn.LocalAddr().(*net.UDPAddr).IP.To4(), nil
+}
+
+// synSegment builds a TCP SYN with an MSS option so it looks like what a
+// regular stack would send.
+func synSegment(src, dst net.IP, srcPort, dstPort uint16) []byte {
+	seg := make([]byte, 24)
+	binary.BigEndian.PutUint16(seg[0:2], srcPort)
+	binary.BigEndian.PutUint16(seg[2:4], dstPort)
+	binary.BigEndian.PutUint32(seg[4:8], rand.Uint32())
+	seg[12] = 6 << 4 // data offset in 32-bit words
+	seg[13] = tcpFlagSYN
+	binary.BigEndian.PutUint16(seg[14:16], 1024)
+	copy(seg[20:], []byte{2, 4, 0x05, 0xb4}) // MSS 1460
+
+	pseudo := make([]byte, 0, 12+len(seg))
+	pseudo = append(pseudo, src...)
+	pseudo = append(pseudo, dst...)
+	pseudo = append(pseudo, 0, syscall.IPPROTO_TCP, 0, byte(len(seg)))
+	pseudo = append(pseudo, seg...)
+	binary.BigEndian.PutUint16(seg[16:18], checksum(pseudo))
+	return seg
+}
+
+func checksum(b []byte) uint16 {
+	var sum uint32
+	for i := 0; i+1 < len(b); i += 2 {
+		sum += uint32(b[i])<<8 | uint32(b[i+1])
+	}
+	if len(b)%2 == 1 {
+		sum += uint32(b[len(b)-1]) << 8
+	}
+	for sum > 0xffff {
+		sum = sum>>16 + sum&0xffff
+	}
+	return ^uint16(sum)
+}
@@ -0,0 +1,24 @@
+//go:build !linux
+
+package portscan
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"time"
+)
+
+type synScanner struct{}
+
+func newSYNScanner(Options, netip.Addr) (*synScanner, error) {
+	return nil, errors.New("SYN scan is only supported on Linux")
+}
+
+func (s *synScanner) probe(context.Context, string, time.Duration, uint16) Result {
+	return Result{}
+}
+
+func (s *synScanner) close() error {
+	return nil
+}
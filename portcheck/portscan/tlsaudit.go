@@ -0,0 +1,197 @@
+package portscan
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"slices"
+	"strings"
+)
+
+// deprecatedTLS are the protocol versions RFC 8996 and PCI DSS retire.
+var deprecatedTLS = map[uint16]bool{tls.VersionSSL30: true, tls.VersionTLS10: true, tls.VersionTLS11: true}
+
+// TLSAudit is which protocol versions and cipher suites an open port
+// accepts, with TLSAudit.
+type TLSAudit struct {
+	// STARTTLS is the protocol each connection was upgraded over, as in
+	// TLSInfo.
+	STARTTLS string `json:"starttls,omitempty"`
+	// Versions are the accepted versions, oldest first.
+	Versions []TLSVersion `json:"versions"`
+	// Deprecated are the accepted versions that shouldn't be: SSLv3,
+	// TLS 1.0 and TLS 1.1.
+	Deprecated []string `json:"deprecated,omitempty"`
+	// Weak are the accepted cipher suites Go considers insecure, such as
+	// RC4, 3DES and CBC with SHA-256.
+	Weak []string `json:"weak_ciphers,omitempty"`
+}
+
+// TLSVersion is one accepted protocol version and the cipher suites the
+// port accepts over it, in the order the server preferred them. For TLS 1.3
+// only the suite the server chose is known; for SSLv3 none are.
+type TLSVersion struct {
+	Version string   `json:"version"`
+	Ciphers []string `json:"ciphers,omitempty"`
+}
+
+// Compliant reports whether the port accepts neither a deprecated version
+// nor a weak cipher suite.
+func (a *TLSAudit) Compliant() bool {
+	return len(a.Deprecated) == 0 && len(a.Weak) == 0
+}
+
+func (a *TLSAudit) String() string {
+	parts := []string{}
+	for _, v := range a.Versions {
+		switch len(v.Ciphers) {
+		case 0:
+			parts = append(parts, v.Version)
+		case 1:
+			parts = append(parts, v.Version+" (1 suite)")
+		default:
+			parts = append(parts, fmt.Sprintf("%s (%d suites)", v.Version, len(v.Ciphers)))
+		}
+	}
+	s := strings.Join(parts, ", ")
+	if a.STARTTLS != "" {
+		s = "over " + strings.ToUpper(a.STARTTLS) + " STARTTLS: " + s
+	}
+	if len(a.Deprecated) > 0 {
+		s += "; DEPRECATED: " + strings.Join(a.Deprecated, ", ")
+	}
+	if len(a.Weak) > 0 {
+		s += "; WEAK: " + strings.Join(a.Weak, ", ")
+	}
+	return s
+}
+
+// auditTLS handshakes with address once per protocol version, and for
+// TLS 1.0 to 1.2 once more per accepted cipher suite, each time offering
+// every suite Go knows except the ones already accepted, until the server
+// refuses. Every connection is upgraded over the STARTTLS protocol starttls
+// first, if it isn't "". It returns nil if the port doesn't speak TLS at
+// all, which a handshake and an SSLv3 hello settle for most non-TLS ports.
+func (s *Scanner) auditTLS(ctx context.Context, address, starttls string) *TLSAudit {
+	host, _, _ := net.SplitHostPort(address)
+	handshake := func(lo, hi uint16, ciphers []uint16) (tls.ConnectionState, error) {
+		return s.tlsHandshake(ctx, address, host, starttls, lo, hi, ciphers)
+	}
+	_, err := handshake(tls.VersionTLS10, tls.VersionTLS13, allCipherSuites(tls.VersionTLS10))
+	ssl3 := s.acceptsSSL3(ctx, address, starttls)
+	if err != nil && !ssl3 {
+		return nil
+	}
+	audit := &TLSAudit{STARTTLS: starttls}
+	weak := map[uint16]bool{}
+	for _, c := range tls.InsecureCipherSuites() {
+		weak[c.ID] = true
+	}
+	accepted := func(version uint16, ciphers []string) {
+		name := tls.VersionName(version)
+		audit.Versions = append(audit.Versions, TLSVersion{Version: name, Ciphers: ciphers})
+		if deprecatedTLS[version] {
+			audit.Deprecated = append(audit.Deprecated, name)
+		}
+	}
+	if ssl3 {
+		accepted(tls.VersionSSL30, nil)
+	}
+	for _, version := range []uint16{tls.VersionTLS10, tls.VersionTLS11, tls.VersionTLS12} {
+		offered := allCipherSuites(version)
+		ciphers := []string{}
+		for len(offered) > 0 {
+			state, err := handshake(version, version, offered)
+			if err != nil {
+				break
+			}
+			name := tls.CipherSuiteName(state.CipherSuite)
+			ciphers = append(ciphers, name)
+			if weak[state.CipherSuite] && !slices.Contains(audit.Weak, name) {
+				audit.Weak = append(audit.Weak, name)
+			}
+			offered = slices.DeleteFunc(offered, func(id uint16) bool { return id == state.CipherSuite })
+		}
+		if len(ciphers) > 0 {
+			accepted(version, ciphers)
+		}
+	}
+	if state, err := handshake(tls.VersionTLS13, tls.VersionTLS13, nil); err == nil {
+		accepted(tls.VersionTLS13, []string{tls.CipherSuiteName(state.CipherSuite)})
+	}
+	if len(audit.Versions) == 0 {
+		return nil
+	}
+	return audit
+}
+
+// allCipherSuites lists every TLS 1.0-1.2 suite Go implements that can be
+// used with version, secure ones first.
+func allCipherSuites(version uint16) []uint16 {
+	ids := []uint16{}
+	for _, c := range append(tls.CipherSuites(), tls.InsecureCipherSuites()...) {
+		if slices.Contains(c.SupportedVersions, version) {
+			ids = append(ids, c.ID)
+		}
+	}
+	return ids
+}
+
+// tlsHandshake completes one handshake with address at a version between
+// lo and hi, offering ciphers, without verifying the certificate.
+func (s *Scanner) tlsHandshake(ctx context.Context, address, host, starttls string, lo, hi uint16, ciphers []uint16) (tls.ConnectionState, error) {
+	c, err := s.dialTLS(ctx, address, starttls)
+	if err != nil {
+		return tls.ConnectionState{}, err
+	}
+	conn := tls.Client(c, &tls.Config{
+		ServerName:         tlsServerName(host),
+		InsecureSkipVerify: true, // an audit wants to see every server
+		MinVersion:         lo,
+		MaxVersion:         hi,
+		CipherSuites:       ciphers,
+	})
+	defer func() { _ = conn.Close() }()
+	if err := conn.HandshakeContext(ctx); err != nil {
+		return tls.ConnectionState{}, err
+	}
+	return conn.ConnectionState(), nil
+}
+
+// sslClientHello is an SSLv3 ClientHello offering the suites SSLv3 servers
+// commonly have, which Go's TLS stack can't send.
+var sslClientHello = func() []byte {
+	suites := []uint16{0x0035, 0x002f, 0x000a, 0x0005, 0x0004, 0x0039, 0x0033, 0x0016, 0x0009}
+	body := []byte{0x03, 0x00} // version
+	body = append(body, make([]byte, 32)...)
+	body = append(body, 0) // no session ID
+	body = binary.BigEndian.AppendUint16(body, uint16(2*len(suites)))
+	for _, id := range suites {
+		body = binary.BigEndian.AppendUint16(body, id)
+	}
+	body = append(body, 1, 0) // null compression
+	hello := append([]byte{1, 0, byte(len(body) >> 8), byte(len(body))}, body...)
+	return append([]byte{0x16, 0x03, 0x00, byte(len(hello) >> 8), byte(len(hello))}, hello...)
+}()
+
+// acceptsSSL3 reports whether address answers an SSLv3 ClientHello with an
+// SSLv3 ServerHello rather than an alert or a TLS version.
+func (s *Scanner) acceptsSSL3(ctx context.Context, address, starttls string) bool {
+	conn, err := s.dialTLS(ctx, address, starttls)
+	if err != nil {
+		return false
+	}
+	defer func() { _ = conn.Close() }()
+	if _, err := conn.Write(sslClientHello); err != nil {
+		return false
+	}
+	// record header, then the ServerHello's type, length and version
+	reply := make([]byte, 5+6)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return false
+	}
+	return reply[0] == 0x16 && reply[5] == 2 && reply[9] == 0x03 && reply[10] == 0x00
+}
@@ -0,0 +1,88 @@
+package portscan
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// TLSInfo describes the certificate an open port presented.
+type TLSInfo struct {
+	Version string `json:"version"`
+	// STARTTLS is the protocol the connection was upgraded over, for
+	// ports that start in plaintext: smtp, imap, pop3, ldap or ftp.
+	STARTTLS string    `json:"starttls,omitempty"`
+	Subject  string    `json:"subject"`
+	Issuer   string    `json:"issuer"`
+	SANs     []string  `json:"sans,omitempty"`
+	NotAfter time.Time `json:"not_after"`
+	DaysLeft int       `json:"days_left"`
+}
+
+// inspectTLS handshakes with address, after upgrading the connection over
+// the STARTTLS protocol starttls if it isn't "", and describes the leaf
+// certificate, or returns nil if the port doesn't speak TLS. Verification is
+// skipped: expired and self-signed certificates are exactly what an audit
+// wants to see.
+func (s *Scanner) inspectTLS(ctx context.Context, address, starttls string) *TLSInfo {
+	host, _, _ := net.SplitHostPort(address)
+	c, err := s.dialTLS(ctx, address, starttls)
+	if err != nil {
+		return nil
+	}
+	conn := tls.Client(c, &tls.Config{ServerName: tlsServerName(host), InsecureSkipVerify: true})
+	defer func() { _ = conn.Close() }()
+	if err := conn.HandshakeContext(ctx); err != nil {
+		return nil
+	}
+	state := conn.ConnectionState()
+	if len(state.PeerCertificates) == 0 {
+		return nil
+	}
+	info := describeCert(state.PeerCertificates[0])
+	info.Version = tls.VersionName(state.Version)
+	info.STARTTLS = starttls
+	return info
+}
+
+// tlsServerName picks the SNI to send; IP literals aren't valid SNI.
+func tlsServerName(host string) string {
+	if net.ParseIP(host) != nil {
+		return ""
+	}
+	return host
+}
+
+func describeCert(cert *x509.Certificate) *TLSInfo {
+	sans := append([]string{}, cert.DNSNames...)
+	for _, ip := range cert.IPAddresses {
+		sans = append(sans, ip.String())
+	}
+	return &TLSInfo{
+		Subject:  cert.Subject.String(),
+		Issuer:   cert.Issuer.String(),
+		SANs:     sans,
+		NotAfter: cert.NotAfter,
+		DaysLeft: int(time.Until(cert.NotAfter).Hours() / 24),
+	}
+}
+
+func (t *TLSInfo) String() string {
+	expiry := fmt.Sprintf("expires in %d days", t.DaysLeft)
+	if t.DaysLeft < 0 {
+		expiry = fmt.Sprintf("EXPIRED %d days ago", -t.DaysLeft)
+	}
+	version := t.Version
+	if t.STARTTLS != "" {
+		version += " over " + strings.ToUpper(t.STARTTLS) + " STARTTLS"
+	}
+	s := fmt.Sprintf("%s subject=%q issuer=%q", version, t.Subject, t.Issuer)
+	if len(t.SANs) > 0 {
+		s += " sans=" + strings.Join(t.SANs, ",")
+	}
+	return s + fmt.Sprintf(" %s (%s)", expiry, t.NotAfter.Format(time.DateOnly))
+}
@@ -0,0 +1,97 @@
+package portscan
+
+import "sync"
+
+// workerTuner grows and shrinks how many of a scan's worker slots are in
+// use, for AdaptiveWorkers. It reacts to congestion the way TCP does: the
+// pool doubles while probes go well, then grows by a tenth at a time once it
+// has had to back off, and halves when the share of timeouts and resets in
+// the last window of probes climbs above what the scan has been seeing, or
+// as soon as the system runs out of sockets or file descriptors.
+//
+// The slots channel holds a token for every probe in flight; the tuner
+// caps the pool by keeping tokens of its own in it.
+type workerTuner struct {
+	slots chan struct{}
+
+	mu    sync.Mutex
+	limit int
+	// held is how many tokens the tuner has in slots, debt how many more
+	// it takes back from probes as they finish
+	held, debt int
+	backedOff  bool
+	// the window of probes since the last adjustment
+	probes, congested, exhausted int
+	// baseline is the usual share of congested probes, so a scan of
+	// heavily filtered hosts isn't mistaken for an overloaded one
+	baseline float64
+}
+
+// initialWorkers is how many probes an adaptive pool starts with.
+const initialWorkers = 16
+
+func newWorkerTuner(slots chan struct{}) *workerTuner {
+	t := &workerTuner{slots: slots, limit: min(initialWorkers, cap(slots)), baseline: -1}
+	for t.held = 0; t.held < cap(slots)-t.limit; t.held++ {
+		slots <- struct{}{}
+	}
+	return t
+}
+
+// release frees the slot of a finished probe and learns from its result.
+func (t *workerTuner) release(r Result) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.debt > 0 {
+		t.debt--
+		t.held++
+	} else {
+		<-t.slots
+	}
+	t.probes++
+	switch r.Reason {
+	case "resources":
+		t.exhausted++
+	case "timeout", "reset":
+		t.congested++
+	}
+	if t.exhausted > 0 || t.probes >= max(t.limit, 20) {
+		t.adjust()
+	}
+}
+
+func (t *workerTuner) adjust() {
+	share := float64(t.congested) / float64(t.probes)
+	if t.exhausted > 0 || (t.baseline >= 0 && share > t.baseline+0.1) {
+		t.backedOff = true
+		t.resize(max(t.limit/2, 1))
+	} else if t.backedOff {
+		t.resize(t.limit + max(t.limit/10, 1))
+	} else {
+		t.resize(t.limit * 2)
+	}
+	if t.baseline < 0 {
+		t.baseline = share
+	} else {
+		t.baseline += (share - t.baseline) / 4
+	}
+	t.probes, t.congested, t.exhausted = 0, 0, 0
+}
+
+// resize sets the number of usable slots, returning held tokens to grow
+// and taking them back from finishing probes to shrink.
+func (t *workerTuner) resize(limit int) {
+	limit = min(limit, cap(t.slots))
+	for ; t.limit < limit; t.limit++ {
+		if t.debt > 0 {
+			t.debt--
+		} else {
+			t.held--
+			<-t.slots
+		}
+	}
+	if t.limit > limit {
+		t.debt += t.limit - limit
+		t.limit = limit
+	}
+}
@@ -0,0 +1,52 @@
+package portscan
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+// probeUDP sends a datagram, a request the service answers for well-known
+// ports (see udpPayloads), and waits for the outcome. UDP has no handshake,
+// so the only definite answers are a reply (open) or an ICMP port-unreachable,
+// which the kernel surfaces as ECONNREFUSED on a connected socket (closed).
+// Silence could be either an open service that ignored the probe or a
+// firewall dropping it, hence open|filtered.
+func (s *Scanner) probeUDP(ctx context.Context, address string) Result {
+	host, port, _ := net.SplitHostPort(address)
+	p, _ := strconv.Atoi(port)
+	r := Result{Type: "probe", Host: host, Port: p, Proto: "udp"}
+	start := time.Now()
+	conn, err := s.dial(ctx, "udp", address)
+	if err != nil {
+		r.LatencyMS = milliseconds(time.Since(start))
+		r.setError(err)
+		return r
+	}
+	defer func() { _ = conn.Close() }()
+
+	_ = conn.SetDeadline(time.Now().Add(s.probeTimeout(host)))
+	if _, err := conn.Write(udpPayloads[p]); err != nil {
+		r.LatencyMS = milliseconds(time.Since(start))
+		r.setError(err)
+		return r
+	}
+	buf := make([]byte, max(512, s.opts.BannerBytes))
+	n, err := conn.Read(buf)
+	r.LatencyMS = milliseconds(time.Since(start))
+	switch {
+	case err == nil:
+		r.State = "open"
+		if s.opts.Banners {
+			r.Banner = cleanBanner(buf[:min(n, s.opts.BannerBytes)])
+		}
+	case errors.Is(err, os.ErrDeadlineExceeded):
+		r.State, r.Reason = "open|filtered", "no-response"
+	default:
+		r.setError(err)
+	}
+	return r
+}
@@ -0,0 +1,111 @@
+package portscan
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// udpPayloads are the datagrams sent to well-known UDP ports: a request
+// each service answers, even if only with an error, where an empty
+// datagram is ignored and leaves the port open|filtered. Other ports get
+// an empty datagram.
+var udpPayloads = map[int][]byte{
+	53:    dnsQuery,
+	69:    []byte("\x00\x01portcheck\x00octet\x00"), // TFTP read request
+	111:   rpcNullCall(100000, 2),                   // portmapper
+	123:   ntpRequest(),
+	137:   netbiosStatusQuery,
+	161:   snmpGetSysDescr,
+	443:   quicVersionProbe(),
+	623:   []byte("\x06\x00\xff\x06\x00\x00\x11\xbe\x80\x00\x00\x00"), // IPMI RMCP presence ping
+	1434:  {0x02},                                                     // SQL Server browser
+	1900:  []byte("M-SEARCH * HTTP/1.1\r\nHOST: 239.255.255.250:1900\r\nMAN: \"ssdp:discover\"\r\nMX: 1\r\nST: ssdp:all\r\n\r\n"),
+	2049:  rpcNullCall(100003, 3), // NFS
+	3478:  stunBindingRequest,
+	5060:  sipOptions,
+	5351:  {0x00, 0x00}, // NAT-PMP external address request
+	5353:  dnsQuery,
+	11211: []byte("\x00\x01\x00\x00\x00\x01\x00\x00stats\r\n"), // memcached, with the UDP frame header
+}
+
+// dnsQuery asks for the NS records of the root zone, which any resolver or
+// authoritative server answers, if only with REFUSED.
+var dnsQuery = []byte{
+	0x70, 0x63, // id
+	0x01, 0x00, // recursion desired
+	0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, // one question
+	0x00,       // the root
+	0x00, 0x02, // NS
+	0x00, 0x01, // IN
+}
+
+// netbiosStatusQuery is a NetBIOS name service node status request for *.
+var netbiosStatusQuery = append([]byte{
+	0x70, 0x63, 0x00, 0x10, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0x20, 'C', 'K',
+}, append(bytes.Repeat([]byte{'A'}, 30), 0x00, 0x00, 0x21, 0x00, 0x01)...)
+
+// snmpGetSysDescr is an SNMPv2c get of sysDescr.0 with community "public".
+var snmpGetSysDescr = []byte{
+	0x30, 0x29, // sequence
+	0x02, 0x01, 0x01, // version 2c
+	0x04, 0x06, 'p', 'u', 'b', 'l', 'i', 'c',
+	0xa0, 0x1c, // get-request
+	0x02, 0x04, 0x70, 0x63, 0x70, 0x63, // request id
+	0x02, 0x01, 0x00, // error status
+	0x02, 0x01, 0x00, // error index
+	0x30, 0x0e, 0x30, 0x0c,
+	0x06, 0x08, 0x2b, 0x06, 0x01, 0x02, 0x01, 0x01, 0x01, 0x00, // 1.3.6.1.2.1.1.1.0
+	0x05, 0x00,
+}
+
+// stunBindingRequest is a STUN binding request with the RFC 5389 cookie.
+var stunBindingRequest = []byte{
+	0x00, 0x01, 0x00, 0x00,
+	0x21, 0x12, 0xa4, 0x42,
+	'p', 'o', 'r', 't', 'c', 'h', 'e', 'c', 'k', 0x00, 0x00, 0x00,
+}
+
+var sipOptions = []byte("OPTIONS sip:nm SIP/2.0\r\n" +
+	"Via: SIP/2.0/UDP nm;branch=z9hG4bK-portcheck;rport\r\n" +
+	"Max-Forwards: 70\r\n" +
+	"To: <sip:nm2@nm2>\r\n" +
+	"From: <sip:nm@nm>;tag=portcheck\r\n" +
+	"Call-ID: portcheck\r\n" +
+	"CSeq: 1 OPTIONS\r\n" +
+	"Contact: <sip:nm@nm>\r\n" +
+	"Accept: application/sdp\r\n" +
+	"Content-Length: 0\r\n\r\n")
+
+// ntpRequest is an NTPv4 client request.
+func ntpRequest() []byte {
+	b := make([]byte, 48)
+	b[0] = 0x23 // no leap warning, version 4, client mode
+	return b
+}
+
+// rpcNullCall is an ONC RPC call of procedure 0, which does nothing and
+// always succeeds, of program at version.
+func rpcNullCall(program, version uint32) []byte {
+	b := make([]byte, 40)
+	binary.BigEndian.PutUint32(b[0:], 0x70637063) // xid
+	binary.BigEndian.PutUint32(b[4:], 0)          // call
+	binary.BigEndian.PutUint32(b[8:], 2)          // RPC version
+	binary.BigEndian.PutUint32(b[12:], program)
+	binary.BigEndian.PutUint32(b[16:], version)
+	// procedure 0 and null credentials and verifier are all zero
+	return b
+}
+
+// quicVersionProbe is a QUIC long header packet of a version no server
+// speaks, in a datagram padded to the 1200 bytes servers insist on, which
+// they answer with a version negotiation packet.
+func quicVersionProbe() []byte {
+	b := make([]byte, 1200)
+	b[0] = 0xc0
+	binary.BigEndian.PutUint32(b[1:], 0x1a2a3a4a) // reserved for forcing negotiation
+	b[5] = 8                                      // destination connection id length
+	copy(b[6:], "portchek")
+	b[14] = 0 // source connection id length
+	return b
+}
@@ -0,0 +1,80 @@
+package portscan
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"slices"
+	"time"
+)
+
+// errUnverified is the error of ports VerifyOpen couldn't confirm.
+const errUnverified = "connected, but the port sent nothing and answered neither TLS nor HTTP"
+
+// verifyOpen reports whether an accepted connection leads to a service:
+// one that sent banner unprompted, or that answers a TLS ClientHello or an
+// HTTP request on a new connection, in the order the port suggests. Any
+// reply counts, even an alert or an error page. Devices that complete
+// every handshake themselves, like some firewalls and load balancers,
+// send nothing.
+func (s *Scanner) verifyOpen(ctx context.Context, address string, port int, banner []byte) bool {
+	if banner == nil {
+		conn, err := s.dial(ctx, "tcp", address)
+		if err != nil {
+			return false
+		}
+		banner = s.readBanner(conn)
+		_ = conn.Close()
+	}
+	if len(banner) > 0 {
+		return true
+	}
+	host, _, _ := net.SplitHostPort(address)
+	exchanges := []func(net.Conn, string) bool{answersHTTP, answersTLS}
+	if slices.Contains(tlsPorts, port) {
+		slices.Reverse(exchanges)
+	}
+	for _, answers := range exchanges {
+		conn, err := s.dial(ctx, "tcp", address)
+		if err != nil {
+			return false
+		}
+		_ = conn.SetDeadline(time.Now().Add(min(bannerWait, s.opts.Timeout)))
+		ok := answers(conn, host)
+		_ = conn.Close()
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+func answersHTTP(conn net.Conn, host string) bool {
+	if _, err := fmt.Fprintf(conn, "GET / HTTP/1.0\r\nHost: %s\r\nUser-Agent: portcheck\r\n\r\n", host); err != nil {
+		return false
+	}
+	n, _ := conn.Read(make([]byte, 1))
+	return n > 0
+}
+
+func answersTLS(conn net.Conn, host string) bool {
+	counted := &countingConn{Conn: conn}
+	_ = tls.Client(counted, &tls.Config{
+		ServerName:         tlsServerName(host),
+		InsecureSkipVerify: true, // any answer will do
+	}).Handshake()
+	return counted.read > 0
+}
+
+// countingConn counts the bytes read through it.
+type countingConn struct {
+	net.Conn
+	read int
+}
+
+func (c *countingConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	c.read += n
+	return n, err
+}
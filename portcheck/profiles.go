@@ -0,0 +1,81 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// profile is a named audit: the ports it covers and the flags that suit
+// it, for -profile.
+type profile struct {
+	ports    string
+	settings map[string]string
+}
+
+var profiles = map[string]profile{
+	"quick": {
+		ports:    topPortSets["tcp"][100],
+		settings: map[string]string{"timeout": "500ms"},
+	},
+	"web": {
+		ports:    "80,443,3000,5000,8000,8008,8080,8081,8443,8888,9000,9443",
+		settings: map[string]string{"timeout": "2s", "http-probe": "true", "tls-info": "true"},
+	},
+	"db": {
+		ports:    "1433,1521,2379,3306,5432,5984,6379,7000,8086,9042,9200,11211,26257,27017",
+		settings: map[string]string{"timeout": "2s", "sV": "true"},
+	},
+	"mail": {
+		ports:    "25,110,143,465,587,993,995,2525",
+		settings: map[string]string{"timeout": "5s", "banner": "true", "tls-info": "true"},
+	},
+	"windows": {
+		ports:    "53,88,135,139,389,445,464,593,636,3268,3269,3389,5985,5986,9389",
+		settings: map[string]string{"timeout": "2s", "retries": "1"},
+	},
+}
+
+// profileName is the -profile given, and profilePorts the ports it scans
+// when none are given otherwise.
+var profileName, profilePorts string
+
+func profileNames() []string {
+	names := []string{}
+	for name := range profiles {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// applyProfile sets the flags of the -profile that weren't set on the
+// command line, in the environment or in the config file.
+func applyProfile(fs *flag.FlagSet) error {
+	p, ok := profiles[profileName]
+	if !ok {
+		return fmt.Errorf("unknown profile %q; profiles are %s", profileName, strings.Join(profileNames(), ", "))
+	}
+	if err := setUnset(fs, "profile "+profileName, p.settings); err != nil {
+		return err
+	}
+	profilePorts = p.ports
+	return nil
+}
+
+// setUnset sets the flags in settings that weren't set already, for
+// -profile and -T; source names them in errors.
+func setUnset(fs *flag.FlagSet, source string, settings map[string]string) error {
+	given := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { given[f.Name] = true })
+	for name, value := range settings {
+		if given[name] || fs.Lookup(name) == nil {
+			continue
+		}
+		if err := fs.Set(name, value); err != nil {
+			return fmt.Errorf("%s: %s: %w", source, name, err)
+		}
+	}
+	return nil
+}
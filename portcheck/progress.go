@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// progressEvery is how often the progress line is redrawn.
+const progressEvery = 250 * time.Millisecond
+
+// progress draws a single self-overwriting status line on stderr. Results
+// share the terminal, so the line is cleared before each one is printed and
+// redrawn on the next tick. A nil *progress is valid and does nothing.
+type progress struct {
+	mu    sync.Mutex
+	w     io.Writer
+	total int
+	done  int
+	start time.Time
+	drawn bool
+	stop  chan struct{}
+	// stopped is closed once the redraws have ended
+	stopped chan struct{}
+}
+
+// newProgress returns nil when progress is disabled or stderr isn't a
+// terminal, so redirected runs don't fill logs with carriage returns. -v
+// logging also goes to stderr and would be torn apart by the redraws.
+func newProgress(total int) *progress {
+	if noProgress || verbosity > 0 {
+		return nil
+	}
+	if fi, err := os.Stderr.Stat(); err != nil || fi.Mode()&os.ModeCharDevice == 0 {
+		return nil
+	}
+	p := &progress{w: os.Stderr, total: total, start: time.Now(), stop: make(chan struct{}), stopped: make(chan struct{})}
+	go func() {
+		defer close(p.stopped)
+		tick := time.NewTicker(progressEvery)
+		defer tick.Stop()
+		for {
+			select {
+			case <-tick.C:
+				p.draw()
+			case <-p.stop:
+				return
+			}
+		}
+	}()
+	return p
+}
+
+// clear erases the line so a result can be printed in its place.
+func (p *progress) clear() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.erase()
+}
+
+// advance records one finished probe.
+func (p *progress) advance() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	p.done++
+	p.mu.Unlock()
+}
+
+// finish stops redrawing and leaves the terminal clean for the summary.
+func (p *progress) finish() {
+	if p == nil {
+		return
+	}
+	close(p.stop)
+	<-p.stopped
+	p.clear()
+}
+
+func (p *progress) draw() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	elapsed := time.Since(p.start)
+	rate := float64(p.done) / elapsed.Seconds()
+	eta := "?"
+	if rate > 0 {
+		left := time.Duration(float64(p.total-p.done) / rate * float64(time.Second))
+		eta = left.Round(time.Second).String()
+	}
+	fmt.Fprintf(p.w, "\r\033[K%d/%d probes (%.1f%%)  %.0f/s  ETA %s",
+		p.done, p.total, float64(p.done)*100/float64(max(p.total, 1)), rate, eta)
+	p.drawn = true
+}
+
+func (p *progress) erase() {
+	if p.drawn {
+		fmt.Fprint(p.w, "\r\033[K")
+		p.drawn = false
+	}
+}
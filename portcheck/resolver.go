@@ -0,0 +1,38 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+)
+
+// resolver is the -resolver nameserver; nil uses the system's.
+var resolver *net.Resolver
+
+// newResolver returns a resolver that sends every query to server, an IP
+// with an optional port (53 if left out). /etc/hosts is still consulted
+// first, as the system resolver would.
+func newResolver(server string) (*net.Resolver, error) {
+	address := server
+	if _, err := netip.ParseAddr(server); err == nil {
+		address = net.JoinHostPort(server, "53")
+	}
+	ap, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return nil, fmt.Errorf("bad resolver %q: want an IP address with an optional port", server)
+	}
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, ap.String())
+		},
+	}, nil
+}
+
+// lookupResolver is the resolver the CLI's own lookups go through.
+func lookupResolver() *net.Resolver {
+	return cmp.Or(resolver, net.DefaultResolver)
+}
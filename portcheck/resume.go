@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"slices"
+)
+
+// stateFile records every finished probe so an interrupted scan can pick up
+// where it stopped. The first line names the command line the scan was
+// started with; each line after it is one result as JSON, appended as soon as
+// the probe completes so a crash loses at most the line being written.
+type stateFile struct {
+	f    *os.File
+	enc  *json.Encoder
+	done []result
+}
+
+type stateHeader struct {
+	Type string   `json:"type"`
+	Args []string `json:"args"`
+}
+
+// openState loads the results already in path, if any, and opens it for
+// appending. A state file written by a different command line is refused,
+// since its results wouldn't belong to this scan.
+func openState(path string, args []string) (*stateFile, error) {
+	s := &stateFile{}
+	exists, err := s.load(path, args)
+	if err != nil {
+		return nil, err
+	}
+	if s.f, err = os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644); err != nil {
+		return nil, err
+	}
+	s.enc = json.NewEncoder(s.f)
+	if !exists {
+		if err := s.enc.Encode(stateHeader{Type: "state", Args: args}); err != nil {
+			_ = s.f.Close()
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+func (s *stateFile) load(path string, args []string) (bool, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1<<20)
+	if !scanner.Scan() {
+		return false, scanner.Err()
+	}
+	var header stateHeader
+	if err := json.Unmarshal(scanner.Bytes(), &header); err != nil || header.Type != "state" {
+		return false, fmt.Errorf("%s is not a portcheck state file", path)
+	}
+	if !slices.Equal(header.Args, args) {
+		return false, fmt.Errorf("%s belongs to a different scan: portcheck %v", path, header.Args)
+	}
+	for scanner.Scan() {
+		var r result
+		// the last line may be cut short if the previous run was killed
+		if json.Unmarshal(scanner.Bytes(), &r) == nil && r.Type == "probe" {
+			s.done = append(s.done, r)
+		}
+	}
+	return true, scanner.Err()
+}
+
+func (s *stateFile) record(r result) {
+	if err := s.enc.Encode(r); err != nil {
+		slog.Error("writing state file failed", "path", resumePath, "err", err)
+	}
+}
+
+// close keeps the file for the next run unless the scan completed, in which
+// case there is nothing left to resume.
+func (s *stateFile) close(complete bool) {
+	_ = s.f.Close()
+	if complete {
+		_ = os.Remove(s.f.Name())
+	}
+}
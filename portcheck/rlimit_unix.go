@@ -0,0 +1,33 @@
+//go:build unix
+
+package main
+
+import (
+	"log/slog"
+	"syscall"
+)
+
+// fitOpenFileLimit makes room for a socket per worker under RLIMIT_NOFILE.
+// The Go runtime already raises the soft limit to the hard one at start;
+// past that the limit is raised if the process may (root or
+// CAP_SYS_RESOURCE), and otherwise workers is lowered to what it allows,
+// so a big scan runs slower instead of failing probes with "too many open
+// files".
+func fitOpenFileLimit() {
+	var lim syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &lim); err != nil {
+		return
+	}
+	need := uint64(workers + fdReserve)
+	if lim.Cur >= need {
+		return
+	}
+	raised := syscall.Rlimit{Cur: need, Max: max(lim.Max, need)}
+	if err := syscall.Setrlimit(syscall.RLIMIT_NOFILE, &raised); err == nil {
+		slog.Debug("raised the open file limit", "from", lim.Cur, "to", need, "workers", workers)
+		return
+	}
+	fit := max(int(lim.Cur)-fdReserve, 1)
+	slog.Warn("-workers needs more than the open file limit, raise it with ulimit -n", "workers", workers, "limit", lim.Cur, "running", fit)
+	workers = fit
+}
@@ -0,0 +1,6 @@
+// Package scanpb holds the gRPC service that `portcheck serve -grpc-listen`
+// exposes, generated from scan.proto. Clients in other languages can be
+// generated from the same file.
+package scanpb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative scan.proto
@@ -0,0 +1,1028 @@
+// The portcheck scan service: the same jobs as the HTTP API under /scans,
+// with results streamed as probes complete.
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.12
+// 	protoc        (unknown)
+// source: scan.proto
+
+package scanpb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// ScanRequest mirrors the POST /scans body. Fields left unset take the
+// value the server was started with.
+type ScanRequest struct {
+	state    protoimpl.MessageState `protogen:"open.v1"`
+	Targets  []string               `protobuf:"bytes,1,rep,name=targets,proto3" json:"targets,omitempty"`
+	Ports    string                 `protobuf:"bytes,2,opt,name=ports,proto3" json:"ports,omitempty"`
+	TopPorts int32                  `protobuf:"varint,3,opt,name=top_ports,json=topPorts,proto3" json:"top_ports,omitempty"`
+	Udp      bool                   `protobuf:"varint,4,opt,name=udp,proto3" json:"udp,omitempty"`
+	// timeout per probe in Go duration syntax, e.g. "500ms"
+	Timeout          string `protobuf:"bytes,5,opt,name=timeout,proto3" json:"timeout,omitempty"`
+	Retries          *int32 `protobuf:"varint,6,opt,name=retries,proto3,oneof" json:"retries,omitempty"`
+	Banner           bool   `protobuf:"varint,7,opt,name=banner,proto3" json:"banner,omitempty"`
+	VersionDetection bool   `protobuf:"varint,8,opt,name=version_detection,json=versionDetection,proto3" json:"version_detection,omitempty"`
+	TlsInfo          bool   `protobuf:"varint,9,opt,name=tls_info,json=tlsInfo,proto3" json:"tls_info,omitempty"`
+	HttpProbe        bool   `protobuf:"varint,10,opt,name=http_probe,json=httpProbe,proto3" json:"http_probe,omitempty"`
+	unknownFields    protoimpl.UnknownFields
+	sizeCache        protoimpl.SizeCache
+}
+
+func (x *ScanRequest) Reset() {
+	*x = ScanRequest{}
+	mi := &file_scan_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ScanRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ScanRequest) ProtoMessage() {}
+
+func (x *ScanRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_scan_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ScanRequest.ProtoReflect.Descriptor instead.
+func (*ScanRequest) Descriptor() ([]byte, []int) {
+	return file_scan_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *ScanRequest) GetTargets() []string {
+	if x != nil {
+		return x.Targets
+	}
+	return nil
+}
+
+func (x *ScanRequest) GetPorts() string {
+	if x != nil {
+		return x.Ports
+	}
+	return ""
+}
+
+func (x *ScanRequest) GetTopPorts() int32 {
+	if x != nil {
+		return x.TopPorts
+	}
+	return 0
+}
+
+func (x *ScanRequest) GetUdp() bool {
+	if x != nil {
+		return x.Udp
+	}
+	return false
+}
+
+func (x *ScanRequest) GetTimeout() string {
+	if x != nil {
+		return x.Timeout
+	}
+	return ""
+}
+
+func (x *ScanRequest) GetRetries() int32 {
+	if x != nil && x.Retries != nil {
+		return *x.Retries
+	}
+	return 0
+}
+
+func (x *ScanRequest) GetBanner() bool {
+	if x != nil {
+		return x.Banner
+	}
+	return false
+}
+
+func (x *ScanRequest) GetVersionDetection() bool {
+	if x != nil {
+		return x.VersionDetection
+	}
+	return false
+}
+
+func (x *ScanRequest) GetTlsInfo() bool {
+	if x != nil {
+		return x.TlsInfo
+	}
+	return false
+}
+
+func (x *ScanRequest) GetHttpProbe() bool {
+	if x != nil {
+		return x.HttpProbe
+	}
+	return false
+}
+
+type GetScanRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetScanRequest) Reset() {
+	*x = GetScanRequest{}
+	mi := &file_scan_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetScanRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetScanRequest) ProtoMessage() {}
+
+func (x *GetScanRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_scan_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetScanRequest.ProtoReflect.Descriptor instead.
+func (*GetScanRequest) Descriptor() ([]byte, []int) {
+	return file_scan_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *GetScanRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+type ListScansRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListScansRequest) Reset() {
+	*x = ListScansRequest{}
+	mi := &file_scan_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListScansRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListScansRequest) ProtoMessage() {}
+
+func (x *ListScansRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_scan_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListScansRequest.ProtoReflect.Descriptor instead.
+func (*ListScansRequest) Descriptor() ([]byte, []int) {
+	return file_scan_proto_rawDescGZIP(), []int{2}
+}
+
+type ListScansResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Jobs          []*Job                 `protobuf:"bytes,1,rep,name=jobs,proto3" json:"jobs,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListScansResponse) Reset() {
+	*x = ListScansResponse{}
+	mi := &file_scan_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListScansResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListScansResponse) ProtoMessage() {}
+
+func (x *ListScansResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_scan_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListScansResponse.ProtoReflect.Descriptor instead.
+func (*ListScansResponse) Descriptor() ([]byte, []int) {
+	return file_scan_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *ListScansResponse) GetJobs() []*Job {
+	if x != nil {
+		return x.Jobs
+	}
+	return nil
+}
+
+type CancelScanRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CancelScanRequest) Reset() {
+	*x = CancelScanRequest{}
+	mi := &file_scan_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CancelScanRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CancelScanRequest) ProtoMessage() {}
+
+func (x *CancelScanRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_scan_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CancelScanRequest.ProtoReflect.Descriptor instead.
+func (*CancelScanRequest) Descriptor() ([]byte, []int) {
+	return file_scan_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *CancelScanRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+type StreamResultsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StreamResultsRequest) Reset() {
+	*x = StreamResultsRequest{}
+	mi := &file_scan_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StreamResultsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StreamResultsRequest) ProtoMessage() {}
+
+func (x *StreamResultsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_scan_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StreamResultsRequest.ProtoReflect.Descriptor instead.
+func (*StreamResultsRequest) Descriptor() ([]byte, []int) {
+	return file_scan_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *StreamResultsRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+type Job struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Id    string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	// queued, running, done, cancelled or failed
+	Status        string                 `protobuf:"bytes,2,opt,name=status,proto3" json:"status,omitempty"`
+	Request       *ScanRequest           `protobuf:"bytes,3,opt,name=request,proto3" json:"request,omitempty"`
+	Created       *timestamppb.Timestamp `protobuf:"bytes,4,opt,name=created,proto3" json:"created,omitempty"`
+	Started       *timestamppb.Timestamp `protobuf:"bytes,5,opt,name=started,proto3" json:"started,omitempty"`
+	Finished      *timestamppb.Timestamp `protobuf:"bytes,6,opt,name=finished,proto3" json:"finished,omitempty"`
+	Probes        int32                  `protobuf:"varint,7,opt,name=probes,proto3" json:"probes,omitempty"`
+	Summary       *Summary               `protobuf:"bytes,8,opt,name=summary,proto3" json:"summary,omitempty"`
+	Error         string                 `protobuf:"bytes,9,opt,name=error,proto3" json:"error,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Job) Reset() {
+	*x = Job{}
+	mi := &file_scan_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Job) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Job) ProtoMessage() {}
+
+func (x *Job) ProtoReflect() protoreflect.Message {
+	mi := &file_scan_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Job.ProtoReflect.Descriptor instead.
+func (*Job) Descriptor() ([]byte, []int) {
+	return file_scan_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *Job) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Job) GetStatus() string {
+	if x != nil {
+		return x.Status
+	}
+	return ""
+}
+
+func (x *Job) GetRequest() *ScanRequest {
+	if x != nil {
+		return x.Request
+	}
+	return nil
+}
+
+func (x *Job) GetCreated() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Created
+	}
+	return nil
+}
+
+func (x *Job) GetStarted() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Started
+	}
+	return nil
+}
+
+func (x *Job) GetFinished() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Finished
+	}
+	return nil
+}
+
+func (x *Job) GetProbes() int32 {
+	if x != nil {
+		return x.Probes
+	}
+	return 0
+}
+
+func (x *Job) GetSummary() *Summary {
+	if x != nil {
+		return x.Summary
+	}
+	return nil
+}
+
+func (x *Job) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+type Summary struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Probed        int32                  `protobuf:"varint,1,opt,name=probed,proto3" json:"probed,omitempty"`
+	Open          int32                  `protobuf:"varint,2,opt,name=open,proto3" json:"open,omitempty"`
+	OpenFiltered  int32                  `protobuf:"varint,3,opt,name=open_filtered,json=openFiltered,proto3" json:"open_filtered,omitempty"`
+	Filtered      int32                  `protobuf:"varint,4,opt,name=filtered,proto3" json:"filtered,omitempty"`
+	Closed        int32                  `protobuf:"varint,5,opt,name=closed,proto3" json:"closed,omitempty"`
+	Errors        int32                  `protobuf:"varint,6,opt,name=errors,proto3" json:"errors,omitempty"`
+	DurationMs    float64                `protobuf:"fixed64,7,opt,name=duration_ms,json=durationMs,proto3" json:"duration_ms,omitempty"`
+	Interrupted   bool                   `protobuf:"varint,8,opt,name=interrupted,proto3" json:"interrupted,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Summary) Reset() {
+	*x = Summary{}
+	mi := &file_scan_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Summary) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Summary) ProtoMessage() {}
+
+func (x *Summary) ProtoReflect() protoreflect.Message {
+	mi := &file_scan_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Summary.ProtoReflect.Descriptor instead.
+func (*Summary) Descriptor() ([]byte, []int) {
+	return file_scan_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *Summary) GetProbed() int32 {
+	if x != nil {
+		return x.Probed
+	}
+	return 0
+}
+
+func (x *Summary) GetOpen() int32 {
+	if x != nil {
+		return x.Open
+	}
+	return 0
+}
+
+func (x *Summary) GetOpenFiltered() int32 {
+	if x != nil {
+		return x.OpenFiltered
+	}
+	return 0
+}
+
+func (x *Summary) GetFiltered() int32 {
+	if x != nil {
+		return x.Filtered
+	}
+	return 0
+}
+
+func (x *Summary) GetClosed() int32 {
+	if x != nil {
+		return x.Closed
+	}
+	return 0
+}
+
+func (x *Summary) GetErrors() int32 {
+	if x != nil {
+		return x.Errors
+	}
+	return 0
+}
+
+func (x *Summary) GetDurationMs() float64 {
+	if x != nil {
+		return x.DurationMs
+	}
+	return 0
+}
+
+func (x *Summary) GetInterrupted() bool {
+	if x != nil {
+		return x.Interrupted
+	}
+	return false
+}
+
+type Result struct {
+	state   protoimpl.MessageState `protogen:"open.v1"`
+	Host    string                 `protobuf:"bytes,1,opt,name=host,proto3" json:"host,omitempty"`
+	Port    int32                  `protobuf:"varint,2,opt,name=port,proto3" json:"port,omitempty"`
+	Proto   string                 `protobuf:"bytes,3,opt,name=proto,proto3" json:"proto,omitempty"`
+	Service string                 `protobuf:"bytes,4,opt,name=service,proto3" json:"service,omitempty"`
+	Version string                 `protobuf:"bytes,5,opt,name=version,proto3" json:"version,omitempty"`
+	// open, closed, filtered, open|filtered or error
+	State         string    `protobuf:"bytes,6,opt,name=state,proto3" json:"state,omitempty"`
+	LatencyMs     float64   `protobuf:"fixed64,7,opt,name=latency_ms,json=latencyMs,proto3" json:"latency_ms,omitempty"`
+	Reason        string    `protobuf:"bytes,8,opt,name=reason,proto3" json:"reason,omitempty"`
+	Error         string    `protobuf:"bytes,9,opt,name=error,proto3" json:"error,omitempty"`
+	Attempts      int32     `protobuf:"varint,10,opt,name=attempts,proto3" json:"attempts,omitempty"`
+	Banner        string    `protobuf:"bytes,11,opt,name=banner,proto3" json:"banner,omitempty"`
+	Tls           *TLSInfo  `protobuf:"bytes,12,opt,name=tls,proto3" json:"tls,omitempty"`
+	Http          *HTTPInfo `protobuf:"bytes,13,opt,name=http,proto3" json:"http,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Result) Reset() {
+	*x = Result{}
+	mi := &file_scan_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Result) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Result) ProtoMessage() {}
+
+func (x *Result) ProtoReflect() protoreflect.Message {
+	mi := &file_scan_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Result.ProtoReflect.Descriptor instead.
+func (*Result) Descriptor() ([]byte, []int) {
+	return file_scan_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *Result) GetHost() string {
+	if x != nil {
+		return x.Host
+	}
+	return ""
+}
+
+func (x *Result) GetPort() int32 {
+	if x != nil {
+		return x.Port
+	}
+	return 0
+}
+
+func (x *Result) GetProto() string {
+	if x != nil {
+		return x.Proto
+	}
+	return ""
+}
+
+func (x *Result) GetService() string {
+	if x != nil {
+		return x.Service
+	}
+	return ""
+}
+
+func (x *Result) GetVersion() string {
+	if x != nil {
+		return x.Version
+	}
+	return ""
+}
+
+func (x *Result) GetState() string {
+	if x != nil {
+		return x.State
+	}
+	return ""
+}
+
+func (x *Result) GetLatencyMs() float64 {
+	if x != nil {
+		return x.LatencyMs
+	}
+	return 0
+}
+
+func (x *Result) GetReason() string {
+	if x != nil {
+		return x.Reason
+	}
+	return ""
+}
+
+func (x *Result) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+func (x *Result) GetAttempts() int32 {
+	if x != nil {
+		return x.Attempts
+	}
+	return 0
+}
+
+func (x *Result) GetBanner() string {
+	if x != nil {
+		return x.Banner
+	}
+	return ""
+}
+
+func (x *Result) GetTls() *TLSInfo {
+	if x != nil {
+		return x.Tls
+	}
+	return nil
+}
+
+func (x *Result) GetHttp() *HTTPInfo {
+	if x != nil {
+		return x.Http
+	}
+	return nil
+}
+
+type TLSInfo struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Version       string                 `protobuf:"bytes,1,opt,name=version,proto3" json:"version,omitempty"`
+	Subject       string                 `protobuf:"bytes,2,opt,name=subject,proto3" json:"subject,omitempty"`
+	Issuer        string                 `protobuf:"bytes,3,opt,name=issuer,proto3" json:"issuer,omitempty"`
+	Sans          []string               `protobuf:"bytes,4,rep,name=sans,proto3" json:"sans,omitempty"`
+	NotAfter      *timestamppb.Timestamp `protobuf:"bytes,5,opt,name=not_after,json=notAfter,proto3" json:"not_after,omitempty"`
+	DaysLeft      int32                  `protobuf:"varint,6,opt,name=days_left,json=daysLeft,proto3" json:"days_left,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *TLSInfo) Reset() {
+	*x = TLSInfo{}
+	mi := &file_scan_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *TLSInfo) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TLSInfo) ProtoMessage() {}
+
+func (x *TLSInfo) ProtoReflect() protoreflect.Message {
+	mi := &file_scan_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TLSInfo.ProtoReflect.Descriptor instead.
+func (*TLSInfo) Descriptor() ([]byte, []int) {
+	return file_scan_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *TLSInfo) GetVersion() string {
+	if x != nil {
+		return x.Version
+	}
+	return ""
+}
+
+func (x *TLSInfo) GetSubject() string {
+	if x != nil {
+		return x.Subject
+	}
+	return ""
+}
+
+func (x *TLSInfo) GetIssuer() string {
+	if x != nil {
+		return x.Issuer
+	}
+	return ""
+}
+
+func (x *TLSInfo) GetSans() []string {
+	if x != nil {
+		return x.Sans
+	}
+	return nil
+}
+
+func (x *TLSInfo) GetNotAfter() *timestamppb.Timestamp {
+	if x != nil {
+		return x.NotAfter
+	}
+	return nil
+}
+
+func (x *TLSInfo) GetDaysLeft() int32 {
+	if x != nil {
+		return x.DaysLeft
+	}
+	return 0
+}
+
+type HTTPInfo struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Url           string                 `protobuf:"bytes,1,opt,name=url,proto3" json:"url,omitempty"`
+	Status        int32                  `protobuf:"varint,2,opt,name=status,proto3" json:"status,omitempty"`
+	Server        string                 `protobuf:"bytes,3,opt,name=server,proto3" json:"server,omitempty"`
+	Title         string                 `protobuf:"bytes,4,opt,name=title,proto3" json:"title,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *HTTPInfo) Reset() {
+	*x = HTTPInfo{}
+	mi := &file_scan_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *HTTPInfo) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*HTTPInfo) ProtoMessage() {}
+
+func (x *HTTPInfo) ProtoReflect() protoreflect.Message {
+	mi := &file_scan_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use HTTPInfo.ProtoReflect.Descriptor instead.
+func (*HTTPInfo) Descriptor() ([]byte, []int) {
+	return file_scan_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *HTTPInfo) GetUrl() string {
+	if x != nil {
+		return x.Url
+	}
+	return ""
+}
+
+func (x *HTTPInfo) GetStatus() int32 {
+	if x != nil {
+		return x.Status
+	}
+	return 0
+}
+
+func (x *HTTPInfo) GetServer() string {
+	if x != nil {
+		return x.Server
+	}
+	return ""
+}
+
+func (x *HTTPInfo) GetTitle() string {
+	if x != nil {
+		return x.Title
+	}
+	return ""
+}
+
+var File_scan_proto protoreflect.FileDescriptor
+
+const file_scan_proto_rawDesc = "" +
+	"\n" +
+	"\n" +
+	"scan.proto\x12\fportcheck.v1\x1a\x1fgoogle/protobuf/timestamp.proto\"\xb0\x02\n" +
+	"\vScanRequest\x12\x18\n" +
+	"\atargets\x18\x01 \x03(\tR\atargets\x12\x14\n" +
+	"\x05ports\x18\x02 \x01(\tR\x05ports\x12\x1b\n" +
+	"\ttop_ports\x18\x03 \x01(\x05R\btopPorts\x12\x10\n" +
+	"\x03udp\x18\x04 \x01(\bR\x03udp\x12\x18\n" +
+	"\atimeout\x18\x05 \x01(\tR\atimeout\x12\x1d\n" +
+	"\aretries\x18\x06 \x01(\x05H\x00R\aretries\x88\x01\x01\x12\x16\n" +
+	"\x06banner\x18\a \x01(\bR\x06banner\x12+\n" +
+	"\x11version_detection\x18\b \x01(\bR\x10versionDetection\x12\x19\n" +
+	"\btls_info\x18\t \x01(\bR\atlsInfo\x12\x1d\n" +
+	"\n" +
+	"http_probe\x18\n" +
+	" \x01(\bR\thttpProbeB\n" +
+	"\n" +
+	"\b_retries\" \n" +
+	"\x0eGetScanRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\"\x12\n" +
+	"\x10ListScansRequest\":\n" +
+	"\x11ListScansResponse\x12%\n" +
+	"\x04jobs\x18\x01 \x03(\v2\x11.portcheck.v1.JobR\x04jobs\"#\n" +
+	"\x11CancelScanRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\"&\n" +
+	"\x14StreamResultsRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\"\xe5\x02\n" +
+	"\x03Job\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x16\n" +
+	"\x06status\x18\x02 \x01(\tR\x06status\x123\n" +
+	"\arequest\x18\x03 \x01(\v2\x19.portcheck.v1.ScanRequestR\arequest\x124\n" +
+	"\acreated\x18\x04 \x01(\v2\x1a.google.protobuf.TimestampR\acreated\x124\n" +
+	"\astarted\x18\x05 \x01(\v2\x1a.google.protobuf.TimestampR\astarted\x126\n" +
+	"\bfinished\x18\x06 \x01(\v2\x1a.google.protobuf.TimestampR\bfinished\x12\x16\n" +
+	"\x06probes\x18\a \x01(\x05R\x06probes\x12/\n" +
+	"\asummary\x18\b \x01(\v2\x15.portcheck.v1.SummaryR\asummary\x12\x14\n" +
+	"\x05error\x18\t \x01(\tR\x05error\"\xe9\x01\n" +
+	"\aSummary\x12\x16\n" +
+	"\x06probed\x18\x01 \x01(\x05R\x06probed\x12\x12\n" +
+	"\x04open\x18\x02 \x01(\x05R\x04open\x12#\n" +
+	"\ropen_filtered\x18\x03 \x01(\x05R\fopenFiltered\x12\x1a\n" +
+	"\bfiltered\x18\x04 \x01(\x05R\bfiltered\x12\x16\n" +
+	"\x06closed\x18\x05 \x01(\x05R\x06closed\x12\x16\n" +
+	"\x06errors\x18\x06 \x01(\x05R\x06errors\x12\x1f\n" +
+	"\vduration_ms\x18\a \x01(\x01R\n" +
+	"durationMs\x12 \n" +
+	"\vinterrupted\x18\b \x01(\bR\vinterrupted\"\xe6\x02\n" +
+	"\x06Result\x12\x12\n" +
+	"\x04host\x18\x01 \x01(\tR\x04host\x12\x12\n" +
+	"\x04port\x18\x02 \x01(\x05R\x04port\x12\x14\n" +
+	"\x05proto\x18\x03 \x01(\tR\x05proto\x12\x18\n" +
+	"\aservice\x18\x04 \x01(\tR\aservice\x12\x18\n" +
+	"\aversion\x18\x05 \x01(\tR\aversion\x12\x14\n" +
+	"\x05state\x18\x06 \x01(\tR\x05state\x12\x1d\n" +
+	"\n" +
+	"latency_ms\x18\a \x01(\x01R\tlatencyMs\x12\x16\n" +
+	"\x06reason\x18\b \x01(\tR\x06reason\x12\x14\n" +
+	"\x05error\x18\t \x01(\tR\x05error\x12\x1a\n" +
+	"\battempts\x18\n" +
+	" \x01(\x05R\battempts\x12\x16\n" +
+	"\x06banner\x18\v \x01(\tR\x06banner\x12'\n" +
+	"\x03tls\x18\f \x01(\v2\x15.portcheck.v1.TLSInfoR\x03tls\x12*\n" +
+	"\x04http\x18\r \x01(\v2\x16.portcheck.v1.HTTPInfoR\x04http\"\xbf\x01\n" +
+	"\aTLSInfo\x12\x18\n" +
+	"\aversion\x18\x01 \x01(\tR\aversion\x12\x18\n" +
+	"\asubject\x18\x02 \x01(\tR\asubject\x12\x16\n" +
+	"\x06issuer\x18\x03 \x01(\tR\x06issuer\x12\x12\n" +
+	"\x04sans\x18\x04 \x03(\tR\x04sans\x127\n" +
+	"\tnot_after\x18\x05 \x01(\v2\x1a.google.protobuf.TimestampR\bnotAfter\x12\x1b\n" +
+	"\tdays_left\x18\x06 \x01(\x05R\bdaysLeft\"b\n" +
+	"\bHTTPInfo\x12\x10\n" +
+	"\x03url\x18\x01 \x01(\tR\x03url\x12\x16\n" +
+	"\x06status\x18\x02 \x01(\x05R\x06status\x12\x16\n" +
+	"\x06server\x18\x03 \x01(\tR\x06server\x12\x14\n" +
+	"\x05title\x18\x04 \x01(\tR\x05title2\x9d\x03\n" +
+	"\vScanService\x12:\n" +
+	"\n" +
+	"SubmitScan\x12\x19.portcheck.v1.ScanRequest\x1a\x11.portcheck.v1.Job\x12:\n" +
+	"\aGetScan\x12\x1c.portcheck.v1.GetScanRequest\x1a\x11.portcheck.v1.Job\x12L\n" +
+	"\tListScans\x12\x1e.portcheck.v1.ListScansRequest\x1a\x1f.portcheck.v1.ListScansResponse\x12@\n" +
+	"\n" +
+	"CancelScan\x12\x1f.portcheck.v1.CancelScanRequest\x1a\x11.portcheck.v1.Job\x12K\n" +
+	"\rStreamResults\x12\".portcheck.v1.StreamResultsRequest\x1a\x14.portcheck.v1.Result0\x01\x129\n" +
+	"\x04Scan\x12\x19.portcheck.v1.ScanRequest\x1a\x14.portcheck.v1.Result0\x01B7Z5github.com/gishyanart/helper-scripts/portcheck/scanpbb\x06proto3"
+
+var (
+	file_scan_proto_rawDescOnce sync.Once
+	file_scan_proto_rawDescData []byte
+)
+
+func file_scan_proto_rawDescGZIP() []byte {
+	file_scan_proto_rawDescOnce.Do(func() {
+		file_scan_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_scan_proto_rawDesc), len(file_scan_proto_rawDesc)))
+	})
+	return file_scan_proto_rawDescData
+}
+
+var file_scan_proto_msgTypes = make([]protoimpl.MessageInfo, 11)
+var file_scan_proto_goTypes = []any{
+	(*ScanRequest)(nil),           // 0: portcheck.v1.ScanRequest
+	(*GetScanRequest)(nil),        // 1: portcheck.v1.GetScanRequest
+	(*ListScansRequest)(nil),      // 2: portcheck.v1.ListScansRequest
+	(*ListScansResponse)(nil),     // 3: portcheck.v1.ListScansResponse
+	(*CancelScanRequest)(nil),     // 4: portcheck.v1.CancelScanRequest
+	(*StreamResultsRequest)(nil),  // 5: portcheck.v1.StreamResultsRequest
+	(*Job)(nil),                   // 6: portcheck.v1.Job
+	(*Summary)(nil),               // 7: portcheck.v1.Summary
+	(*Result)(nil),                // 8: portcheck.v1.Result
+	(*TLSInfo)(nil),               // 9: portcheck.v1.TLSInfo
+	(*HTTPInfo)(nil),              // 10: portcheck.v1.HTTPInfo
+	(*timestamppb.Timestamp)(nil), // 11: google.protobuf.Timestamp
+}
+var file_scan_proto_depIdxs = []int32{
+	6,  // 0: portcheck.v1.ListScansResponse.jobs:type_name -> portcheck.v1.Job
+	0,  // 1: portcheck.v1.Job.request:type_name -> portcheck.v1.ScanRequest
+	11, // 2: portcheck.v1.Job.created:type_name -> google.protobuf.Timestamp
+	11, // 3: portcheck.v1.Job.started:type_name -> google.protobuf.Timestamp
+	11, // 4: portcheck.v1.Job.finished:type_name -> google.protobuf.Timestamp
+	7,  // 5: portcheck.v1.Job.summary:type_name -> portcheck.v1.Summary
+	9,  // 6: portcheck.v1.Result.tls:type_name -> portcheck.v1.TLSInfo
+	10, // 7: portcheck.v1.Result.http:type_name -> portcheck.v1.HTTPInfo
+	11, // 8: portcheck.v1.TLSInfo.not_after:type_name -> google.protobuf.Timestamp
+	0,  // 9: portcheck.v1.ScanService.SubmitScan:input_type -> portcheck.v1.ScanRequest
+	1,  // 10: portcheck.v1.ScanService.GetScan:input_type -> portcheck.v1.GetScanRequest
+	2,  // 11: portcheck.v1.ScanService.ListScans:input_type -> portcheck.v1.ListScansRequest
+	4,  // 12: portcheck.v1.ScanService.CancelScan:input_type -> portcheck.v1.CancelScanRequest
+	5,  // 13: portcheck.v1.ScanService.StreamResults:input_type -> portcheck.v1.StreamResultsRequest
+	0,  // 14: portcheck.v1.ScanService.Scan:input_type -> portcheck.v1.ScanRequest
+	6,  // 15: portcheck.v1.ScanService.SubmitScan:output_type -> portcheck.v1.Job
+	6,  // 16: portcheck.v1.ScanService.GetScan:output_type -> portcheck.v1.Job
+	3,  // 17: portcheck.v1.ScanService.ListScans:output_type -> portcheck.v1.ListScansResponse
+	6,  // 18: portcheck.v1.ScanService.CancelScan:output_type -> portcheck.v1.Job
+	8,  // 19: portcheck.v1.ScanService.StreamResults:output_type -> portcheck.v1.Result
+	8,  // 20: portcheck.v1.ScanService.Scan:output_type -> portcheck.v1.Result
+	15, // [15:21] is the sub-list for method output_type
+	9,  // [9:15] is the sub-list for method input_type
+	9,  // [9:9] is the sub-list for extension type_name
+	9,  // [9:9] is the sub-list for extension extendee
+	0,  // [0:9] is the sub-list for field type_name
+}
+
+func init() { file_scan_proto_init() }
+func file_scan_proto_init() {
+	if File_scan_proto != nil {
+		return
+	}
+	file_scan_proto_msgTypes[0].OneofWrappers = []any{}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_scan_proto_rawDesc), len(file_scan_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   11,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_scan_proto_goTypes,
+		DependencyIndexes: file_scan_proto_depIdxs,
+		MessageInfos:      file_scan_proto_msgTypes,
+	}.Build()
+	File_scan_proto = out.File
+	file_scan_proto_goTypes = nil
+	file_scan_proto_depIdxs = nil
+}
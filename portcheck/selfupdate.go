@@ -0,0 +1,359 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// releaseRepo is the GitHub repository self-update looks for releases in.
+const releaseRepo = "gishyanart/helper-scripts"
+
+// releaseKey is the base64 ed25519 public key release checksums are signed
+// with, set at build time with -ldflags "-X main.releaseKey=..." or given
+// to -key. Without one self-update won't install anything unless told to
+// with -insecure.
+var releaseKey string
+
+// releaseChecksums is the sha256sum(1) listing every release carries, and
+// releaseSignature its ed25519 signature.
+const (
+	releaseChecksums = "SHA256SUMS"
+	releaseSignature = "SHA256SUMS.sig"
+)
+
+// selfUpdate is what `portcheck self-update` was asked to do.
+type selfUpdate struct {
+	check    bool
+	from     string
+	key      string
+	insecure bool
+}
+
+// releaseAsset is the file name of the binary for this OS and architecture,
+// e.g. portcheck_linux_amd64 or portcheck_windows_amd64.exe.
+func releaseAsset() string {
+	name := "portcheck_" + runtime.GOOS + "_" + runtime.GOARCH
+	if runtime.GOOS == "windows" {
+		name += ".exe"
+	}
+	return name
+}
+
+// runSelfUpdate parses the self-update flags and replaces the running binary
+// with the latest release, or with -check only says whether there is one.
+func runSelfUpdate(argv []string) {
+	var u selfUpdate
+	fs := flag.NewFlagSet("portcheck self-update", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: portcheck self-update [flags]\n\nReplace this binary with the latest %s release for %s/%s, once its checksum checks out.\n\nFlags:\n", releaseRepo, runtime.GOOS, runtime.GOARCH)
+		fs.PrintDefaults()
+	}
+	fs.BoolVar(&u.check, "check", false, "only report whether a newer build is available; exit 1 if so")
+	fs.StringVar(&u.from, "from", "", "fetch "+releaseAsset()+" and "+releaseChecksums+" from this `url` instead of the latest GitHub release, e.g. an internal mirror")
+	fs.StringVar(&u.key, "key", releaseKey, "base64 ed25519 public `key` "+releaseSignature+" must be signed with")
+	fs.BoolVar(&u.insecure, "insecure", false, "install without a key to verify "+releaseSignature+" with, trusting "+releaseChecksums+" from the same place as the binary")
+	_ = fs.Parse(argv)
+	if fs.NArg() > 0 {
+		fs.Usage()
+		os.Exit(exitError)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+	updated, err := u.run(ctx)
+	if err != nil {
+		fatal("self-update: ", err)
+	}
+	if u.check && updated {
+		os.Exit(exitNoneOpen)
+	}
+	os.Exit(exitOpen)
+}
+
+// run reports whether the release differs from the running binary and, if
+// so and not checking, installs it.
+func (u selfUpdate) run(ctx context.Context) (bool, error) {
+	var pub ed25519.PublicKey
+	if u.key != "" {
+		b, err := base64.StdEncoding.DecodeString(u.key)
+		if err != nil || len(b) != ed25519.PublicKeySize {
+			return false, errors.New("-key must be a base64 ed25519 public key")
+		}
+		pub = b
+	}
+	if pub == nil && !u.insecure && !u.check {
+		return false, errors.New("no key to verify " + releaseSignature + " with: give -key, or -insecure to trust " + releaseChecksums + " unsigned")
+	}
+	if u.from != "" && !strings.HasPrefix(u.from, "https://") {
+		return false, errors.New("-from must be an https URL")
+	}
+	exe, err := os.Executable()
+	if err == nil {
+		exe, err = filepath.EvalSymlinks(exe)
+	}
+	if err != nil {
+		return false, fmt.Errorf("finding this binary: %w", err)
+	}
+
+	tag, urls, err := u.locate(ctx)
+	if err != nil {
+		return false, err
+	}
+	sums, err := fetch(ctx, urls[releaseChecksums], 1<<20)
+	if err != nil {
+		return false, err
+	}
+	if pub != nil {
+		if urls[releaseSignature] == "" {
+			return false, fmt.Errorf("release %s has no %s", tag, releaseSignature)
+		}
+		sig, err := fetch(ctx, urls[releaseSignature], 1<<10)
+		if err != nil {
+			return false, err
+		}
+		if !verifySignature(pub, sums, sig) {
+			return false, fmt.Errorf("%s of release %s doesn't match its signature", releaseChecksums, tag)
+		}
+	}
+	want, err := checksumFor(sums, releaseAsset())
+	if err != nil {
+		return false, fmt.Errorf("release %s: %w", tag, err)
+	}
+	if !newerRelease(tag, exe, want) {
+		fmt.Printf("%s is up to date with release %s\n", exe, tag)
+		return false, nil
+	}
+	if u.check {
+		fmt.Printf("release %s is available (running %s)\n", tag, versionLine())
+		return true, nil
+	}
+
+	binary, err := fetch(ctx, urls[releaseAsset()], 256<<20)
+	if err != nil {
+		return false, err
+	}
+	if got := sha256.Sum256(binary); hex.EncodeToString(got[:]) != want {
+		return false, fmt.Errorf("%s of release %s doesn't match its checksum", releaseAsset(), tag)
+	}
+	if err := replaceExecutable(exe, binary); err != nil {
+		return false, err
+	}
+	fmt.Printf("updated %s to release %s\n", exe, tag)
+	return true, nil
+}
+
+// newerRelease reports whether release tag is newer than this build, by
+// their versions; without a version to compare, as for dev builds and -from
+// mirrors, by whether exe's SHA-256 differs from sum, the release binary's.
+func newerRelease(tag, exe, sum string) bool {
+	v, _, _ := buildVersion()
+	if have, ok := parseVersion(v); ok {
+		if want, ok := parseVersion(tag); ok {
+			return compareVersions(want, have) > 0
+		}
+	}
+	have, err := fileSHA256(exe)
+	return err != nil || have != sum
+}
+
+// parseVersion reads the major.minor.patch of a version or release tag such
+// as v1.5.0 or 1.5.0-rc.1, with the pre-release after them, if any.
+func parseVersion(v string) ([4]string, bool) {
+	v = strings.TrimPrefix(v, "v")
+	v, _, _ = strings.Cut(v, "+")
+	core, pre, _ := strings.Cut(v, "-")
+	parts := strings.Split(core, ".")
+	if len(parts) != 3 {
+		return [4]string{}, false
+	}
+	for _, p := range parts {
+		if _, err := strconv.ParseUint(p, 10, 64); err != nil {
+			return [4]string{}, false
+		}
+	}
+	return [4]string{parts[0], parts[1], parts[2], pre}, true
+}
+
+// compareVersions orders versions from parseVersion; a pre-release comes
+// before its release, and pre-releases are compared as strings.
+func compareVersions(a, b [4]string) int {
+	for i := range 3 {
+		x, _ := strconv.ParseUint(a[i], 10, 64)
+		y, _ := strconv.ParseUint(b[i], 10, 64)
+		if c := cmp.Compare(x, y); c != 0 {
+			return c
+		}
+	}
+	switch {
+	case a[3] == b[3]:
+		return 0
+	case a[3] == "":
+		return 1
+	case b[3] == "":
+		return -1
+	}
+	return strings.Compare(a[3], b[3])
+}
+
+// locate finds the release to install, returning its name and the download
+// URL of each file in it. With -from that's a directory of files named as a
+// GitHub release's assets; otherwise the newest GitHub release that has a
+// binary for this platform, since the repository releases other tools too.
+func (u selfUpdate) locate(ctx context.Context) (string, map[string]string, error) {
+	if u.from != "" {
+		base := strings.TrimSuffix(u.from, "/")
+		urls := map[string]string{}
+		for _, name := range []string{releaseAsset(), releaseChecksums, releaseSignature} {
+			urls[name] = base + "/" + name
+		}
+		return base, urls, nil
+	}
+	body, err := fetch(ctx, "https://api.github.com/repos/"+releaseRepo+"/releases?per_page=50", 16<<20)
+	if err != nil {
+		return "", nil, err
+	}
+	var releases []struct {
+		TagName    string `json:"tag_name"`
+		Draft      bool   `json:"draft"`
+		Prerelease bool   `json:"prerelease"`
+		Assets     []struct {
+			Name string `json:"name"`
+			URL  string `json:"browser_download_url"`
+		} `json:"assets"`
+	}
+	if err := json.Unmarshal(body, &releases); err != nil {
+		return "", nil, fmt.Errorf("reading releases: %w", err)
+	}
+	for _, rel := range releases {
+		if rel.Draft || rel.Prerelease {
+			continue
+		}
+		urls := map[string]string{}
+		for _, a := range rel.Assets {
+			urls[a.Name] = a.URL
+		}
+		if urls[releaseAsset()] != "" && urls[releaseChecksums] != "" {
+			return rel.TagName, urls, nil
+		}
+	}
+	return "", nil, fmt.Errorf("no release of %s has %s and %s", releaseRepo, releaseAsset(), releaseChecksums)
+}
+
+// fetch GETs url, at most limit bytes of it. GITHUB_TOKEN, if set, is sent
+// to GitHub to lift its rate limit for unauthenticated requests.
+func fetch(ctx context.Context, url string, limit int64) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "portcheck")
+	if token := os.Getenv("GITHUB_TOKEN"); token != "" && req.URL.Host == "api.github.com" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return nil, fmt.Errorf("GET %s: %w", url, err)
+	}
+	if int64(len(body)) > limit {
+		return nil, fmt.Errorf("GET %s: larger than %d bytes", url, limit)
+	}
+	return body, nil
+}
+
+// verifySignature checks sig, raw or base64 as signify-style tools write
+// it, over sums.
+func verifySignature(pub ed25519.PublicKey, sums, sig []byte) bool {
+	if len(sig) != ed25519.SignatureSize {
+		decoded, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(sig)))
+		if err != nil {
+			return false
+		}
+		sig = decoded
+	}
+	return len(sig) == ed25519.SignatureSize && ed25519.Verify(pub, sums, sig)
+}
+
+// checksumFor finds name's SHA-256 in a sha256sum(1) listing.
+func checksumFor(sums []byte, name string) (string, error) {
+	sc := bufio.NewScanner(bytes.NewReader(sums))
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) == 2 && strings.TrimPrefix(fields[1], "*") == name && len(fields[0]) == sha256.Size*2 {
+			return strings.ToLower(fields[0]), nil
+		}
+	}
+	return "", fmt.Errorf("%s has no checksum for %s", releaseChecksums, name)
+}
+
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// replaceExecutable writes binary next to exe and renames it into place, so
+// a failure halfway leaves the old binary working. Windows won't replace a
+// running executable, so there the old one is moved aside first and left as
+// exe.old.
+func replaceExecutable(exe string, binary []byte) error {
+	mode := os.FileMode(0o755)
+	if fi, err := os.Stat(exe); err == nil {
+		mode = fi.Mode().Perm()
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(exe), "."+filepath.Base(exe)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(binary); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(mode); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if runtime.GOOS == "windows" {
+		old := exe + ".old"
+		_ = os.Remove(old)
+		if err := os.Rename(exe, old); err != nil {
+			return err
+		}
+	}
+	return os.Rename(tmp.Name(), exe)
+}
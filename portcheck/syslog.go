@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Syslog severities used for results and changes, with the user facility.
+const (
+	sevWarning = 4
+	sevNotice  = 5
+	sevInfo    = 6
+
+	facilityUser = 1
+)
+
+// localSyslogSockets are where the local daemon listens on Linux, macOS and
+// the BSDs.
+var localSyslogSockets = []string{"/dev/log", "/var/run/syslog", "/var/run/log"}
+
+var (
+	syslogSpec string
+	syslogSink *syslogWriter
+)
+
+// syslogWriter sends RFC 5424 messages to the local syslog socket or to a
+// remote collector over UDP or TCP. TCP uses octet-counting framing
+// (RFC 6587) so messages can't run together. A failed write reconnects once.
+type syslogWriter struct {
+	mu       sync.Mutex
+	network  string
+	addr     string
+	conn     net.Conn
+	hostname string
+}
+
+// newSyslogWriter accepts "local", udp://host[:port] or tcp://host[:port].
+func newSyslogWriter(spec string) (*syslogWriter, error) {
+	hostname, _ := os.Hostname()
+	w := &syslogWriter{hostname: hostname}
+	if spec == "local" {
+		var err error
+		for _, path := range localSyslogSockets {
+			for _, network := range []string{"unixgram", "unix"} {
+				if w.conn, err = net.Dial(network, path); err == nil {
+					w.network, w.addr = network, path
+					return w, nil
+				}
+			}
+		}
+		return nil, fmt.Errorf("no local syslog socket: %w", err)
+	}
+	u, err := url.Parse(spec)
+	if err != nil || (u.Scheme != "udp" && u.Scheme != "tcp") || u.Hostname() == "" {
+		return nil, fmt.Errorf("syslog must be local, udp://host[:port] or tcp://host[:port], got %q", spec)
+	}
+	w.network, w.addr = u.Scheme, u.Host
+	if u.Port() == "" {
+		w.addr = net.JoinHostPort(u.Hostname(), "514")
+	}
+	if w.conn, err = net.DialTimeout(w.network, w.addr, timeout); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// send writes one message. sd is a complete structured-data element, or "-".
+func (w *syslogWriter) send(severity int, msgID, sd, msg string) {
+	line := fmt.Sprintf("<%d>1 %s %s portcheck %d %s %s %s",
+		facilityUser*8+severity, time.Now().Format(time.RFC3339Nano), w.hostname, os.Getpid(), msgID, sd, msg)
+	if w.network == "tcp" {
+		line = strconv.Itoa(len(line)) + " " + line
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if _, err := w.conn.Write([]byte(line)); err != nil {
+		_ = w.conn.Close()
+		if w.conn, err = net.DialTimeout(w.network, w.addr, timeout); err == nil {
+			_, err = w.conn.Write([]byte(line))
+		}
+		if err != nil {
+			slog.Error("writing to syslog failed", "err", err)
+		}
+	}
+}
+
+// result logs one probe: open ports as notices, anything else (only sent
+// with -show-all) as info.
+func (w *syslogWriter) result(r result) {
+	severity := sevInfo
+	if r.State == "open" {
+		severity = sevNotice
+	}
+	k := portKey{r.Host, r.Port, r.Proto}
+	sd := structuredData("result", "host", r.Host, "port", strconv.Itoa(r.Port), "proto", r.Proto, "state", r.State, "service", r.Service)
+	w.send(severity, "result", sd, k.String()+" "+r.State)
+}
+
+// change logs a watch transition; ports going down are warnings.
+func (w *syslogWriter) change(c change) {
+	severity := sevNotice
+	if c.To != "open" {
+		severity = sevWarning
+	}
+	sd := structuredData("change", "host", c.Host, "port", strconv.Itoa(c.Port), "proto", c.Proto, "from", c.From, "to", c.To)
+	w.send(severity, "change", sd, changeText(c))
+}
+
+// structuredData builds an SD-ELEMENT, leaving out empty params. 32473 is the
+// enterprise number RFC 5612 sets aside for examples and private use.
+func structuredData(kind string, params ...string) string {
+	var b strings.Builder
+	b.WriteString("[" + kind + "@32473")
+	esc := strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`)
+	for i := 0; i+1 < len(params); i += 2 {
+		if params[i+1] != "" {
+			fmt.Fprintf(&b, ` %s="%s"`, params[i], esc.Replace(params[i+1]))
+		}
+	}
+	return b.String() + "]"
+}
@@ -0,0 +1,406 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/netip"
+	"os"
+	"os/signal"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/gishyanart/helper-scripts/portcheck/portscan"
+)
+
+// maxCIDRHosts bounds how many addresses a single CIDR may expand to, a /16
+// for IPv4. Anything bigger is almost certainly a typo.
+const maxCIDRHosts = 1 << 16
+
+// expandTargets splits a comma-separated list of hosts and CIDRs and expands
+// each one, dropping duplicates while keeping the order they were given in.
+func expandTargets(spec string) ([]string, error) {
+	hosts := []string{}
+	seen := map[string]bool{}
+	for target := range strings.SplitSeq(spec, ",") {
+		target = strings.TrimSpace(target)
+		if target == "" {
+			continue
+		}
+		expanded, err := expandTarget(target)
+		if err != nil {
+			return nil, err
+		}
+		for _, host := range expanded {
+			if !seen[host] {
+				seen[host] = true
+				hosts = append(hosts, host)
+			}
+		}
+	}
+	if len(hosts) == 0 {
+		return nil, fmt.Errorf("no hosts in %q", spec)
+	}
+	return hosts, nil
+}
+
+// expandTarget turns a HOST argument into the hosts to scan. A CIDR expands to
+// every address in it, minus the network and broadcast addresses of IPv4
+// subnets larger than /31; a zone on an IPv6 CIDR, as in fe80::%eth0/120, is
+// given to every address. Bracketed IPv6 literals lose their brackets, so
+// [fe80::1%eth0] and fe80::1%eth0 are the same target. Hostnames are returned
+// as is and resolved when dialing.
+func expandTarget(target string) ([]string, error) {
+	if !strings.Contains(target, "/") {
+		target = strings.TrimSuffix(strings.TrimPrefix(target, "["), "]")
+		if addr, err := netip.ParseAddr(target); err == nil {
+			if err := checkFamily(addr); err != nil {
+				return nil, err
+			}
+			if err := checkZone(addr); err != nil {
+				return nil, err
+			}
+			return []string{addr.String()}, nil
+		}
+		if strings.Contains(target, ":") {
+			// [fe80::1%eth0]:22 and the like: the ports are a separate argument
+			return nil, fmt.Errorf("invalid target %q: not an IP address or hostname", target)
+		}
+		return []string{target}, nil
+	}
+	prefix, zone, err := parseZonedPrefix(target)
+	if err != nil {
+		return nil, fmt.Errorf("invalid CIDR %q: %w", target, err)
+	}
+	if err := checkFamily(prefix.Addr()); err != nil {
+		return nil, err
+	}
+	if err := checkZone(prefix.Addr().WithZone(zone)); err != nil {
+		return nil, err
+	}
+	hostBits := prefix.Addr().BitLen() - prefix.Bits()
+	if hostBits > 16 {
+		return nil, fmt.Errorf("CIDR %s has more than %d addresses", target, maxCIDRHosts)
+	}
+	hosts := []string{}
+	for addr := prefix.Addr(); addr.IsValid() && prefix.Contains(addr); addr = addr.Next() {
+		hosts = append(hosts, addr.WithZone(zone).String())
+	}
+	if prefix.Addr().Is4() && hostBits > 1 {
+		hosts = hosts[1 : len(hosts)-1]
+	}
+	return hosts, nil
+}
+
+// parseZonedPrefix parses a CIDR that may carry an IPv6 zone before the
+// prefix length, which netip.ParsePrefix doesn't allow, and returns it masked.
+func parseZonedPrefix(cidr string) (netip.Prefix, string, error) {
+	var zone string
+	if i := strings.IndexByte(cidr, '%'); i >= 0 {
+		if j := strings.IndexByte(cidr[i:], '/'); j > 0 {
+			zone = cidr[i+1 : i+j]
+			cidr = cidr[:i] + cidr[i+j:]
+		}
+	}
+	prefix, err := netip.ParsePrefix(cidr)
+	if err != nil {
+		return netip.Prefix{}, "", err
+	}
+	if zone != "" && !prefix.Addr().Is6() {
+		return netip.Prefix{}, "", fmt.Errorf("zone %q on an IPv4 prefix", zone)
+	}
+	return prefix.Masked(), zone, nil
+}
+
+// checkZone makes sure an IPv6 link-local address says which interface to
+// reach it on, and that the interface exists, so the mistake is reported
+// once rather than as an error on every port.
+func checkZone(addr netip.Addr) error {
+	zone := addr.Zone()
+	if zone == "" {
+		if addr.Is6() && (addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast()) {
+			return fmt.Errorf("link-local address %s needs a zone naming the interface to reach it on, e.g. %s%%%s", addr, addr, exampleInterface())
+		}
+		return nil
+	}
+	if _, err := net.InterfaceByName(zone); err == nil {
+		return nil
+	}
+	if index, err := strconv.Atoi(zone); err == nil {
+		if _, err := net.InterfaceByIndex(index); err == nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s: no interface %q on this host", addr, zone)
+}
+
+// exampleInterface names an interface with an IPv6 link-local address, for
+// error messages, or eth0 if there isn't one.
+func exampleInterface() string {
+	ifaces, _ := net.Interfaces()
+	for _, ifi := range ifaces {
+		addrs, _ := ifi.Addrs()
+		for _, a := range addrs {
+			if n, ok := a.(*net.IPNet); ok && n.IP.To4() == nil && n.IP.IsLinkLocalUnicast() {
+				return ifi.Name
+			}
+		}
+	}
+	return "eth0"
+}
+
+// targetNames maps the addresses -all-addresses found back to the names
+// they were resolved from, in target order, to label their results with.
+var targetNames = map[string][]string{}
+
+// resolveWorkers bounds how many lookups resolveTargets has in flight.
+const resolveWorkers = 32
+
+// resolveTargets replaces every hostname with all the addresses it resolves
+// to, for -all-addresses, so each server behind a round-robin or anycast
+// name is scanned rather than whichever one the dialer picks. Names are
+// looked up concurrently, each once however often it's listed, and an
+// address several names point at is scanned once. Names that don't resolve
+// are kept, and their probes report why, except with -hostnames, where a
+// list from subdomain enumeration is expected to have stale names in it and
+// they're only counted.
+func resolveTargets(hosts []string) []string {
+	proto := network("ip")
+	if synScan || sctpScan {
+		proto = "ip4"
+	}
+	type lookup struct {
+		addrs []netip.Addr
+		err   error
+	}
+	type name struct {
+		host string
+		l    *lookup
+	}
+	lookups := map[string]*lookup{}
+	names := make(chan name)
+	var wg sync.WaitGroup
+	for range min(resolveWorkers, len(hosts)) {
+		wg.Go(func() {
+			// the workers get the lookup to fill in with the name and
+			// never touch the map, which is still being written
+			for n := range names {
+				ctx, cancel := context.WithTimeout(context.Background(), timeout)
+				n.l.addrs, n.l.err = lookupResolver().LookupNetIP(ctx, proto, n.host)
+				cancel()
+			}
+		})
+	}
+	for _, host := range hosts {
+		if _, err := netip.ParseAddr(host); err == nil || lookups[host] != nil {
+			continue
+		}
+		l := &lookup{}
+		lookups[host] = l
+		names <- name{host, l}
+	}
+	close(names)
+	wg.Wait()
+
+	resolved := []string{}
+	seen := map[string]bool{}
+	add := func(host string) {
+		if !seen[host] {
+			seen[host] = true
+			resolved = append(resolved, host)
+		}
+	}
+	unresolved := 0
+	for _, host := range hosts {
+		l := lookups[host]
+		if l == nil {
+			add(host)
+			continue
+		}
+		if l.err != nil || len(l.addrs) == 0 {
+			if hostnameList == "" {
+				add(host)
+			} else if !seen[host] {
+				seen[host] = true
+				unresolved++
+				slog.Debug("skipping name that doesn't resolve", "host", host, "err", l.err)
+			}
+			continue
+		}
+		slog.Debug("scanning all addresses", "host", host, "addrs", l.addrs)
+		for _, addr := range l.addrs {
+			ip := addr.Unmap().String()
+			if !slices.Contains(targetNames[ip], host) {
+				targetNames[ip] = append(targetNames[ip], host)
+			}
+			add(ip)
+		}
+	}
+	if hostnameList != "" {
+		slog.Info("resolved hostnames", "names", len(lookups), "addresses", len(resolved), "unresolved", unresolved)
+	}
+	return resolved
+}
+
+// excludeTargets drops hosts named in -exclude-hosts and addresses inside any
+// -exclude-cidr prefix. Matching is on the target as given: hostnames are not
+// resolved, so excluding a CIDR doesn't exclude names that point into it.
+func excludeTargets(hosts []string) ([]string, error) {
+	if excludeHosts == "" && excludeCIDRs == "" {
+		return hosts, nil
+	}
+	names := map[string]bool{}
+	for host := range strings.SplitSeq(excludeHosts, ",") {
+		host = strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(host), "["), "]")
+		if addr, err := netip.ParseAddr(host); err == nil {
+			host = addr.String()
+		}
+		if host != "" {
+			names[host] = true
+		}
+	}
+	prefixes := []netip.Prefix{}
+	for cidr := range strings.SplitSeq(excludeCIDRs, ",") {
+		if cidr = strings.TrimSpace(cidr); cidr == "" {
+			continue
+		}
+		// a zone doesn't narrow an exclusion: fe80::/10 is fe80::/10 on
+		// every interface
+		prefix, _, err := parseZonedPrefix(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -exclude-cidr %q: %w", cidr, err)
+		}
+		prefixes = append(prefixes, prefix)
+	}
+	kept := []string{}
+	for _, host := range hosts {
+		if names[host] {
+			continue
+		}
+		if addr, err := netip.ParseAddr(host); err == nil && slices.ContainsFunc(prefixes, func(p netip.Prefix) bool {
+			return p.Contains(addr.WithZone(""))
+		}) {
+			continue
+		}
+		kept = append(kept, host)
+	}
+	if len(kept) == 0 {
+		return nil, fmt.Errorf("every target is excluded")
+	}
+	return kept, nil
+}
+
+// checkFamily rejects literal targets that contradict -4 or -6.
+func checkFamily(addr netip.Addr) error {
+	addr = addr.Unmap()
+	if ipFamily == "4" && !addr.Is4() {
+		return fmt.Errorf("%s is not an IPv4 address", addr)
+	}
+	if ipFamily == "6" && !addr.Is6() {
+		return fmt.Errorf("%s is not an IPv6 address", addr)
+	}
+	return nil
+}
+
+// readTargets loads hosts from a file with one host, CIDR or comma-separated
+// list per line. Blank lines and anything after a # are ignored.
+func readTargets(path string) ([]string, error) {
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer func() { _ = f.Close() }()
+		r = f
+	}
+	targets := []string{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		if line = strings.TrimSpace(line); line != "" {
+			targets = append(targets, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+	return expandTargets(strings.Join(targets, ","))
+}
+
+// readHostnames loads a -hostnames file: one name per line, as subdomain
+// enumeration tools write them. Only the first field of a line is used, so
+// output that lists a name with its source or addresses works as is, and
+// names are lowercased and lose a trailing dot so each is resolved once.
+// Blank lines and anything after a # are ignored.
+func readHostnames(path string) ([]string, error) {
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer func() { _ = f.Close() }()
+		r = f
+	}
+	names := []string{}
+	seen := map[string]bool{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		fields := strings.FieldsFunc(line, func(c rune) bool { return c == ',' || c == ' ' || c == '\t' })
+		if len(fields) == 0 {
+			continue
+		}
+		name := strings.TrimSuffix(strings.ToLower(fields[0]), ".")
+		if name != "" && !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("%s has no hostnames", path)
+	}
+	return names, nil
+}
+
+// discoverHosts keeps the hosts that answer a ping, for -discover, so a
+// sparse CIDR costs one timeout per empty address instead of one per port.
+// Ctrl-C stops the sweep and scans the hosts found up so far.
+func discoverHosts(hosts []string) []string {
+	opts := scanOptions()
+	opts.Workers = max(min(workers, len(hosts)), 1)
+	opts.OnAttempt = nil
+	s, err := portscan.New(opts)
+	if err != nil {
+		fatal(err)
+	}
+	defer func() { _ = s.Close() }()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	start := time.Now()
+	up := []string{}
+	for _, st := range s.Discover(ctx, hosts, discoverPorts) {
+		if !st.Up {
+			slog.Log(context.Background(), levelTrace, "host down", "host", st.Host)
+			continue
+		}
+		slog.Debug("host up", "host", st.Host, "reason", st.Reason, "latency", formatLatency(st.LatencyMS))
+		up = append(up, st.Host)
+	}
+	slog.Info("discovery done", "up", len(up), "hosts", len(hosts), "took", time.Since(start).Round(time.Millisecond))
+	if len(up) == 0 {
+		os.Exit(exitNoneOpen)
+	}
+	return up
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/template"
+)
+
+// resultTemplate is the -template -format template prints each result with.
+var resultTemplate *template.Template
+
+// templateFuncs are the functions -template can call beyond text/template's
+// own.
+var templateFuncs = template.FuncMap{
+	"json": func(v any) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+	"join":  strings.Join,
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+}
+
+func parseResultTemplate(text string) (*template.Template, error) {
+	return template.New("result").Funcs(templateFuncs).Parse(text)
+}
+
+// templateFormatter prints each result through -template, a line per
+// result: a newline is added unless the template ends with one. It prints
+// the ports text output would, every one with -show-all or -show-errors.
+type templateFormatter struct {
+	w   io.Writer
+	buf bytes.Buffer
+	// err is the first result the template failed on; the rest are skipped
+	err error
+}
+
+func (f *templateFormatter) result(r result) {
+	if f.err != nil {
+		return
+	}
+	if r.State != "open" && r.State != "open|filtered" && !showAll && !showErrors {
+		return
+	}
+	f.buf.Reset()
+	if err := resultTemplate.Execute(&f.buf, r); err != nil {
+		f.err = fmt.Errorf("template: %s:%d/%s: %w", r.Host, r.Port, r.Proto, err)
+		return
+	}
+	if !bytes.HasSuffix(f.buf.Bytes(), []byte("\n")) {
+		f.buf.WriteByte('\n')
+	}
+	_, _ = f.w.Write(f.buf.Bytes())
+}
+
+func (f *templateFormatter) finish(summary) error {
+	return f.err
+}
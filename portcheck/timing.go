@@ -0,0 +1,66 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// timingTemplate is a named trade of speed against stealth and load, for
+// -T, the way nmap's -T0 to -T5 are.
+type timingTemplate struct {
+	name     string
+	settings map[string]string
+}
+
+// timingTemplates are indexed by their number. normal is the defaults.
+var timingTemplates = []timingTemplate{
+	{"paranoid", map[string]string{"timeout": "10s", "retries": "2", "workers": "1", "rate": "0.0033"}},
+	{"sneaky", map[string]string{"timeout": "10s", "retries": "2", "workers": "1", "rate": "0.0667"}},
+	{"polite", map[string]string{"timeout": "5s", "retries": "2", "workers": "10", "rate": "2.5"}},
+	{"normal", map[string]string{}},
+	{"aggressive", map[string]string{"timeout": "1s", "retries": "1", "workers": "500"}},
+	{"insane", map[string]string{"timeout": "300ms", "workers": "2000"}},
+}
+
+// timingName is the -T given.
+var timingName string
+
+// nmapTiming is nmap's spelling, -T4, which the flag package would take for
+// a flag named T4.
+var nmapTiming = regexp.MustCompile(`^--?T([0-5])$`)
+
+// splitTiming rewrites -T4 in argv as -T=4.
+func splitTiming(argv []string) []string {
+	argv = slices.Clone(argv)
+	for i, arg := range argv {
+		if m := nmapTiming.FindStringSubmatch(arg); m != nil {
+			argv[i] = "-T=" + m[1]
+		}
+	}
+	return argv
+}
+
+func timingNames() []string {
+	names := []string{}
+	for _, t := range timingTemplates {
+		names = append(names, t.name)
+	}
+	return names
+}
+
+// applyTiming sets the flags of the -T template that weren't set on the
+// command line, in the environment or in the config file.
+func applyTiming(fs *flag.FlagSet) error {
+	i := slices.Index(timingNames(), timingName)
+	if n, err := strconv.Atoi(timingName); err == nil && n >= 0 && n < len(timingTemplates) {
+		i = n
+	}
+	if i < 0 {
+		return fmt.Errorf("unknown timing template %q; use 0-5 or %s", timingName, strings.Join(timingNames(), ", "))
+	}
+	return setUnset(fs, "timing template "+timingTemplates[i].name, timingTemplates[i].settings)
+}
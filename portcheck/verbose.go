@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/netip"
+	"time"
+)
+
+// verbosity is set by -v (1) and -vv (2). Level 1 logs name resolution,
+// retries and the error behind every failed probe; level 2 adds each probe
+// attempt as it starts and finishes.
+var verbosity int
+
+// logResolution looks up every hostname target once and logs what it resolved
+// to, so a scan of the wrong addresses is visible before it starts. Through a
+// proxy names resolve on the proxy's side, so there is nothing to log.
+func logResolution(hosts []string) {
+	if verbosity < 1 || proxyURL != "" {
+		return
+	}
+	for _, host := range hosts {
+		if _, err := netip.ParseAddr(host); err == nil {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		start := time.Now()
+		addrs, err := lookupResolver().LookupNetIP(ctx, network("ip"), host)
+		cancel()
+		if err != nil {
+			slog.Debug("resolve failed", "host", host, "err", err)
+			continue
+		}
+		slog.Debug("resolved", "host", host, "addrs", addrs, "took", formatLatency(milliseconds(time.Since(start))))
+	}
+}
+
+// logProbe reports the outcome of one attempt at address, and whether it is
+// about to be retried.
+func logProbe(address string, attempt int, r result) {
+	switch {
+	case r.Error != "":
+		slog.Debug("probe", "address", address, "attempt", attempt, "state", r.State, "reason", r.Reason, "err", r.Error)
+	case r.Reason != "":
+		slog.Log(context.Background(), levelTrace, "probe", "address", address, "attempt", attempt, "state", r.State, "reason", r.Reason, "latency", formatLatency(r.LatencyMS))
+	default:
+		slog.Log(context.Background(), levelTrace, "probe", "address", address, "attempt", attempt, "state", r.State, "latency", formatLatency(r.LatencyMS))
+	}
+	if attempt <= retries && (r.State == "filtered" || r.State == "open|filtered") {
+		slog.Debug("retry", "address", address, "state", r.State, "attempt", attempt+1, "of", retries+1)
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/debug"
+)
+
+// version, commit and buildDate are set at build time:
+//
+//	go build -ldflags "-X main.version=1.4.0 -X main.commit=$(git rev-parse HEAD) -X main.buildDate=$(date -u +%FT%TZ)"
+//
+// Whatever isn't set comes from the build info Go embeds: the module version
+// for go install, the VCS revision and commit time for builds in a checkout.
+var (
+	version   string
+	commit    string
+	buildDate string
+)
+
+// buildVersion is this build's version, commit and date, filled in from the
+// embedded build info where -ldflags left them out.
+func buildVersion() (v, rev, date string) {
+	v, rev, date = version, commit, buildDate
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return cmp.Or(v, "dev"), cmp.Or(rev, "unknown"), cmp.Or(date, "unknown")
+	}
+	if v == "" && info.Main.Version != "" && info.Main.Version != "(devel)" {
+		v = info.Main.Version
+	}
+	modified := false
+	for _, s := range info.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			if rev == "" {
+				rev = s.Value
+			}
+		case "vcs.time":
+			if date == "" {
+				date = s.Value
+			}
+		case "vcs.modified":
+			modified = s.Value == "true"
+		}
+	}
+	if modified && commit == "" && rev != "" {
+		rev += "-dirty"
+	}
+	return cmp.Or(v, "dev"), cmp.Or(rev, "unknown"), cmp.Or(date, "unknown")
+}
+
+// versionLine is what -version prints.
+func versionLine() string {
+	v, rev, date := buildVersion()
+	return fmt.Sprintf("portcheck %s (commit %s, built %s, %s %s/%s)", v, rev, date, runtime.Version(), runtime.GOOS, runtime.GOARCH)
+}
+
+// printVersion is -version and `portcheck version`: it prints versionLine and
+// exits.
+func printVersion(string) error {
+	fmt.Println(versionLine())
+	os.Exit(exitOpen)
+	return nil
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"time"
+)
+
+// watchEvery is the monitor -interval.
+var watchEvery time.Duration
+
+// watch rescans addresses every watchEvery until ctx ends and reports only
+// the ports that came up or went down since the previous round. The first
+// round sets the baseline and is summarized on stderr.
+func watch(ctx context.Context, addresses addressList, w io.Writer) {
+	defer closeAlerts()
+	enc := json.NewEncoder(w)
+	var previous map[portKey]string
+	for {
+		current := map[portKey]string{}
+		open := 0
+		for r := range scan(ctx, ctx, addresses) {
+			current[portKey{r.Host, r.Port, r.Proto}] = r.State
+			if r.State == "open" {
+				open++
+			}
+		}
+		if ctx.Err() != nil {
+			// a round cut short would report everything it missed as down
+			return
+		}
+		now := time.Now().UTC().Format(time.RFC3339)
+		if previous == nil {
+			slog.Info("watching", "ports", len(current), "interval", watchEvery, "open", open)
+		} else {
+			for _, k := range changedPorts(previous, current) {
+				c := change{Type: "change", Host: k.host, Port: k.port, Proto: k.proto, From: previous[k], To: current[k], Time: now}
+				reportChange(w, enc, c)
+				notifyAll(alert{text: changeText(c), change: &c})
+				if syslogSink != nil {
+					syslogSink.change(c)
+				}
+			}
+		}
+		previous = current
+		select {
+		case <-time.After(watchEvery):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func reportChange(w io.Writer, enc *json.Encoder, c change) {
+	var err error
+	switch {
+	case outputFormat == "json":
+		err = enc.Encode(c)
+	case c.To == "open":
+		_, err = fmt.Fprintf(w, "%s%s UP %s (was %s)\n", c.Time, jobTag(c), portKey{c.Host, c.Port, c.Proto}, c.From)
+	default:
+		_, err = fmt.Fprintf(w, "%s%s DOWN %s (now %s)\n", c.Time, jobTag(c), portKey{c.Host, c.Port, c.Proto}, c.To)
+	}
+	if err != nil {
+		slog.Error("writing output failed", "err", err)
+	}
+}
+
+// jobTag puts the daemon job's name after the time in text output.
+func jobTag(c change) string {
+	if c.Job == "" {
+		return ""
+	}
+	return " " + c.Job
+}
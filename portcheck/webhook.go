@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const (
+	// webhookAttempts is how many times a change is POSTed before giving up,
+	// sleeping webhookBackoff, then twice that, and so on, in between.
+	webhookAttempts = 5
+	webhookBackoff  = time.Second
+	// webhookDrain is how long a stopping watch waits for queued alerts.
+	webhookDrain = 10 * time.Second
+)
+
+var webhookURL string
+
+// alerts are the configured -webhook and -notify destinations.
+var alerts []*notifier
+
+// alert is one event worth telling someone about: a watch transition, which
+// carries the change, or a summary of a finished scan, which is text only.
+type alert struct {
+	text   string
+	change *change
+}
+
+// notifier POSTs alerts to a URL one at a time, in order, on its own
+// goroutine so a slow or failing endpoint never holds up the scan. payload
+// builds the JSON body the endpoint expects. Messages name the destination
+// by kind rather than URL, since chat webhook URLs embed their token.
+type notifier struct {
+	name    string
+	url     string
+	payload func(alert) any
+	client  *http.Client
+	queue   chan alert
+	done    chan struct{}
+}
+
+func checkWebhookURL(raw string) error {
+	if u, err := url.Parse(raw); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("webhook must be an http or https URL")
+	}
+	return nil
+}
+
+// webhookPayload is the change itself; -webhook is a monitor flag, so every
+// alert it sees has one.
+func webhookPayload(a alert) any {
+	return a.change
+}
+
+func newNotifier(name, url string, payload func(alert) any) *notifier {
+	n := &notifier{
+		name:    name,
+		url:     url,
+		payload: payload,
+		client:  &http.Client{Timeout: 10 * time.Second},
+		queue:   make(chan alert, 256),
+		done:    make(chan struct{}),
+	}
+	go func() {
+		defer close(n.done)
+		for a := range n.queue {
+			n.send(a)
+		}
+	}()
+	return n
+}
+
+// notify queues a, dropping it if the endpoint has fallen far behind.
+func (n *notifier) notify(a alert) {
+	select {
+	case n.queue <- a:
+	default:
+		slog.Warn("queue full, dropping alert", "notifier", n.name, "alert", a.text)
+	}
+}
+
+// notifyAll sends a to every configured destination.
+func notifyAll(a alert) {
+	for _, n := range alerts {
+		n.notify(a)
+	}
+}
+
+// closeAlerts waits for every destination to deliver what it has queued.
+func closeAlerts() {
+	for _, n := range alerts {
+		n.close()
+	}
+}
+
+// close stops accepting changes and waits up to webhookDrain for the queue
+// to empty.
+func (n *notifier) close() {
+	close(n.queue)
+	select {
+	case <-n.done:
+	case <-time.After(webhookDrain):
+		slog.Warn("gave up on undelivered alerts", "notifier", n.name)
+	}
+}
+
+// send retries on network errors, 429 and 5xx with exponential backoff;
+// any other status means the endpoint rejected the payload and retrying
+// won't help.
+func (n *notifier) send(a alert) {
+	body, err := json.Marshal(n.payload(a))
+	if err != nil {
+		slog.Error("delivery failed", "notifier", n.name, "err", err)
+		return
+	}
+	wait := webhookBackoff
+	for attempt := 1; ; attempt++ {
+		err := n.post(body)
+		if err == nil {
+			return
+		}
+		if _, retry := err.(retryable); !retry || attempt == webhookAttempts {
+			slog.Error("delivery failed, giving up", "notifier", n.name, "err", err, "attempts", attempt)
+			return
+		}
+		slog.Debug("delivery failed, retrying", "notifier", n.name, "err", err, "in", wait)
+		time.Sleep(wait)
+		wait *= 2
+	}
+}
+
+// retryable marks a delivery failure worth another attempt.
+type retryable struct{ error }
+
+func (n *notifier) post(body []byte) error {
+	resp, err := n.client.Post(n.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return retryable{err}
+	}
+	_ = resp.Body.Close()
+	switch {
+	case resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return retryable{fmt.Errorf("answered %s", resp.Status)}
+	}
+	return fmt.Errorf("answered %s", resp.Status)
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/netip"
+	"slices"
+	"strings"
+	"time"
+)
+
+// whoisLookup is -whois, and whoisServer -whois-server: the server asked
+// first instead of IANA's, which refers on to the registry of a block.
+var (
+	whoisLookup bool
+	whoisServer string
+)
+
+const (
+	whoisIANA    = "whois.iana.org"
+	whoisTimeout = 10 * time.Second
+	// whoisHops bounds how many referrals are followed, IANA to a registry
+	// to, for legacy ARIN space, another registry
+	whoisHops = 4
+)
+
+// netblock is what -whois reports about a block with scanned hosts in it.
+type netblock struct {
+	// Range is the block as its registry writes it, a CIDR or start - end
+	Range   string   `json:"range"`
+	Name    string   `json:"name,omitempty"`
+	Org     string   `json:"org,omitempty"`
+	Country string   `json:"country,omitempty"`
+	Server  string   `json:"whois_server"`
+	Hosts   []string `json:"hosts"`
+	Open    int      `json:"open"`
+
+	start, end netip.Addr
+}
+
+func (b netblock) String() string {
+	s := b.Range
+	if b.Name != "" {
+		s += " " + b.Name
+	}
+	details := []string{}
+	for _, d := range []string{b.Org, b.Country} {
+		if d != "" {
+			details = append(details, d)
+		}
+	}
+	if len(details) > 0 {
+		s += " (" + strings.Join(details, ", ") + ")"
+	}
+	return s + ": " + strings.Join(b.Hosts, ", ")
+}
+
+func (b *netblock) contains(ip netip.Addr) bool {
+	return b.start.IsValid() && b.start.BitLen() == ip.BitLen() && b.start.Compare(ip) <= 0 && ip.Compare(b.end) <= 0
+}
+
+// whoisReport looks up the netblock of every host with open ports, given
+// with how many it has, once per block: hosts in a block already found
+// aren't asked about again. Hosts given by name, and without -whois-server
+// addresses no registry has, such as private ones, are left out.
+func whoisReport(open map[string]int) []netblock {
+	hosts := []string{}
+	for host := range open {
+		hosts = append(hosts, host)
+	}
+	slices.SortFunc(hosts, compareHosts)
+	blocks := []*netblock{}
+next:
+	for _, host := range hosts {
+		ip, err := netip.ParseAddr(host)
+		if err != nil {
+			continue
+		}
+		ip = ip.Unmap()
+		if whoisServer == "" && (!ip.IsGlobalUnicast() || ip.IsPrivate()) {
+			continue
+		}
+		for _, b := range blocks {
+			if b.contains(ip) {
+				b.Hosts = append(b.Hosts, host)
+				b.Open += open[host]
+				continue next
+			}
+		}
+		b, err := whoisNetblock(ip)
+		if err != nil {
+			slog.Warn("whois lookup failed", "host", host, "err", err)
+			continue
+		}
+		b.Hosts, b.Open = []string{host}, open[host]
+		blocks = append(blocks, b)
+	}
+	report := []netblock{}
+	for _, b := range blocks {
+		report = append(report, *b)
+	}
+	return report
+}
+
+// whoisNetblock asks -whois-server or IANA about ip and follows the
+// referrals to the registry that has its block.
+func whoisNetblock(ip netip.Addr) (*netblock, error) {
+	server := cmp.Or(whoisServer, whoisIANA)
+	var b *netblock
+	for range whoisHops {
+		query := ip.String()
+		if strings.HasPrefix(server, "whois.arin.net") {
+			// networks only, with their organization
+			query = "n + " + query
+		}
+		resp, err := whoisQuery(server, query)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", server, err)
+		}
+		var refer string
+		b, refer = parseWhois(resp)
+		b.Server = server
+		if refer == "" || refer == server {
+			break
+		}
+		server = refer
+	}
+	if !b.contains(ip) {
+		// no block, or one that doesn't hold ip: report the address alone
+		b.Range, b.start, b.end = ip.String(), ip, ip
+	}
+	return b, nil
+}
+
+func whoisQuery(server, query string) (string, error) {
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, "43")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), whoisTimeout)
+	defer cancel()
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", server)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(whoisTimeout))
+	if _, err := io.WriteString(conn, query+"\r\n"); err != nil {
+		return "", err
+	}
+	resp, err := io.ReadAll(io.LimitReader(conn, 1<<20))
+	return string(resp), err
+}
+
+// parseWhois reads the block out of a WHOIS response, in the key: value
+// form every registry uses with their own keys, and the server it refers
+// to, if any. A later network replaces an earlier one, since ARIN lists the
+// most specific one last.
+func parseWhois(resp string) (b *netblock, refer string) {
+	b = &netblock{}
+	descr := ""
+	for line := range strings.Lines(resp) {
+		if strings.HasPrefix(line, "%") || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(line, ":")
+		value = strings.TrimSpace(value)
+		if !ok || value == "" {
+			continue
+		}
+		switch strings.ToLower(strings.TrimSpace(key)) {
+		case "refer", "whois":
+			refer = cmp.Or(refer, value)
+		case "referralserver":
+			// ARIN, for blocks transferred to another registry; rwhois
+			// servers speak another protocol
+			if s, ok := strings.CutPrefix(value, "whois://"); ok {
+				refer = strings.TrimSuffix(s, "/")
+			}
+		case "netrange", "inetnum", "inet6num":
+			if start, end, ok := parseWhoisRange(value); ok {
+				*b = netblock{Range: value, start: start, end: end}
+				descr = ""
+			}
+		case "cidr":
+			// ARIN writes the range both ways; CIDR reads better
+			if b.start.IsValid() {
+				b.Range = value
+			}
+		case "netname":
+			b.Name = cmp.Or(b.Name, value)
+		case "orgname", "org-name", "owner", "organization":
+			b.Org = cmp.Or(b.Org, value)
+		case "descr":
+			descr = cmp.Or(descr, value)
+		case "country":
+			b.Country = cmp.Or(b.Country, strings.ToUpper(value))
+		}
+	}
+	// APNIC blocks often have no organization, only a description
+	b.Org = cmp.Or(b.Org, descr)
+	return b, refer
+}
+
+// parseWhoisRange reads "start - end", or a CIDR, which LACNIC abbreviates
+// to its significant octets (200.160/12).
+func parseWhoisRange(v string) (start, end netip.Addr, ok bool) {
+	if a, z, found := strings.Cut(v, "-"); found {
+		start, err1 := netip.ParseAddr(strings.TrimSpace(a))
+		end, err2 := netip.ParseAddr(strings.TrimSpace(z))
+		return start, end, err1 == nil && err2 == nil && start.BitLen() == end.BitLen()
+	}
+	v, _, _ = strings.Cut(v, ",")
+	addr, bits, found := strings.Cut(strings.TrimSpace(v), "/")
+	if !found {
+		return netip.Addr{}, netip.Addr{}, false
+	}
+	if !strings.Contains(addr, ":") {
+		for strings.Count(addr, ".") < 3 {
+			addr += ".0"
+		}
+	}
+	p, err := netip.ParsePrefix(addr + "/" + bits)
+	if err != nil {
+		return netip.Addr{}, netip.Addr{}, false
+	}
+	p = p.Masked()
+	last := p.Addr().AsSlice()
+	for i := p.Bits(); i < len(last)*8; i++ {
+		last[i/8] |= 0x80 >> (i % 8)
+	}
+	end, _ = netip.AddrFromSlice(last)
+	return p.Addr(), end, true
+}
+
+// netblockLines is the report as text, one line per block.
+func netblockLines(blocks []netblock) string {
+	var b strings.Builder
+	for _, nb := range blocks {
+		b.WriteString("whois " + nb.String() + "\n")
+	}
+	return b.String()
+}